@@ -0,0 +1,549 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/jimi36/app-engine/log"
+)
+
+type ApplyActionType string
+
+const (
+	ApplyCreate  ApplyActionType = "create"
+	ApplyUpdate  ApplyActionType = "update"
+	ApplyRemove  ApplyActionType = "remove"
+	ApplyStart   ApplyActionType = "start"
+	ApplyStop    ApplyActionType = "stop"
+	ApplyUpgrade ApplyActionType = "upgrade"
+	ApplyScale   ApplyActionType = "scale"
+)
+
+type ApplyObjectKind string
+
+const (
+	ApplyConfig      ApplyObjectKind = "config"
+	ApplyApplication ApplyObjectKind = "application"
+)
+
+// Manifest is the desired state of the configs and applications.
+type Manifest struct {
+	Configs      []*Config              `json:"configs,omitempty"`
+	Applications []*ManifestApplication `json:"applications,omitempty"`
+	// remove the configs and applications which are not in the manifest,
+	// otherwise only the application names in the manifest are managed
+	Prune bool `json:"prune,omitempty"`
+	// only the configs and applications having the labels are pruned
+	PruneSelector map[string]string `json:"pruneSelector,omitempty"`
+}
+
+type ManifestApplication struct {
+	Application `json:",inline"`
+
+	// the version is running, at most one version of a name is running,
+	// and the running version of a name in the manifest is stopped if
+	// none of its versions is running
+	Running bool `json:"running,omitempty"`
+}
+
+type ApplyOption struct {
+	// only plans the actions without executing them
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+type ApplyResult struct {
+	Kind    ApplyObjectKind `json:"kind,omitempty"`
+	Name    string          `json:"name,omitempty"`
+	Version string          `json:"version,omitempty"`
+	Action  ApplyActionType `json:"action,omitempty"`
+	// the version upgraded from
+	FromVersion string `json:"fromVersion,omitempty"`
+	// error of the action, empty in dry-run mode
+	Err string `json:"err,omitempty"`
+}
+
+// applyStep is an action of the apply plan, it is skipped if a previous
+// step of its object or dependencies is failed.
+type applyStep struct {
+	result *ApplyResult
+	key    string
+	deps   []string
+	run    func(context.Context) error
+}
+
+// Apply applies the manifest with the default TaskHandleTimeout.
+func (c *Client) Apply(manifest *Manifest, opt *ApplyOption) ([]*ApplyResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TaskHandleTimeout)
+	defer cancel()
+	return c.ApplyWithContext(ctx, manifest, opt)
+}
+
+// ApplyWithContext computes the actions from the current state to the manifest,
+// and executes them in dependency order unless opt.DryRun is set: the configs
+// are created and updated first, then the applications are stopped, created,
+// updated, scaled, upgraded and started, the removed ones are last. The result
+// of each action is returned, the error is only for the invalid manifest or
+// failing to read the current state.
+func (c *Client) ApplyWithContext(ctx context.Context, manifest *Manifest, opt *ApplyOption) ([]*ApplyResult, error) {
+	log.Debugf("apply manifest......")
+
+	if opt == nil {
+		opt = &ApplyOption{}
+	}
+
+	if err := validateManifest(manifest); err != nil {
+		log.Warnf("apply manifest error: %s", err.Error())
+		return nil, err
+	}
+
+	steps, err := c.planManifest(ctx, manifest)
+	if err != nil {
+		log.Warnf("apply manifest error: %s", err.Error())
+		return nil, err
+	}
+
+	results := make([]*ApplyResult, 0, len(steps))
+	failed := make(map[string]bool)
+	for _, step := range steps {
+		results = append(results, step.result)
+		if opt.DryRun {
+			continue
+		}
+
+		skipped := false
+		for _, key := range append(step.deps, step.key) {
+			if failed[key] {
+				step.result.Err = "skipped as " + key + " failed"
+				skipped = true
+				break
+			}
+		}
+		if !skipped {
+			if err := step.run(ctx); err != nil {
+				step.result.Err = err.Error()
+			}
+		}
+		if len(step.result.Err) > 0 {
+			failed[step.key] = true
+			log.Warnf("apply %s[%s] %s error: %s", step.result.Kind, step.key, step.result.Action, step.result.Err)
+		}
+	}
+
+	log.Infof("apply manifest finished, %d actions", len(results))
+
+	return results, nil
+}
+
+func validateManifest(manifest *Manifest) error {
+	if manifest == nil {
+		return ErrParamInvalid
+	}
+
+	configs := make(map[string]bool)
+	for _, config := range manifest.Configs {
+		if config == nil || len(config.Name) == 0 {
+			return errors.Wrap(ErrParamInvalid, "config name is empty")
+		}
+		if configs[config.Name] {
+			return errors.Wrapf(ErrParamInvalid, "config %s is duplicated", config.Name)
+		}
+		configs[config.Name] = true
+	}
+
+	tags := make(map[string]bool)
+	running := make(map[string]string)
+	for _, app := range manifest.Applications {
+		if app == nil || len(app.Name) == 0 || len(app.Version) == 0 {
+			return errors.Wrap(ErrParamInvalid, "application name or version is empty")
+		}
+		if tags[app.Tag()] {
+			return errors.Wrapf(ErrParamInvalid, "application %s is duplicated", app.Tag())
+		}
+		tags[app.Tag()] = true
+		if app.Running {
+			if v, found := running[app.Name]; found {
+				return errors.Wrapf(ErrParamInvalid, "application %s has two running versions %s and %s", app.Name, v, app.Version)
+			}
+			running[app.Name] = app.Version
+		}
+	}
+
+	return nil
+}
+
+// planManifest compares the manifest with the current state and returns the steps in order.
+func (c *Client) planManifest(ctx context.Context, manifest *Manifest) ([]*applyStep, error) {
+	// current configs
+	configs, err := c.ListConfigsWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	curConfigs := make(map[string]*Config)
+	for _, config := range configs {
+		curConfigs[config.Name] = config
+	}
+
+	// current applications and their running versions
+	tags, err := c.ListApplicationsWithContext(ctx, &ListApplicationOption{Size: math.MaxInt32})
+	if err != nil {
+		return nil, err
+	}
+	curApps := make(map[string]bool)
+	curVersions := make(map[string][]string)
+	curRunning := make(map[string]string)
+	if len(tags) > 0 {
+		states, err := c.GetApplicationStatesWithContext(ctx, tags)
+		if err != nil {
+			return nil, err
+		}
+		for _, state := range states {
+			if state.ToStart {
+				curRunning[state.Name] = state.Version
+			}
+		}
+		for _, tag := range tags {
+			curApps[tag.Tag()] = true
+			curVersions[tag.Name] = append(curVersions[tag.Name], tag.Version)
+		}
+	}
+
+	// desired applications by name
+	apps := make(map[string]map[string]*ManifestApplication)
+	running := make(map[string]string)
+	for _, app := range manifest.Applications {
+		if apps[app.Name] == nil {
+			apps[app.Name] = make(map[string]*ManifestApplication)
+		}
+		apps[app.Name][app.Version] = app
+		if app.Running {
+			running[app.Name] = app.Version
+		}
+	}
+
+	var names []string
+	for name := range apps {
+		names = append(names, name)
+	}
+	if manifest.Prune {
+		// the versions not selected are left alone
+		for name, versions := range curVersions {
+			var selected []string
+			for _, version := range versions {
+				ok, err := c.pruneSelected(ctx, &ApplicationTag{Name: name, Version: version}, manifest.PruneSelector)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					selected = append(selected, version)
+				} else if apps[name] == nil && version == curRunning[name] {
+					delete(curRunning, name)
+				}
+			}
+			curVersions[name] = selected
+			if apps[name] == nil && len(selected) > 0 {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	var configSteps, stopSteps, appSteps, startSteps, removeSteps []*applyStep
+
+	// configs to create and update
+	for _, config := range manifest.Configs {
+		config := config
+		cur, found := curConfigs[config.Name]
+		if found && sameObject(cur, config) {
+			continue
+		}
+		step := &applyStep{
+			result: &ApplyResult{
+				Kind:   ApplyConfig,
+				Name:   config.Name,
+				Action: ApplyCreate,
+			},
+			key: configKey(config.Name),
+			run: func(ctx context.Context) error {
+				return c.CreateConfigWithContext(ctx, config)
+			},
+		}
+		if found {
+			step.result.Action = ApplyUpdate
+			step.run = func(ctx context.Context) error {
+				return c.UpdateConfigWithContext(ctx, config)
+			}
+		}
+		configSteps = append(configSteps, step)
+	}
+
+	for _, name := range names {
+		name := name
+		desired := running[name]
+		current := curRunning[name]
+
+		// the running version is replaced if its spec is changed
+		restart := false
+
+		var versions []string
+		for version := range apps[name] {
+			versions = append(versions, version)
+		}
+		sort.Strings(versions)
+
+		for _, version := range versions {
+			app := apps[name][version]
+			tag := &ApplicationTag{Name: name, Version: version}
+			result := &ApplyResult{
+				Kind:    ApplyApplication,
+				Name:    name,
+				Version: version,
+			}
+
+			if !curApps[tag.Tag()] {
+				result.Action = ApplyCreate
+				appSteps = append(appSteps, &applyStep{
+					result: result,
+					key:    appKey(tag),
+					deps:   configDeps(&app.Application),
+					run: func(ctx context.Context) error {
+						return c.CreateApplicationWithContext(ctx, &app.Application)
+					},
+				})
+				continue
+			}
+
+			cur, err := c.GetApplicationWithContext(ctx, tag)
+			if err != nil {
+				return nil, err
+			}
+			if !sameSpec(cur, &app.Application) {
+				result.Action = ApplyUpdate
+				step := &applyStep{
+					result: result,
+					key:    appKey(tag),
+					deps:   configDeps(&app.Application),
+					run: func(ctx context.Context) error {
+						return c.UpdateApplicationWithContext(ctx, &app.Application)
+					},
+				}
+				switch {
+				case version == current && version == desired:
+					// stopped, updated and started again
+					restart = true
+					appSteps = append(appSteps, step)
+				case version == current:
+					// updated after the running version is changed
+					step.deps = append(step.deps, appKey(&ApplicationTag{Name: name, Version: desired}))
+					removeSteps = append(removeSteps, step)
+				default:
+					appSteps = append(appSteps, step)
+				}
+				continue
+			}
+
+			if replicas := replicasOf(&app.Application); replicas != replicasOf(cur) {
+				result.Action = ApplyScale
+				appSteps = append(appSteps, &applyStep{
+					result: result,
+					key:    appKey(tag),
+					run: func(ctx context.Context) error {
+						return c.ScaleApplicationWithContext(ctx, tag, replicas)
+					},
+				})
+			}
+		}
+
+		// running version
+		switch {
+		case len(current) > 0 && (len(desired) == 0 || restart):
+			tag := &ApplicationTag{Name: name, Version: current}
+			stopSteps = append(stopSteps, &applyStep{
+				result: &ApplyResult{
+					Kind:    ApplyApplication,
+					Name:    name,
+					Version: current,
+					Action:  ApplyStop,
+				},
+				key: appKey(tag),
+				run: func(ctx context.Context) error {
+					return c.StopApplicationWithContext(ctx, tag)
+				},
+			})
+			if len(desired) > 0 {
+				startSteps = append(startSteps, c.startStep(name, desired))
+			}
+		case len(current) > 0 && current != desired:
+			// upgrade the running one after the desired version is created
+			to := &ApplicationTag{Name: name, Version: desired}
+			startSteps = append(startSteps, &applyStep{
+				result: &ApplyResult{
+					Kind:        ApplyApplication,
+					Name:        name,
+					Version:     desired,
+					Action:      ApplyUpgrade,
+					FromVersion: current,
+				},
+				key: appKey(to),
+				run: func(ctx context.Context) error {
+					return c.UpgradeApplicationWithContext(ctx, name, current, desired)
+				},
+			})
+		case len(current) == 0 && len(desired) > 0:
+			startSteps = append(startSteps, c.startStep(name, desired))
+		}
+
+		// versions to remove, the running one is removed after it's replaced
+		if !manifest.Prune {
+			continue
+		}
+		for _, version := range curVersions[name] {
+			if apps[name][version] != nil {
+				continue
+			}
+			tag := &ApplicationTag{Name: name, Version: version}
+			step := &applyStep{
+				result: &ApplyResult{
+					Kind:    ApplyApplication,
+					Name:    name,
+					Version: version,
+					Action:  ApplyRemove,
+				},
+				key: appKey(tag),
+				run: func(ctx context.Context) error {
+					return c.RemoveApplicationWithContext(ctx, tag)
+				},
+			}
+			if version == current && len(desired) > 0 {
+				step.deps = []string{appKey(&ApplicationTag{Name: name, Version: desired})}
+			}
+			removeSteps = append(removeSteps, step)
+		}
+	}
+
+	// configs to remove, after the applications using them are removed
+	if manifest.Prune {
+		keep := make(map[string]bool)
+		for _, config := range manifest.Configs {
+			keep[config.Name] = true
+		}
+		var removed []string
+		for name, config := range curConfigs {
+			if !keep[name] && matchLabels(config.Labels, manifest.PruneSelector) {
+				removed = append(removed, name)
+			}
+		}
+		sort.Strings(removed)
+		for _, name := range removed {
+			name := name
+			removeSteps = append(removeSteps, &applyStep{
+				result: &ApplyResult{
+					Kind:   ApplyConfig,
+					Name:   name,
+					Action: ApplyRemove,
+				},
+				key: configKey(name),
+				run: func(ctx context.Context) error {
+					return c.RemoveConfigWithContext(ctx, name)
+				},
+			})
+		}
+	}
+
+	var steps []*applyStep
+	steps = append(steps, configSteps...)
+	steps = append(steps, stopSteps...)
+	steps = append(steps, appSteps...)
+	steps = append(steps, startSteps...)
+	steps = append(steps, removeSteps...)
+	return steps, nil
+}
+
+func (c *Client) startStep(name, version string) *applyStep {
+	tag := &ApplicationTag{Name: name, Version: version}
+	return &applyStep{
+		result: &ApplyResult{
+			Kind:    ApplyApplication,
+			Name:    name,
+			Version: version,
+			Action:  ApplyStart,
+		},
+		key: appKey(tag),
+		run: func(ctx context.Context) error {
+			return c.StartApplicationWithContext(ctx, tag)
+		},
+	}
+}
+
+// pruneSelected returns whether the application has the labels of the selector.
+func (c *Client) pruneSelected(ctx context.Context, tag *ApplicationTag, selector map[string]string) (bool, error) {
+	if len(selector) == 0 {
+		return true, nil
+	}
+	app, err := c.GetApplicationWithContext(ctx, tag)
+	if err != nil {
+		return false, err
+	}
+	return matchLabels(app.Labels, selector), nil
+}
+
+func matchLabels(labels, selector map[string]string) bool {
+	for k, v := range selector {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func configKey(name string) string {
+	return string(ApplyConfig) + "/" + name
+}
+
+func appKey(tag *ApplicationTag) string {
+	return string(ApplyApplication) + "/" + tag.Name + "/" + tag.Version
+}
+
+// configDeps returns the configs mounted by the application.
+func configDeps(app *Application) []string {
+	var deps []string
+	if app.KubeSpec != nil {
+		for _, v := range app.KubeSpec.Volumes {
+			if len(v.ConfigName) > 0 {
+				deps = append(deps, configKey(v.ConfigName))
+			}
+		}
+	}
+	return deps
+}
+
+func replicasOf(app *Application) int {
+	if app.Replicas > 0 {
+		return app.Replicas
+	}
+	return 1
+}
+
+// sameSpec compares the applications except their replicas, which are scaled in place.
+func sameSpec(a, b *Application) bool {
+	x, y := *a, *b
+	x.Replicas, y.Replicas = 0, 0
+	return sameObject(&x, &y)
+}
+
+// sameObject compares the objects by their json encodings, so the empty
+// and nil fields are the same.
+func sameObject(a, b interface{}) bool {
+	x, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	y, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return string(x) == string(y)
+}
@@ -0,0 +1,269 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// fakeImpl is the ClientImpl keeping the configs and applications in memory,
+// the changes applied to it are recorded.
+type fakeImpl struct {
+	ClientImpl
+	configs []*Config
+	apps    []*Application
+	// running version by name
+	running map[string]string
+	history *ApplicationHistory
+	calls   []string
+}
+
+func (f *fakeImpl) Init(PostTaskEventFunc, NotifyEventFunc) error {
+	return nil
+}
+
+func (f *fakeImpl) Close(*TaskEvent) *TaskResult {
+	return &TaskResult{}
+}
+
+func (f *fakeImpl) GetStartedApplications(*TaskEvent) *TaskResult {
+	return &TaskResult{Out: []*ApplicationRuntime{}}
+}
+
+func (f *fakeImpl) ListConfigs(*TaskEvent) *TaskResult {
+	return &TaskResult{Out: f.configs}
+}
+
+func (f *fakeImpl) ListApplications(*TaskEvent) *TaskResult {
+	var tags []*ApplicationTag
+	for _, app := range f.apps {
+		tags = append(tags, &ApplicationTag{Name: app.Name, Version: app.Version})
+	}
+	return &TaskResult{Out: tags}
+}
+
+func (f *fakeImpl) GetApplicationStates(ev *TaskEvent) *TaskResult {
+	var states []*ApplicationState
+	for _, tag := range ev.In.([]*ApplicationTag) {
+		states = append(states, &ApplicationState{
+			Name:    tag.Name,
+			Version: tag.Version,
+			ToStart: f.running[tag.Name] == tag.Version,
+		})
+	}
+	return &TaskResult{Out: states}
+}
+
+func (f *fakeImpl) GetApplication(ev *TaskEvent) *TaskResult {
+	tag := ev.In.(*ApplicationTag)
+	for _, app := range f.apps {
+		if app.ApplicationTag == *tag {
+			return &TaskResult{Out: app}
+		}
+	}
+	return &TaskResult{Err: ErrApplicationNoExisted}
+}
+
+func (f *fakeImpl) record(action string, in interface{}) *TaskResult {
+	switch v := in.(type) {
+	case *Config:
+		f.calls = append(f.calls, action+" config "+v.Name)
+	case *Application:
+		f.calls = append(f.calls, action+" "+v.Tag())
+	case *ApplicationTag:
+		f.calls = append(f.calls, action+" "+v.Tag())
+	case *UpgradeRequest:
+		f.calls = append(f.calls, action+" "+v.Name+" from "+v.FromVersion+" to "+v.ToVersion)
+	}
+	return &TaskResult{}
+}
+
+func (f *fakeImpl) CreateConfig(ev *TaskEvent) *TaskResult {
+	return f.record("create", ev.In)
+}
+
+func (f *fakeImpl) UpdateConfig(ev *TaskEvent) *TaskResult {
+	return f.record("update", ev.In)
+}
+
+func (f *fakeImpl) CreateApplication(ev *TaskEvent) *TaskResult {
+	return f.record("create", ev.In)
+}
+
+func (f *fakeImpl) UpdateApplication(ev *TaskEvent) *TaskResult {
+	return f.record("update", ev.In)
+}
+
+func (f *fakeImpl) RemoveApplication(ev *TaskEvent) *TaskResult {
+	return f.record("remove", ev.In)
+}
+
+func (f *fakeImpl) StartApplication(ev *TaskEvent) *TaskResult {
+	return f.record("start", ev.In)
+}
+
+func (f *fakeImpl) StopApplication(ev *TaskEvent) *TaskResult {
+	return f.record("stop", ev.In)
+}
+
+func (f *fakeImpl) UpgradeApplication(ev *TaskEvent) *TaskResult {
+	f.record("upgrade", ev.In)
+	done := make(chan error, 1)
+	done <- nil
+	return &TaskResult{Out: (<-chan error)(done)}
+}
+
+func (f *fakeImpl) GetApplicationHistory(*TaskEvent) *TaskResult {
+	return &TaskResult{Out: f.history}
+}
+
+func newTestClient(t *testing.T, impl ClientImpl) (*Client, func()) {
+	c := NewClient(impl)
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return c, func() {
+		c.Stop(&StopOption{})
+	}
+}
+
+func testApp(name, version string, labels, env map[string]string) *Application {
+	return &Application{
+		ApplicationTag: ApplicationTag{Name: name, Version: version},
+		Labels:         labels,
+		Env:            env,
+	}
+}
+
+func manifestApp(app *Application, running bool) *ManifestApplication {
+	return &ManifestApplication{Application: *app, Running: running}
+}
+
+func TestPlanManifest(t *testing.T) {
+	teamX := map[string]string{"team": "x"}
+	teamY := map[string]string{"team": "y"}
+
+	cases := []struct {
+		name     string
+		impl     *fakeImpl
+		manifest *Manifest
+		actions  []string
+	}{
+		{
+			"create",
+			&fakeImpl{},
+			&Manifest{
+				Configs:      []*Config{{Name: "c1"}},
+				Applications: []*ManifestApplication{manifestApp(testApp("a", "1", nil, nil), true)},
+			},
+			[]string{"config c1 create", "application a:1 create", "application a:1 start"},
+		},
+		{
+			"update running version",
+			&fakeImpl{
+				configs: []*Config{{Name: "c1", Data: map[string]string{"k": "1"}}},
+				apps:    []*Application{testApp("a", "1", nil, map[string]string{"K": "1"})},
+				running: map[string]string{"a": "1"},
+			},
+			&Manifest{
+				Configs:      []*Config{{Name: "c1", Data: map[string]string{"k": "2"}}},
+				Applications: []*ManifestApplication{manifestApp(testApp("a", "1", nil, map[string]string{"K": "2"}), true)},
+			},
+			[]string{"config c1 update", "application a:1 stop", "application a:1 update", "application a:1 start"},
+		},
+		{
+			"upgrade",
+			&fakeImpl{
+				apps:    []*Application{testApp("a", "1", nil, nil)},
+				running: map[string]string{"a": "1"},
+			},
+			&Manifest{
+				Applications: []*ManifestApplication{
+					manifestApp(testApp("a", "1", nil, nil), false),
+					manifestApp(testApp("a", "2", nil, nil), true),
+				},
+			},
+			[]string{"application a:2 create", "application a:2 upgrade from 1"},
+		},
+		{
+			"stop",
+			&fakeImpl{
+				apps:    []*Application{testApp("a", "1", nil, nil)},
+				running: map[string]string{"a": "1"},
+			},
+			&Manifest{
+				Applications: []*ManifestApplication{manifestApp(testApp("a", "1", nil, nil), false)},
+			},
+			[]string{"application a:1 stop"},
+		},
+		{
+			"prune with selector",
+			&fakeImpl{
+				configs: []*Config{{Name: "c1", Labels: teamX}, {Name: "c2", Labels: teamY}},
+				apps:    []*Application{testApp("a", "1", teamX, nil), testApp("b", "1", teamY, nil)},
+				running: map[string]string{"a": "1", "b": "1"},
+			},
+			&Manifest{
+				Prune:         true,
+				PruneSelector: teamX,
+			},
+			[]string{"application a:1 stop", "application a:1 remove", "config c1 remove"},
+		},
+	}
+
+	for _, c := range cases {
+		cli, cleanup := newTestClient(t, c.impl)
+		steps, err := cli.planManifest(context.Background(), c.manifest)
+		cleanup()
+		if err != nil {
+			t.Errorf("%s: plan error: %v", c.name, err)
+			continue
+		}
+
+		var actions []string
+		for _, step := range steps {
+			r := step.result
+			action := fmt.Sprintf("%s %s %s", r.Kind, r.Name, r.Action)
+			if r.Kind == ApplyApplication {
+				action = fmt.Sprintf("%s %s:%s %s", r.Kind, r.Name, r.Version, r.Action)
+			}
+			if len(r.FromVersion) > 0 {
+				action += " from " + r.FromVersion
+			}
+			actions = append(actions, action)
+		}
+		if !reflect.DeepEqual(actions, c.actions) {
+			t.Errorf("%s: planned %q, want %q", c.name, actions, c.actions)
+		}
+	}
+}
+
+func TestApplyUpdateInPlace(t *testing.T) {
+	impl := &fakeImpl{
+		configs: []*Config{{Name: "c1", Data: map[string]string{"k": "1"}}},
+		apps:    []*Application{testApp("a", "1", nil, map[string]string{"K": "1"})},
+		running: map[string]string{"a": "1"},
+	}
+	cli, cleanup := newTestClient(t, impl)
+	defer cleanup()
+
+	results, err := cli.Apply(&Manifest{
+		Configs:      []*Config{{Name: "c1", Data: map[string]string{"k": "2"}}},
+		Applications: []*ManifestApplication{manifestApp(testApp("a", "1", nil, map[string]string{"K": "2"}), true)},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if len(r.Err) > 0 {
+			t.Errorf("%s %s %s error: %s", r.Kind, r.Name, r.Action, r.Err)
+		}
+	}
+
+	// nothing is removed and created again
+	want := []string{"update config c1", "stop a-1", "update a-1", "start a-1"}
+	if !reflect.DeepEqual(impl.calls, want) {
+		t.Errorf("applied %q, want %q", impl.calls, want)
+	}
+}
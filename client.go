@@ -1,37 +1,78 @@
 package engine
 
 import (
+	"context"
+	"io"
+	"sync"
 	"time"
 
 	"github.com/jimi36/app-engine/log"
 )
 
 const (
+	// TaskHandleTimeout is the deadline of the client calls without context
 	TaskHandleTimeout = time.Second * 100
 )
 
+const (
+	clientIdle = iota
+	clientStarted
+	clientStopped
+)
+
 type Option func(ClientImpl) error
 
+type ClientOption func(*Client)
+
 type ClientImpl interface {
-	Init(postFunc PostTaskEventFunc) error
+	Init(postFunc PostTaskEventFunc, notifyFunc NotifyEventFunc) error
 
 	CreateApplication(*TaskEvent) *TaskResult
+	// UpdateApplication replaces the spec of the version which is not
+	// running in place
+	UpdateApplication(*TaskEvent) *TaskResult
 	RemoveApplication(*TaskEvent) *TaskResult
 	StartApplication(*TaskEvent) *TaskResult
 	RestartApplication(*TaskEvent) *TaskResult
 	StopApplication(*TaskEvent) *TaskResult
 	ListApplications(*TaskEvent) *TaskResult
+	GetApplication(*TaskEvent) *TaskResult
 	GetApplicationStates(*TaskEvent) *TaskResult
 	GetStartedApplications(*TaskEvent) *TaskResult
+	GetApplicationLogs(*TaskEvent) *TaskResult
+	GetApplicationHistory(*TaskEvent) *TaskResult
+	// PrefetchApplication returns a channel receiving the fetch result
+	PrefetchApplication(*TaskEvent) *TaskResult
+	// UpgradeApplication returns a channel receiving the upgrade result
+	UpgradeApplication(*TaskEvent) *TaskResult
+	ScaleApplication(*TaskEvent) *TaskResult
+	// CollectGarbage returns a channel receiving the *GCResult
+	CollectGarbage(*TaskEvent) *TaskResult
+	// ReconcileApplications corrects the drifts from the desired state,
+	// and returns the []*ReconcileAction
+	ReconcileApplications(*TaskEvent) *TaskResult
 
 	CreateConfig(*TaskEvent) *TaskResult
+	// UpdateConfig replaces the data and labels of the config in place
+	UpdateConfig(*TaskEvent) *TaskResult
 	RemoveConfig(*TaskEvent) *TaskResult
+	ListConfigs(*TaskEvent) *TaskResult
+
+	// Close releases the resources of the impl, it is called once
+	// after the event loop is exited
+	Close(*TaskEvent) *TaskResult
 }
 
-func NewClient(impl ClientImpl) *Client {
+func NewClient(impl ClientImpl, opts ...ClientOption) *Client {
 	c := &Client{
-		impl:    impl,
-		eventCh: make(chan *TaskEvent, 1024),
+		impl:     impl,
+		eventCh:  make(chan *TaskEvent, 1024),
+		quit:     make(chan struct{}),
+		loopDone: make(chan struct{}),
+		watchers: make(map[*Watcher]struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
 	return c
 }
@@ -41,26 +82,115 @@ type Client struct {
 	impl ClientImpl
 	// task event channel
 	eventCh chan *TaskEvent
+	// client state, guards posting task events
+	mu    sync.RWMutex
+	state int
+	// closed to exit the event loop
+	quit chan struct{}
+	// bounds draining the pending task events, set before quit is closed
+	stopCtx context.Context
+	// closed when the event loop is exited
+	loopDone chan struct{}
+	// application event watchers
+	watchMu  sync.Mutex
+	watchers map[*Watcher]struct{}
+	// periodic reconciliation and its metrics
+	reconcileInterval time.Duration
+	reconcileDryRun   bool
+	statsMu           sync.Mutex
+	reconcileStats    ReconcileStats
 }
 
+// Start starts the event loop and restarts the applications which were started
+// before, then the drifts are corrected periodically if ReconcileInterval is set.
+// A stopped client can't be started again, create a new one instead.
 func (c *Client) Start() error {
-	c.impl.Init(c.postTaskEvent)
+	c.mu.Lock()
+	if c.state != clientIdle {
+		c.mu.Unlock()
+		return ErrClientStarted
+	}
+	if err := c.impl.Init(c.postTaskEvent, c.notifyEvent); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	c.state = clientStarted
+	c.mu.Unlock()
 
 	go c.appEventLoop()
 
 	ret := c.impl.GetStartedApplications(nil)
 	rts := ret.Out.([]*ApplicationRuntime)
 	for _, rt := range rts {
-		c.restartApplication(&ApplicationTag{rt.Name, rt.Version})
+		ctx, cancel := context.WithTimeout(context.Background(), TaskHandleTimeout)
+		c.restartApplication(ctx, &ApplicationTag{rt.Name, rt.Version})
+		cancel()
+	}
+
+	if c.reconcileInterval > 0 {
+		go c.reconcileLoop()
+	}
+
+	return nil
+}
+
+// Stop stops the client with the default TaskHandleTimeout.
+func (c *Client) Stop(opt *StopOption) error {
+	ctx, cancel := context.WithTimeout(context.Background(), TaskHandleTimeout)
+	defer cancel()
+	return c.StopWithContext(ctx, opt)
+}
+
+// StopWithContext rejects new task events, drains the pending ones until ctx
+// is done and then closes the client impl. The started applications are
+// stopped unless opt.KeepApplications is set, but they are still to be started
+// by the next Start either way.
+func (c *Client) StopWithContext(ctx context.Context, opt *StopOption) error {
+	log.Debugf("stop client......")
+
+	if opt == nil {
+		opt = &StopOption{}
 	}
 
+	c.mu.Lock()
+	if c.state != clientStarted {
+		c.mu.Unlock()
+		log.Warnf("stop client error: %s", ErrClientNotStarted.Error())
+		return ErrClientNotStarted
+	}
+	c.state = clientStopped
+	c.mu.Unlock()
+
+	// exit the event loop, the pending task events are drained until ctx is
+	// done, and then the client impl is always closed
+	c.stopCtx = ctx
+	close(c.quit)
+	<-c.loopDone
+
+	ret := c.impl.Close(&TaskEvent{Ctx: ctx, In: opt})
+	c.stopWatchers()
+	if ret.Err != nil {
+		log.Warnf("stop client error: %s", ret.Err.Error())
+		return ret.Err
+	}
+
+	log.Infof("stop client finished")
+
 	return nil
 }
 
+// CreateApplication creates the application with the default TaskHandleTimeout.
 func (c *Client) CreateApplication(app *Application) error {
+	ctx, cancel := context.WithTimeout(context.Background(), TaskHandleTimeout)
+	defer cancel()
+	return c.CreateApplicationWithContext(ctx, app)
+}
+
+// CreateApplicationWithContext creates the application, the call is aborted when ctx is done.
+func (c *Client) CreateApplicationWithContext(ctx context.Context, app *Application) error {
 	log.Debugf("create application[%s]......", app.Tag())
 
-	rc, err := c.postTaskEvent(app, c.impl.CreateApplication, true)
+	rc, err := c.postTaskEvent(ctx, app, c.impl.CreateApplication, true)
 	if err != nil {
 		log.Warnf("create application[%s] error: %s", app.Tag(), err.Error())
 		return err
@@ -68,9 +198,10 @@ func (c *Client) CreateApplication(app *Application) error {
 
 	var ret *TaskResult
 	select {
-	case <-time.After(TaskHandleTimeout):
-		log.Warnf("create application[%s] timeout", app.Tag())
-		return ErrTimeout
+	case <-ctx.Done():
+		err := contextError(ctx)
+		log.Warnf("create application[%s] error: %s", app.Tag(), err.Error())
+		return err
 	case ret = <-rc:
 	}
 
@@ -84,17 +215,62 @@ func (c *Client) CreateApplication(app *Application) error {
 	return nil
 }
 
+// UpdateApplication updates the application with the default TaskHandleTimeout.
+func (c *Client) UpdateApplication(app *Application) error {
+	ctx, cancel := context.WithTimeout(context.Background(), TaskHandleTimeout)
+	defer cancel()
+	return c.UpdateApplicationWithContext(ctx, app)
+}
+
+// UpdateApplicationWithContext replaces the spec of the existed application
+// version, which must not be running, the call is aborted when ctx is done.
+func (c *Client) UpdateApplicationWithContext(ctx context.Context, app *Application) error {
+	log.Debugf("update application[%s]......", app.Tag())
+
+	rc, err := c.postTaskEvent(ctx, app, c.impl.UpdateApplication, true)
+	if err != nil {
+		log.Warnf("update application[%s] error: %s", app.Tag(), err.Error())
+		return err
+	}
+
+	var ret *TaskResult
+	select {
+	case <-ctx.Done():
+		err := contextError(ctx)
+		log.Warnf("update application[%s] error: %s", app.Tag(), err.Error())
+		return err
+	case ret = <-rc:
+	}
+
+	if ret.Err != nil {
+		log.Warnf("update application[%s] error: %s", app.Tag(), ret.Err.Error())
+		return ret.Err
+	}
+
+	log.Infof("update application[%s] finished", app.Tag())
+
+	return nil
+}
+
+// RemoveApplication stops and removes the application with the default TaskHandleTimeout.
 func (c *Client) RemoveApplication(tag *ApplicationTag) error {
+	ctx, cancel := context.WithTimeout(context.Background(), TaskHandleTimeout)
+	defer cancel()
+	return c.RemoveApplicationWithContext(ctx, tag)
+}
+
+// RemoveApplicationWithContext stops and removes the application, the call is aborted when ctx is done.
+func (c *Client) RemoveApplicationWithContext(ctx context.Context, tag *ApplicationTag) error {
 	log.Debugf("remove application[%s]......", tag.Tag())
 
 	// stop application
-	err := c.StopApplication(tag)
+	err := c.StopApplicationWithContext(ctx, tag)
 	if err != nil && err != ErrApplicationNotStarted {
 		log.Warnf("remove application[%s] error: %s", tag.Tag(), err.Error())
 		return err
 	}
 
-	rc, err := c.postTaskEvent(tag, c.impl.RemoveApplication, true)
+	rc, err := c.postTaskEvent(ctx, tag, c.impl.RemoveApplication, true)
 	if err != nil {
 		log.Warnf("remove application[%s] error: %s", tag.Tag(), err.Error())
 		return err
@@ -102,9 +278,10 @@ func (c *Client) RemoveApplication(tag *ApplicationTag) error {
 
 	var ret *TaskResult
 	select {
-	case <-time.After(TaskHandleTimeout):
-		log.Warnf("remove application[%s] timeout", tag.Tag())
-		return ErrTimeout
+	case <-ctx.Done():
+		err := contextError(ctx)
+		log.Warnf("remove application[%s] error: %s", tag.Tag(), err.Error())
+		return err
 	case ret = <-rc:
 	}
 
@@ -118,7 +295,7 @@ func (c *Client) RemoveApplication(tag *ApplicationTag) error {
 	return nil
 }
 
-func (c *Client) restartApplication(tag *ApplicationTag) error {
+func (c *Client) restartApplication(ctx context.Context, tag *ApplicationTag) error {
 	log.Debugf("restart application[%s]......", tag.Tag())
 
 	if len(tag.Name) == 0 || len(tag.Version) == 0 {
@@ -127,17 +304,18 @@ func (c *Client) restartApplication(tag *ApplicationTag) error {
 	}
 
 	// create start application task event
-	rc, err := c.postTaskEvent(tag, c.impl.RestartApplication, true)
+	rc, err := c.postTaskEvent(ctx, tag, c.impl.RestartApplication, true)
 	if err != nil {
-		log.Fatalf("restart application[%s] error: %s", tag.Tag(), err.Error())
+		log.Warnf("restart application[%s] error: %s", tag.Tag(), err.Error())
 		return err
 	}
 
 	var ret *TaskResult
 	select {
-	case <-time.After(TaskHandleTimeout):
-		log.Warnf("restart application[%s] timeout", tag.Tag())
-		return ErrTimeout
+	case <-ctx.Done():
+		err := contextError(ctx)
+		log.Warnf("restart application[%s] error: %s", tag.Tag(), err.Error())
+		return err
 	case ret = <-rc:
 	}
 
@@ -151,7 +329,17 @@ func (c *Client) restartApplication(tag *ApplicationTag) error {
 	return nil
 }
 
+// StartApplication starts the application with the default TaskHandleTimeout.
 func (c *Client) StartApplication(tag *ApplicationTag) error {
+	ctx, cancel := context.WithTimeout(context.Background(), TaskHandleTimeout)
+	defer cancel()
+	return c.StartApplicationWithContext(ctx, tag)
+}
+
+// StartApplicationWithContext starts the application, the call is aborted when ctx is done.
+// The resource of the native application is downloaded in background after the
+// call returns, which is not bound to ctx but aborted by StopApplication.
+func (c *Client) StartApplicationWithContext(ctx context.Context, tag *ApplicationTag) error {
 	log.Debugf("start application[%s]......", tag.Tag())
 
 	if len(tag.Name) == 0 || len(tag.Version) == 0 {
@@ -160,17 +348,18 @@ func (c *Client) StartApplication(tag *ApplicationTag) error {
 	}
 
 	// create start application task event
-	rc, err := c.postTaskEvent(tag, c.impl.StartApplication, true)
+	rc, err := c.postTaskEvent(ctx, tag, c.impl.StartApplication, true)
 	if err != nil {
-		log.Fatalf("start application[%s] error: %s", tag.Tag(), err.Error())
+		log.Warnf("start application[%s] error: %s", tag.Tag(), err.Error())
 		return err
 	}
 
 	var ret *TaskResult
 	select {
-	case <-time.After(TaskHandleTimeout):
-		log.Warnf("start application[%s] timeout", tag.Tag())
-		return ErrTimeout
+	case <-ctx.Done():
+		err := contextError(ctx)
+		log.Warnf("start application[%s] error: %s", tag.Tag(), err.Error())
+		return err
 	case ret = <-rc:
 	}
 
@@ -184,20 +373,29 @@ func (c *Client) StartApplication(tag *ApplicationTag) error {
 	return nil
 }
 
+// StopApplication stops the application with the default TaskHandleTimeout.
 func (c *Client) StopApplication(tag *ApplicationTag) error {
+	ctx, cancel := context.WithTimeout(context.Background(), TaskHandleTimeout)
+	defer cancel()
+	return c.StopApplicationWithContext(ctx, tag)
+}
+
+// StopApplicationWithContext stops the application, the call is aborted when ctx is done.
+func (c *Client) StopApplicationWithContext(ctx context.Context, tag *ApplicationTag) error {
 	log.Debugf("stop application[%s]......", tag.Tag())
 
-	rc, err := c.postTaskEvent(tag, c.impl.StopApplication, true)
+	rc, err := c.postTaskEvent(ctx, tag, c.impl.StopApplication, true)
 	if err != nil {
-		log.Fatalf("stop application[%s] error: %s", tag.Tag(), err.Error())
+		log.Warnf("stop application[%s] error: %s", tag.Tag(), err.Error())
 		return err
 	}
 
 	var ret *TaskResult
 	select {
-	case <-time.After(TaskHandleTimeout):
-		log.Warnf("stop application[%s] timeout", tag.Tag())
-		return ErrTimeout
+	case <-ctx.Done():
+		err := contextError(ctx)
+		log.Warnf("stop application[%s] error: %s", tag.Tag(), err.Error())
+		return err
 	case ret = <-rc:
 	}
 
@@ -206,24 +404,80 @@ func (c *Client) StopApplication(tag *ApplicationTag) error {
 		return ret.Err
 	}
 
+	if out, ok := ret.Out.(*StopResult); ok && out.Killed {
+		log.Warnf("stop application[%s]: killed after grace period", tag.Tag())
+	}
+
 	log.Infof("stop application[%s] finished", tag.Tag())
 
 	return nil
 }
 
+// GetApplication gets the application spec with the default TaskHandleTimeout.
+func (c *Client) GetApplication(tag *ApplicationTag) (*Application, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TaskHandleTimeout)
+	defer cancel()
+	return c.GetApplicationWithContext(ctx, tag)
+}
+
+// GetApplicationWithContext gets the application spec, the call is aborted when ctx is done.
+func (c *Client) GetApplicationWithContext(ctx context.Context, tag *ApplicationTag) (*Application, error) {
+	log.Debugf("get application[%s]......", tag.Tag())
+
+	rc, err := c.postTaskEvent(ctx, tag, c.impl.GetApplication, true)
+	if err != nil {
+		log.Warnf("get application[%s] error: %s", tag.Tag(), err.Error())
+		return nil, err
+	}
+
+	var ret *TaskResult
+	select {
+	case <-ctx.Done():
+		err := contextError(ctx)
+		log.Warnf("get application[%s] error: %s", tag.Tag(), err.Error())
+		return nil, err
+	case ret = <-rc:
+	}
+
+	if ret.Err != nil {
+		log.Warnf("get application[%s] error: %s", tag.Tag(), ret.Err.Error())
+		return nil, ret.Err
+	}
+
+	app, ok := ret.Out.(*Application)
+	if !ok {
+		log.Warnf("get application[%s] error: %s", tag.Tag(), ErrTaskResultInvalid.Error())
+		return nil, ErrTaskResultInvalid
+	}
+
+	log.Debugf("get application[%s] finished", tag.Tag())
+
+	return app, nil
+}
+
+// ListApplications lists the applications with the default TaskHandleTimeout.
 func (c *Client) ListApplications(opt *ListApplicationOption) ([]*ApplicationTag, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TaskHandleTimeout)
+	defer cancel()
+	return c.ListApplicationsWithContext(ctx, opt)
+}
+
+// ListApplicationsWithContext lists the applications, the call is aborted when ctx is done.
+func (c *Client) ListApplicationsWithContext(ctx context.Context, opt *ListApplicationOption) ([]*ApplicationTag, error) {
 	log.Debugf("list applications......")
 
-	rc, err := c.postTaskEvent(opt, c.impl.ListApplications, true)
+	rc, err := c.postTaskEvent(ctx, opt, c.impl.ListApplications, true)
 	if err != nil {
-		log.Warnf("list application error: %s", err.Error())
+		log.Warnf("list applications error: %s", err.Error())
+		return nil, err
 	}
 
 	var ret *TaskResult
 	select {
-	case <-time.After(TaskHandleTimeout):
-		log.Warnf("list applications timeout")
-		return nil, ErrTimeout
+	case <-ctx.Done():
+		err := contextError(ctx)
+		log.Warnf("list applications error: %s", err.Error())
+		return nil, err
 	case ret = <-rc:
 	}
 
@@ -241,19 +495,29 @@ func (c *Client) ListApplications(opt *ListApplicationOption) ([]*ApplicationTag
 	return out, nil
 }
 
+// GetApplicationStates gets the states of the applications with the default TaskHandleTimeout.
 func (c *Client) GetApplicationStates(tags []*ApplicationTag) ([]*ApplicationState, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TaskHandleTimeout)
+	defer cancel()
+	return c.GetApplicationStatesWithContext(ctx, tags)
+}
+
+// GetApplicationStatesWithContext gets the states of the applications, the call is aborted when ctx is done.
+func (c *Client) GetApplicationStatesWithContext(ctx context.Context, tags []*ApplicationTag) ([]*ApplicationState, error) {
 	log.Debugf("get application states......")
 
-	rc, err := c.postTaskEvent(tags, c.impl.GetApplicationStates, true)
+	rc, err := c.postTaskEvent(ctx, tags, c.impl.GetApplicationStates, true)
 	if err != nil {
 		log.Warnf("get application states error: %s", err.Error())
+		return nil, err
 	}
 
 	var ret *TaskResult
 	select {
-	case <-time.After(TaskHandleTimeout):
-		log.Warnf("get application states timeout")
-		return nil, ErrTimeout
+	case <-ctx.Done():
+		err := contextError(ctx)
+		log.Warnf("get application states error: %s", err.Error())
+		return nil, err
 	case ret = <-rc:
 	}
 
@@ -271,19 +535,303 @@ func (c *Client) GetApplicationStates(tags []*ApplicationTag) ([]*ApplicationSta
 	return out, nil
 }
 
+// GetApplicationLogs gets the logs of the application with the default TaskHandleTimeout.
+func (c *Client) GetApplicationLogs(tag *ApplicationTag, opt *LogOption) (io.ReadCloser, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TaskHandleTimeout)
+	defer cancel()
+	return c.GetApplicationLogsWithContext(ctx, tag, opt)
+}
+
+// GetApplicationLogsWithContext gets the logs of the application, the call is aborted
+// when ctx is done. A follow reader is not bound to ctx, it lasts until it is closed.
+func (c *Client) GetApplicationLogsWithContext(ctx context.Context, tag *ApplicationTag, opt *LogOption) (io.ReadCloser, error) {
+	log.Debugf("get application[%s] logs......", tag.Tag())
+
+	req := &LogRequest{
+		Tag:    tag,
+		Option: opt,
+	}
+	rc, err := c.postTaskEvent(ctx, req, c.impl.GetApplicationLogs, true)
+	if err != nil {
+		log.Warnf("get application[%s] logs error: %s", tag.Tag(), err.Error())
+		return nil, err
+	}
+
+	var ret *TaskResult
+	select {
+	case <-ctx.Done():
+		err := contextError(ctx)
+		log.Warnf("get application[%s] logs error: %s", tag.Tag(), err.Error())
+		return nil, err
+	case ret = <-rc:
+	}
+
+	if ret.Err != nil {
+		log.Warnf("get application[%s] logs error: %s", tag.Tag(), ret.Err.Error())
+		return nil, ret.Err
+	}
+
+	out, ok := ret.Out.(io.ReadCloser)
+	if !ok {
+		log.Warnf("get application[%s] logs error: %s", tag.Tag(), ErrTaskResultInvalid.Error())
+		return nil, ErrTaskResultInvalid
+	}
+
+	return out, nil
+}
+
+// PrefetchApplication fetches the artifacts of the application before it is
+// started with the default TaskHandleTimeout.
+func (c *Client) PrefetchApplication(tag *ApplicationTag) error {
+	ctx, cancel := context.WithTimeout(context.Background(), TaskHandleTimeout)
+	defer cancel()
+	return c.PrefetchApplicationWithContext(ctx, tag)
+}
+
+// PrefetchApplicationWithContext fetches the artifacts of the application and
+// waits until they are fetched or ctx is done. The fetch goes on in background
+// after ctx is done, the later start of the application waits for it, and the
+// removal of the application cancels it.
+func (c *Client) PrefetchApplicationWithContext(ctx context.Context, tag *ApplicationTag) error {
+	log.Debugf("prefetch application[%s]......", tag.Tag())
+
+	if len(tag.Name) == 0 || len(tag.Version) == 0 {
+		log.Warnf("prefetch application[%s] error: %s", tag.Tag(), ErrParamInvalid.Error())
+		return ErrParamInvalid
+	}
+
+	rc, err := c.postTaskEvent(ctx, tag, c.impl.PrefetchApplication, true)
+	if err != nil {
+		log.Warnf("prefetch application[%s] error: %s", tag.Tag(), err.Error())
+		return err
+	}
+
+	var ret *TaskResult
+	select {
+	case <-ctx.Done():
+		err := contextError(ctx)
+		log.Warnf("prefetch application[%s] error: %s", tag.Tag(), err.Error())
+		return err
+	case ret = <-rc:
+	}
+
+	if ret.Err != nil {
+		log.Warnf("prefetch application[%s] error: %s", tag.Tag(), ret.Err.Error())
+		return ret.Err
+	}
+
+	done, ok := ret.Out.(<-chan error)
+	if !ok {
+		log.Warnf("prefetch application[%s] error: %s", tag.Tag(), ErrTaskResultInvalid.Error())
+		return ErrTaskResultInvalid
+	}
+
+	select {
+	case <-ctx.Done():
+		err = contextError(ctx)
+	case err = <-done:
+	}
+	if err != nil {
+		log.Warnf("prefetch application[%s] error: %s", tag.Tag(), err.Error())
+		return err
+	}
+
+	log.Debugf("prefetch application[%s] finished", tag.Tag())
+
+	return nil
+}
+
+// UpgradeApplication upgrades the started application from a version to
+// another with the default TaskHandleTimeout.
+func (c *Client) UpgradeApplication(name, fromVersion, toVersion string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), TaskHandleTimeout)
+	defer cancel()
+	return c.UpgradeApplicationWithContext(ctx, name, fromVersion, toVersion)
+}
+
+// UpgradeApplicationWithContext upgrades the started application from a version
+// to another, and waits until the new version is ready. The upgrade is rolled
+// back to the old version if it fails or ctx is done before it is ready.
+func (c *Client) UpgradeApplicationWithContext(ctx context.Context, name, fromVersion, toVersion string) error {
+	req := &UpgradeRequest{
+		Name:        name,
+		FromVersion: fromVersion,
+		ToVersion:   toVersion,
+	}
+
+	log.Debugf("upgrade application[%s] from %s to %s......", name, fromVersion, toVersion)
+
+	if len(name) == 0 || len(fromVersion) == 0 || len(toVersion) == 0 || fromVersion == toVersion {
+		log.Warnf("upgrade application[%s] error: %s", name, ErrParamInvalid.Error())
+		return ErrParamInvalid
+	}
+
+	rc, err := c.postTaskEvent(ctx, req, c.impl.UpgradeApplication, true)
+	if err != nil {
+		log.Warnf("upgrade application[%s] error: %s", name, err.Error())
+		return err
+	}
+
+	var ret *TaskResult
+	select {
+	case <-ctx.Done():
+		err := contextError(ctx)
+		log.Warnf("upgrade application[%s] error: %s", name, err.Error())
+		return err
+	case ret = <-rc:
+	}
+
+	if ret.Err != nil {
+		log.Warnf("upgrade application[%s] error: %s", name, ret.Err.Error())
+		return ret.Err
+	}
+
+	done, ok := ret.Out.(<-chan error)
+	if !ok {
+		log.Warnf("upgrade application[%s] error: %s", name, ErrTaskResultInvalid.Error())
+		return ErrTaskResultInvalid
+	}
+
+	// the upgrade is rolled back in background if ctx is done
+	select {
+	case <-ctx.Done():
+		err = contextError(ctx)
+	case err = <-done:
+	}
+	if err != nil {
+		log.Warnf("upgrade application[%s] error: %s", name, err.Error())
+		return err
+	}
+
+	log.Debugf("upgrade application[%s] from %s to %s finished", name, fromVersion, toVersion)
+
+	return nil
+}
+
+// ScaleApplication changes the instance count of the application with the
+// default TaskHandleTimeout.
+func (c *Client) ScaleApplication(tag *ApplicationTag, replicas int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), TaskHandleTimeout)
+	defer cancel()
+	return c.ScaleApplicationWithContext(ctx, tag, replicas)
+}
+
+// ScaleApplicationWithContext changes the instance count of the application,
+// which is kept for the later starts. The started application is scaled in
+// place, the call is aborted when ctx is done.
+func (c *Client) ScaleApplicationWithContext(ctx context.Context, tag *ApplicationTag, replicas int) error {
+	log.Debugf("scale application[%s] to %d......", tag.Tag(), replicas)
+
+	if replicas < 1 {
+		log.Warnf("scale application[%s] error: %s", tag.Tag(), ErrParamInvalid.Error())
+		return ErrParamInvalid
+	}
+
+	req := &ScaleRequest{
+		Tag:      tag,
+		Replicas: replicas,
+	}
+	rc, err := c.postTaskEvent(ctx, req, c.impl.ScaleApplication, true)
+	if err != nil {
+		log.Warnf("scale application[%s] error: %s", tag.Tag(), err.Error())
+		return err
+	}
+
+	var ret *TaskResult
+	select {
+	case <-ctx.Done():
+		err := contextError(ctx)
+		log.Warnf("scale application[%s] error: %s", tag.Tag(), err.Error())
+		return err
+	case ret = <-rc:
+	}
+
+	if ret.Err != nil {
+		log.Warnf("scale application[%s] error: %s", tag.Tag(), ret.Err.Error())
+		return ret.Err
+	}
+
+	log.Infof("scale application[%s] to %d finished", tag.Tag(), replicas)
+
+	return nil
+}
+
+// CollectGarbage deletes the files of the removed applications and configs
+// with the default TaskHandleTimeout.
+func (c *Client) CollectGarbage() (*GCResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TaskHandleTimeout)
+	defer cancel()
+	return c.CollectGarbageWithContext(ctx)
+}
+
+// CollectGarbageWithContext deletes the files of the removed applications and
+// configs, and waits until they are deleted or ctx is done.
+func (c *Client) CollectGarbageWithContext(ctx context.Context) (*GCResult, error) {
+	log.Debugf("collect garbage......")
+
+	rc, err := c.postTaskEvent(ctx, nil, c.impl.CollectGarbage, true)
+	if err != nil {
+		log.Warnf("collect garbage error: %s", err.Error())
+		return nil, err
+	}
+
+	var ret *TaskResult
+	select {
+	case <-ctx.Done():
+		err := contextError(ctx)
+		log.Warnf("collect garbage error: %s", err.Error())
+		return nil, err
+	case ret = <-rc:
+	}
+
+	if ret.Err != nil {
+		log.Warnf("collect garbage error: %s", ret.Err.Error())
+		return nil, ret.Err
+	}
+
+	done, ok := ret.Out.(<-chan *GCResult)
+	if !ok {
+		log.Warnf("collect garbage error: %s", ErrTaskResultInvalid.Error())
+		return nil, ErrTaskResultInvalid
+	}
+
+	var out *GCResult
+	select {
+	case <-ctx.Done():
+		err := contextError(ctx)
+		log.Warnf("collect garbage error: %s", err.Error())
+		return nil, err
+	case out = <-done:
+	}
+
+	log.Debugf("collect garbage finished")
+
+	return out, nil
+}
+
+// CreateConfig creates the config with the default TaskHandleTimeout.
 func (c *Client) CreateConfig(config *Config) error {
+	ctx, cancel := context.WithTimeout(context.Background(), TaskHandleTimeout)
+	defer cancel()
+	return c.CreateConfigWithContext(ctx, config)
+}
+
+// CreateConfigWithContext creates the config, the call is aborted when ctx is done.
+func (c *Client) CreateConfigWithContext(ctx context.Context, config *Config) error {
 	log.Debugf("create config[%s]......", config.Name)
 
-	rc, err := c.postTaskEvent(config, c.impl.CreateConfig, true)
+	rc, err := c.postTaskEvent(ctx, config, c.impl.CreateConfig, true)
 	if err != nil {
 		log.Warnf("create config[%s] error: %s", config.Name, err.Error())
+		return err
 	}
 
 	var ret *TaskResult
 	select {
-	case <-time.After(TaskHandleTimeout):
-		log.Warnf("create config[%s] timeout", config.Name)
-		return ErrTimeout
+	case <-ctx.Done():
+		err := contextError(ctx)
+		log.Warnf("create config[%s] error: %s", config.Name, err.Error())
+		return err
 	case ret = <-rc:
 	}
 
@@ -297,19 +845,66 @@ func (c *Client) CreateConfig(config *Config) error {
 	return nil
 }
 
+// UpdateConfig updates the config with the default TaskHandleTimeout.
+func (c *Client) UpdateConfig(config *Config) error {
+	ctx, cancel := context.WithTimeout(context.Background(), TaskHandleTimeout)
+	defer cancel()
+	return c.UpdateConfigWithContext(ctx, config)
+}
+
+// UpdateConfigWithContext replaces the existed config in place, the call is
+// aborted when ctx is done.
+func (c *Client) UpdateConfigWithContext(ctx context.Context, config *Config) error {
+	log.Debugf("update config[%s]......", config.Name)
+
+	rc, err := c.postTaskEvent(ctx, config, c.impl.UpdateConfig, true)
+	if err != nil {
+		log.Warnf("update config[%s] error: %s", config.Name, err.Error())
+		return err
+	}
+
+	var ret *TaskResult
+	select {
+	case <-ctx.Done():
+		err := contextError(ctx)
+		log.Warnf("update config[%s] error: %s", config.Name, err.Error())
+		return err
+	case ret = <-rc:
+	}
+
+	if ret.Err != nil {
+		log.Warnf("update config[%s] error: %s", config.Name, ret.Err.Error())
+		return ret.Err
+	}
+
+	log.Infof("update config[%s] finished", config.Name)
+
+	return nil
+}
+
+// RemoveConfig removes the config with the default TaskHandleTimeout.
 func (c *Client) RemoveConfig(name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), TaskHandleTimeout)
+	defer cancel()
+	return c.RemoveConfigWithContext(ctx, name)
+}
+
+// RemoveConfigWithContext removes the config, the call is aborted when ctx is done.
+func (c *Client) RemoveConfigWithContext(ctx context.Context, name string) error {
 	log.Debugf("remove config[%s]......", name)
 
-	rc, err := c.postTaskEvent(name, c.impl.RemoveConfig, true)
+	rc, err := c.postTaskEvent(ctx, name, c.impl.RemoveConfig, true)
 	if err != nil {
 		log.Warnf("remove config[%s] error: %s", name, err.Error())
+		return err
 	}
 
 	var ret *TaskResult
 	select {
-	case <-time.After(TaskHandleTimeout):
-		log.Warnf("remove config[%s] timeout", name)
-		return ErrTimeout
+	case <-ctx.Done():
+		err := contextError(ctx)
+		log.Warnf("remove config[%s] error: %s", name, err.Error())
+		return err
 	case ret = <-rc:
 	}
 
@@ -322,3 +917,52 @@ func (c *Client) RemoveConfig(name string) error {
 
 	return nil
 }
+
+// ListConfigs lists the configs with the default TaskHandleTimeout.
+func (c *Client) ListConfigs() ([]*Config, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TaskHandleTimeout)
+	defer cancel()
+	return c.ListConfigsWithContext(ctx)
+}
+
+// ListConfigsWithContext lists the configs, the call is aborted when ctx is done.
+func (c *Client) ListConfigsWithContext(ctx context.Context) ([]*Config, error) {
+	log.Debugf("list configs......")
+
+	rc, err := c.postTaskEvent(ctx, nil, c.impl.ListConfigs, true)
+	if err != nil {
+		log.Warnf("list configs error: %s", err.Error())
+		return nil, err
+	}
+
+	var ret *TaskResult
+	select {
+	case <-ctx.Done():
+		err := contextError(ctx)
+		log.Warnf("list configs error: %s", err.Error())
+		return nil, err
+	case ret = <-rc:
+	}
+
+	if ret.Err != nil {
+		log.Warnf("list configs error: %s", ret.Err.Error())
+		return nil, ret.Err
+	}
+
+	configs, ok := ret.Out.([]*Config)
+	if !ok {
+		log.Warnf("list configs error: %s", ErrTaskResultInvalid.Error())
+		return nil, ErrTaskResultInvalid
+	}
+
+	log.Debugf("list configs finished")
+
+	return configs, nil
+}
+
+func contextError(ctx context.Context) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return ErrTimeout
+	}
+	return ctx.Err()
+}
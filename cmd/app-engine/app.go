@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	engine "github.com/jimi36/app-engine"
+)
+
+const actionRestart engine.ApplyActionType = "restart"
+
+var appCommands = []*command{
+	{name: "create", args: "-f FILE", usage: "create the applications of the manifest file", run: createApplications},
+	{name: "remove", args: "NAME VERSION", usage: "stop and remove the application", run: tagAction(engine.ApplyRemove)},
+	{name: "start", args: "NAME VERSION", usage: "start the application", run: tagAction(engine.ApplyStart)},
+	{name: "stop", args: "NAME VERSION", usage: "stop the application", run: tagAction(engine.ApplyStop)},
+	{name: "restart", args: "NAME VERSION", usage: "stop the application and start it again", run: tagAction(actionRestart)},
+	{name: "list", args: "", usage: "list the applications", run: listApplications},
+	{name: "status", args: "[NAME [VERSION]]", usage: "show the states of the applications", run: showApplicationStates},
+	{name: "logs", args: "[-tail N] [-since D] [-f] [-stderr] [-instance I] NAME VERSION", usage: "print the logs of the application", run: printApplicationLogs},
+}
+
+var errUsage = errors.New("invalid arguments, see -h")
+
+func parseTag(args []string) (*engine.ApplicationTag, error) {
+	if len(args) != 2 {
+		return nil, errUsage
+	}
+	return &engine.ApplicationTag{Name: args[0], Version: args[1]}, nil
+}
+
+func createApplications(cc *cmdContext, args []string) error {
+	fs := newFlagSet("app", "create")
+	file := fs.String("f", "", "manifest file or folder")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(*file) == 0 || fs.NArg() > 0 {
+		return errUsage
+	}
+
+	manifest, err := engine.LoadManifest(*file)
+	if err != nil {
+		return err
+	}
+	// the create doesn't apply the desired state of the manifest
+	if len(manifest.Configs) > 0 {
+		return errors.New("configs are not created by app create, remove them from the manifest")
+	}
+	for _, app := range manifest.Applications {
+		if app.Running {
+			return fmt.Errorf("application %s is not started by app create, remove running from the manifest", app.Tag())
+		}
+	}
+
+	ctx, cancel := cc.context()
+	defer cancel()
+	for _, app := range manifest.Applications {
+		if err := cc.backend.CreateApplication(ctx, &app.Application); err != nil {
+			return err
+		}
+		err := cc.printer.action(&engine.ApplyResult{
+			Kind:    engine.ApplyApplication,
+			Name:    app.Name,
+			Version: app.Version,
+			Action:  engine.ApplyCreate,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// tagAction returns the command running the action on the application.
+func tagAction(action engine.ApplyActionType) func(*cmdContext, []string) error {
+	return func(cc *cmdContext, args []string) error {
+		tag, err := parseTag(args)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := cc.context()
+		defer cancel()
+		switch action {
+		case engine.ApplyRemove:
+			err = cc.backend.RemoveApplication(ctx, tag)
+		case engine.ApplyStart:
+			err = cc.backend.StartApplication(ctx, tag)
+		case engine.ApplyStop:
+			err = cc.backend.StopApplication(ctx, tag)
+		case actionRestart:
+			err = cc.backend.RestartApplication(ctx, tag)
+		}
+		if err != nil {
+			return err
+		}
+
+		return cc.printer.action(&engine.ApplyResult{
+			Kind:    engine.ApplyApplication,
+			Name:    tag.Name,
+			Version: tag.Version,
+			Action:  action,
+		})
+	}
+}
+
+func listApplications(cc *cmdContext, args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+
+	ctx, cancel := cc.context()
+	defer cancel()
+	tags, err := cc.backend.ListApplications(ctx)
+	if err != nil {
+		return err
+	}
+
+	var states []*engine.ApplicationState
+	if len(tags) > 0 && cc.printer.format == outputTable {
+		if states, err = cc.backend.GetApplicationStates(ctx, tags); err != nil {
+			return err
+		}
+	}
+
+	return cc.printer.applications(tags, states)
+}
+
+func showApplicationStates(cc *cmdContext, args []string) error {
+	if len(args) > 2 {
+		return errUsage
+	}
+
+	ctx, cancel := cc.context()
+	defer cancel()
+
+	var tags []*engine.ApplicationTag
+	if len(args) == 2 {
+		tags = append(tags, &engine.ApplicationTag{Name: args[0], Version: args[1]})
+	} else {
+		all, err := cc.backend.ListApplications(ctx)
+		if err != nil {
+			return err
+		}
+		for _, tag := range all {
+			if len(args) == 0 || tag.Name == args[0] {
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	var states []*engine.ApplicationState
+	if len(tags) > 0 {
+		var err error
+		if states, err = cc.backend.GetApplicationStates(ctx, tags); err != nil {
+			return err
+		}
+	}
+
+	return cc.printer.states(states)
+}
+
+func printApplicationLogs(cc *cmdContext, args []string) error {
+	fs := newFlagSet("app", "logs")
+	opt := &engine.LogOption{}
+	fs.IntVar(&opt.TailLines, "tail", 0, "last lines to print, all lines if 0")
+	since := fs.Duration("since", 0, "print the logs newer than the duration")
+	fs.BoolVar(&opt.Follow, "f", false, "follow the logs")
+	fs.BoolVar(&opt.Stderr, "stderr", false, "print the stderr logs if they are split")
+	fs.StringVar(&opt.Instance, "instance", "", "instance index of the application")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	tag, err := parseTag(fs.Args())
+	if err != nil {
+		return err
+	}
+	if *since > 0 {
+		opt.Since = time.Now().Add(-*since)
+	}
+
+	// the followed logs last until interrupted
+	ctx, cancel := cc.context()
+	if opt.Follow {
+		cancel()
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
+
+	rc, err := cc.backend.GetApplicationLogs(ctx, tag, opt)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+	go func() {
+		<-sigCh
+		cancel()
+		rc.Close()
+	}()
+
+	if _, err := io.Copy(os.Stdout, rc); err != nil && ctx.Err() == nil {
+		return err
+	}
+
+	return nil
+}
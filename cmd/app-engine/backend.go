@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"time"
+
+	engine "github.com/jimi36/app-engine"
+	"github.com/jimi36/app-engine/kube"
+	"github.com/jimi36/app-engine/native"
+)
+
+// backend is the engine operated by the commands, which is the in-process
+// engine client or the daemon.
+type backend interface {
+	CreateApplication(ctx context.Context, app *engine.Application) error
+	RemoveApplication(ctx context.Context, tag *engine.ApplicationTag) error
+	StartApplication(ctx context.Context, tag *engine.ApplicationTag) error
+	StopApplication(ctx context.Context, tag *engine.ApplicationTag) error
+	RestartApplication(ctx context.Context, tag *engine.ApplicationTag) error
+	ListApplications(ctx context.Context) ([]*engine.ApplicationTag, error)
+	GetApplicationStates(ctx context.Context, tags []*engine.ApplicationTag) ([]*engine.ApplicationState, error)
+	GetApplicationLogs(ctx context.Context, tag *engine.ApplicationTag, opt *engine.LogOption) (io.ReadCloser, error)
+
+	CreateConfig(ctx context.Context, config *engine.Config) error
+	RemoveConfig(ctx context.Context, name string) error
+	ListConfigs(ctx context.Context) ([]*engine.Config, error)
+
+	Close() error
+}
+
+type engineOption struct {
+	typ        string
+	basePath   string
+	kubeConfig string
+	namespace  string
+	inCluster  bool
+}
+
+// newEngineClient creates the engine client of the backend type.
+func newEngineClient(opt *engineOption) (*engine.Client, error) {
+	var impl engine.ClientImpl
+	var err error
+	switch engine.EngineType(opt.typ) {
+	case engine.Native:
+		var opts []engine.Option
+		if len(opt.basePath) > 0 {
+			opts = append(opts, native.BasePath(opt.basePath))
+		}
+		impl, err = native.NewClient(opts...)
+	case engine.Kube:
+		var opts []engine.Option
+		if len(opt.basePath) > 0 {
+			opts = append(opts, kube.BasePath(opt.basePath))
+		}
+		if len(opt.kubeConfig) > 0 {
+			opts = append(opts, kube.KubeConfPath(opt.kubeConfig))
+		}
+		if len(opt.namespace) > 0 {
+			opts = append(opts, kube.KubeNamespace(opt.namespace))
+		}
+		opts = append(opts, kube.InKubeCluster(opt.inCluster))
+		impl, err = kube.NewClient(opts...)
+	default:
+		return nil, engine.ErrOptionInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return engine.NewClient(impl), nil
+}
+
+// settleInterval is the interval to check the starting applications
+const settleInterval = time.Millisecond * 200
+
+// localBackend runs the engine in the process, the started applications are
+// kept running after the command exits.
+type localBackend struct {
+	cli *engine.Client
+}
+
+// newLocalBackend starts the engine client, only the applications started
+// or restarted by the command are waited for.
+func newLocalBackend(opt *engineOption) (*localBackend, error) {
+	cli, err := newEngineClient(opt)
+	if err != nil {
+		return nil, err
+	}
+	if err := cli.Start(); err != nil {
+		return nil, err
+	}
+	return &localBackend{cli: cli}, nil
+}
+
+// waitStarted waits for the starting applications to be running or failed,
+// and returns the error of the failed one.
+func (b *localBackend) waitStarted(ctx context.Context, tags []*engine.ApplicationTag) error {
+	for {
+		states, err := b.cli.GetApplicationStatesWithContext(ctx, tags)
+		if err != nil {
+			return err
+		}
+
+		starting := false
+		for _, state := range states {
+			if !state.ToStart || state.IsStarted {
+				continue
+			}
+			if len(state.Err) > 0 {
+				return errors.New(state.Err)
+			}
+			starting = true
+		}
+		if !starting {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(settleInterval):
+		}
+	}
+}
+
+func (b *localBackend) CreateApplication(ctx context.Context, app *engine.Application) error {
+	return b.cli.CreateApplicationWithContext(ctx, app)
+}
+
+func (b *localBackend) RemoveApplication(ctx context.Context, tag *engine.ApplicationTag) error {
+	return b.cli.RemoveApplicationWithContext(ctx, tag)
+}
+
+func (b *localBackend) StartApplication(ctx context.Context, tag *engine.ApplicationTag) error {
+	if err := b.cli.StartApplicationWithContext(ctx, tag); err != nil {
+		return err
+	}
+	return b.waitStarted(ctx, []*engine.ApplicationTag{tag})
+}
+
+func (b *localBackend) StopApplication(ctx context.Context, tag *engine.ApplicationTag) error {
+	return b.cli.StopApplicationWithContext(ctx, tag)
+}
+
+func (b *localBackend) RestartApplication(ctx context.Context, tag *engine.ApplicationTag) error {
+	if err := restartApplication(ctx, b.cli, tag); err != nil {
+		return err
+	}
+	return b.waitStarted(ctx, []*engine.ApplicationTag{tag})
+}
+
+func (b *localBackend) ListApplications(ctx context.Context) ([]*engine.ApplicationTag, error) {
+	return b.cli.ListApplicationsWithContext(ctx, &engine.ListApplicationOption{Size: math.MaxInt32})
+}
+
+func (b *localBackend) GetApplicationStates(ctx context.Context, tags []*engine.ApplicationTag) ([]*engine.ApplicationState, error) {
+	return b.cli.GetApplicationStatesWithContext(ctx, tags)
+}
+
+func (b *localBackend) GetApplicationLogs(ctx context.Context, tag *engine.ApplicationTag, opt *engine.LogOption) (io.ReadCloser, error) {
+	return b.cli.GetApplicationLogsWithContext(ctx, tag, opt)
+}
+
+func (b *localBackend) CreateConfig(ctx context.Context, config *engine.Config) error {
+	return b.cli.CreateConfigWithContext(ctx, config)
+}
+
+func (b *localBackend) RemoveConfig(ctx context.Context, name string) error {
+	return b.cli.RemoveConfigWithContext(ctx, name)
+}
+
+func (b *localBackend) ListConfigs(ctx context.Context) ([]*engine.Config, error) {
+	return b.cli.ListConfigsWithContext(ctx)
+}
+
+func (b *localBackend) Close() error {
+	return b.cli.Stop(&engine.StopOption{KeepApplications: true})
+}
+
+// restartApplication stops the application if it's started, and starts it again.
+func restartApplication(ctx context.Context, cli *engine.Client, tag *engine.ApplicationTag) error {
+	err := cli.StopApplicationWithContext(ctx, tag)
+	if err != nil && !errors.Is(err, engine.ErrApplicationNotStarted) {
+		return err
+	}
+	return cli.StartApplicationWithContext(ctx, tag)
+}
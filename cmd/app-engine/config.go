@@ -0,0 +1,114 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+
+	engine "github.com/jimi36/app-engine"
+)
+
+var configCommands = []*command{
+	{name: "create", args: "-f FILE | NAME [KEY=VALUE | KEY=@FILE ...]", usage: "create the configs of the manifest file, or the config of the data", run: createConfigs},
+	{name: "remove", args: "NAME", usage: "remove the config", run: removeConfig},
+	{name: "list", args: "", usage: "list the configs", run: listConfigs},
+}
+
+func createConfigs(cc *cmdContext, args []string) error {
+	fs := newFlagSet("config", "create")
+	file := fs.String("f", "", "manifest file or folder")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var configs []*engine.Config
+	switch {
+	case len(*file) > 0 && fs.NArg() == 0:
+		manifest, err := engine.LoadManifest(*file)
+		if err != nil {
+			return err
+		}
+		configs = manifest.Configs
+	case len(*file) == 0 && fs.NArg() > 0:
+		config, err := parseConfig(fs.Args())
+		if err != nil {
+			return err
+		}
+		configs = append(configs, config)
+	default:
+		return errUsage
+	}
+
+	ctx, cancel := cc.context()
+	defer cancel()
+	for _, config := range configs {
+		if err := cc.backend.CreateConfig(ctx, config); err != nil {
+			return err
+		}
+		err := cc.printer.action(&engine.ApplyResult{
+			Kind:   engine.ApplyConfig,
+			Name:   config.Name,
+			Action: engine.ApplyCreate,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseConfig parses the config name and data, the value of KEY=@FILE is read from the file.
+func parseConfig(args []string) (*engine.Config, error) {
+	config := &engine.Config{
+		Name: args[0],
+		Data: make(map[string]string),
+	}
+	for _, arg := range args[1:] {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 || len(kv[0]) == 0 {
+			return nil, errUsage
+		}
+		if strings.HasPrefix(kv[1], "@") {
+			data, err := ioutil.ReadFile(kv[1][1:])
+			if err != nil {
+				return nil, err
+			}
+			kv[1] = string(data)
+		}
+		config.Data[kv[0]] = kv[1]
+	}
+	return config, nil
+}
+
+func removeConfig(cc *cmdContext, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	ctx, cancel := cc.context()
+	defer cancel()
+	if err := cc.backend.RemoveConfig(ctx, args[0]); err != nil {
+		return err
+	}
+
+	return cc.printer.action(&engine.ApplyResult{
+		Kind:   engine.ApplyConfig,
+		Name:   args[0],
+		Action: engine.ApplyRemove,
+	})
+}
+
+func listConfigs(cc *cmdContext, args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+
+	ctx, cancel := cc.context()
+	defer cancel()
+	configs, err := cc.backend.ListConfigs(ctx)
+	if err != nil {
+		return err
+	}
+
+	return cc.printer.configs(configs)
+}
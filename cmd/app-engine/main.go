@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	engine "github.com/jimi36/app-engine"
+	"github.com/jimi36/app-engine/log"
+)
+
+// DaemonEnv is the environment variable of the default daemon address.
+const DaemonEnv = "APP_ENGINE_DAEMON"
+
+type command struct {
+	name  string
+	args  string
+	usage string
+	run   func(cc *cmdContext, args []string) error
+}
+
+// cmdContext is shared by the commands.
+type cmdContext struct {
+	backend backend
+	printer *printer
+	timeout time.Duration
+}
+
+// context returns the context of the backend calls.
+func (cc *cmdContext) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), cc.timeout)
+}
+
+var groups = map[string][]*command{
+	"app":    appCommands,
+	"config": configCommands,
+}
+
+func main() {
+	opt := &engineOption{}
+	flag.StringVar(&opt.typ, "engine", string(engine.Native), "in-process engine type, native or kube")
+	flag.StringVar(&opt.basePath, "base-path", "", "base path of the in-process engine")
+	flag.StringVar(&opt.kubeConfig, "kubeconfig", "", "kube config path of the kube engine")
+	flag.StringVar(&opt.namespace, "namespace", "", "namespace of the kube engine")
+	flag.BoolVar(&opt.inCluster, "in-cluster", false, "use the in-cluster config of the kube engine")
+	daemon := flag.String("daemon", os.Getenv(DaemonEnv), "daemon address, http://host:port or unix:///path, the in-process engine is used if empty")
+	output := flag.String("o", outputTable, "output format, table or json")
+	level := flag.String("log-level", "error", "log level of the in-process engine")
+	timeout := flag.Duration("timeout", engine.TaskHandleTimeout, "timeout of the engine calls")
+	flag.Usage = usage
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd := findCommand(args[0], args[1])
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command: %s %s\n", args[0], args[1])
+		usage()
+		os.Exit(2)
+	}
+	if *output != outputTable && *output != outputJson {
+		fmt.Fprintf(os.Stderr, "unknown output format: %s\n", *output)
+		os.Exit(2)
+	}
+	if err := log.SetLevel(*level); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid log level: %s\n", err.Error())
+		os.Exit(2)
+	}
+
+	var b backend
+	var err error
+	if len(*daemon) > 0 {
+		b, err = newRemoteBackend(*daemon)
+	} else {
+		b, err = newLocalBackend(opt)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	cc := &cmdContext{
+		backend: b,
+		printer: &printer{format: *output, out: os.Stdout},
+		timeout: *timeout,
+	}
+	err = cmd.run(cc, args[2:])
+	if cerr := b.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+func findCommand(group, name string) *command {
+	for _, cmd := range groups[group] {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: app-engine [flags] <command> [args]\n\nCommands:\n")
+	for _, group := range []string{"app", "config"} {
+		for _, cmd := range groups[group] {
+			fmt.Fprintf(out, "  %-40s %s\n", group+" "+cmd.name+" "+cmd.args, cmd.usage)
+		}
+	}
+	fmt.Fprintf(out, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// newFlagSet returns the flag set of the command.
+func newFlagSet(group string, cmd string) *flag.FlagSet {
+	return flag.NewFlagSet(group+" "+cmd, flag.ContinueOnError)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	engine "github.com/jimi36/app-engine"
+)
+
+const (
+	outputTable = "table"
+	outputJson  = "json"
+)
+
+// printer prints the results in the table or json format.
+type printer struct {
+	format string
+	out    io.Writer
+}
+
+func (p *printer) json(v interface{}) error {
+	enc := json.NewEncoder(p.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (p *printer) table(header []string, rows [][]string) error {
+	w := tabwriter.NewWriter(p.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// action prints the result of the action on the object.
+func (p *printer) action(ret *engine.ApplyResult) error {
+	if p.format == outputJson {
+		return p.json(ret)
+	}
+	name := ret.Name
+	if len(ret.Version) > 0 {
+		name += " " + ret.Version
+	}
+	_, err := fmt.Fprintf(p.out, "%s %s %s\n", ret.Kind, name, actionDone(ret.Action))
+	return err
+}
+
+func (p *printer) applications(tags []*engine.ApplicationTag, states []*engine.ApplicationState) error {
+	if p.format == outputJson {
+		return p.json(tags)
+	}
+	started := make(map[string]string)
+	for _, state := range states {
+		started[(&engine.ApplicationTag{Name: state.Name, Version: state.Version}).Tag()] = stateOf(state)
+	}
+	rows := make([][]string, 0, len(tags))
+	for _, tag := range tags {
+		rows = append(rows, []string{tag.Name, tag.Version, started[tag.Tag()]})
+	}
+	return p.table([]string{"NAME", "VERSION", "STATE"}, rows)
+}
+
+func (p *printer) states(states []*engine.ApplicationState) error {
+	if p.format == outputJson {
+		return p.json(states)
+	}
+	rows := make([][]string, 0, len(states))
+	for _, state := range states {
+		var pids []string
+		for _, ins := range state.Instances {
+			if ins.Running {
+				pids = append(pids, strconv.Itoa(ins.Pid))
+			}
+		}
+		rows = append(rows, []string{
+			state.Name,
+			state.Version,
+			stateOf(state),
+			strings.Join(pids, ","),
+			strconv.Itoa(state.RestartCount),
+			age(state.StartTime),
+			state.Err,
+		})
+	}
+	return p.table([]string{"NAME", "VERSION", "STATE", "PIDS", "RESTARTS", "AGE", "ERROR"}, rows)
+}
+
+func (p *printer) configs(configs []*engine.Config) error {
+	if p.format == outputJson {
+		return p.json(configs)
+	}
+	rows := make([][]string, 0, len(configs))
+	for _, config := range configs {
+		var keys []string
+		for k := range config.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var labels []string
+		for k, v := range config.Labels {
+			labels = append(labels, k+"="+v)
+		}
+		sort.Strings(labels)
+		rows = append(rows, []string{config.Name, strings.Join(keys, ","), strings.Join(labels, ",")})
+	}
+	return p.table([]string{"NAME", "KEYS", "LABELS"}, rows)
+}
+
+func stateOf(state *engine.ApplicationState) string {
+	switch {
+	case state.IsStarted:
+		return "running"
+	case state.ToStart && len(state.Err) > 0:
+		return "failed"
+	case state.ToStart:
+		return "starting"
+	default:
+		return "stopped"
+	}
+}
+
+func age(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return time.Since(t).Round(time.Second).String()
+}
+
+func actionDone(action engine.ApplyActionType) string {
+	switch action {
+	case engine.ApplyStop:
+		return "stopped"
+	case engine.ApplyCreate, engine.ApplyUpdate, engine.ApplyRemove:
+		return string(action) + "d"
+	default:
+		return string(action) + "ed"
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	engine "github.com/jimi36/app-engine"
+	"github.com/jimi36/app-engine/server"
+)
+
+// remoteBackend operates the engine of the daemon.
+type remoteBackend struct {
+	base string
+	hc   *http.Client
+}
+
+// newRemoteBackend connects the daemon at the address, which is a url or a
+// unix socket path like unix:///run/app-engine.sock.
+func newRemoteBackend(addr string) (*remoteBackend, error) {
+	b := &remoteBackend{
+		base: strings.TrimSuffix(addr, "/"),
+		hc:   &http.Client{},
+	}
+
+	switch {
+	case strings.HasPrefix(addr, "unix://"):
+		sock := strings.TrimPrefix(addr, "unix://")
+		b.base = "http://unix"
+		b.hc.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", sock)
+			},
+		}
+	case strings.HasPrefix(addr, "http://"), strings.HasPrefix(addr, "https://"):
+	case len(addr) > 0:
+		b.base = "http://" + b.base
+	default:
+		return nil, engine.ErrOptionInvalid
+	}
+
+	return b, nil
+}
+
+// do sends the request with the json body, and decodes the json response into out.
+func (b *remoteBackend) do(ctx context.Context, method, path string, in, out interface{}) error {
+	resp, err := b.send(ctx, method, path, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// send sends the request, the response body should be closed if no error.
+func (b *remoteBackend) send(ctx context.Context, method, path string, in interface{}) (*http.Response, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, b.base+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := b.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(resp.Body)
+		se := &server.Error{}
+		if err := json.Unmarshal(data, se); err != nil || len(se.Message) == 0 {
+			return nil, fmt.Errorf("daemon error: %s", resp.Status)
+		}
+		return nil, se
+	}
+
+	return resp, nil
+}
+
+func (b *remoteBackend) CreateApplication(ctx context.Context, app *engine.Application) error {
+	return b.do(ctx, http.MethodPost, server.PathApplications, app, nil)
+}
+
+func (b *remoteBackend) RemoveApplication(ctx context.Context, tag *engine.ApplicationTag) error {
+	return b.do(ctx, http.MethodDelete, server.ApplicationPath(tag, ""), nil, nil)
+}
+
+func (b *remoteBackend) StartApplication(ctx context.Context, tag *engine.ApplicationTag) error {
+	return b.do(ctx, http.MethodPost, server.ApplicationPath(tag, "start"), nil, nil)
+}
+
+func (b *remoteBackend) StopApplication(ctx context.Context, tag *engine.ApplicationTag) error {
+	return b.do(ctx, http.MethodPost, server.ApplicationPath(tag, "stop"), nil, nil)
+}
+
+func (b *remoteBackend) RestartApplication(ctx context.Context, tag *engine.ApplicationTag) error {
+	return b.do(ctx, http.MethodPost, server.ApplicationPath(tag, "restart"), nil, nil)
+}
+
+func (b *remoteBackend) ListApplications(ctx context.Context) ([]*engine.ApplicationTag, error) {
+	var tags []*engine.ApplicationTag
+	if err := b.do(ctx, http.MethodGet, server.PathApplications, nil, &tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+func (b *remoteBackend) GetApplicationStates(ctx context.Context, tags []*engine.ApplicationTag) ([]*engine.ApplicationState, error) {
+	var states []*engine.ApplicationState
+	if err := b.do(ctx, http.MethodPost, server.PathStates, tags, &states); err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+func (b *remoteBackend) GetApplicationLogs(ctx context.Context, tag *engine.ApplicationTag, opt *engine.LogOption) (io.ReadCloser, error) {
+	q := url.Values{}
+	if opt.TailLines > 0 {
+		q.Set("tailLines", strconv.Itoa(opt.TailLines))
+	}
+	if !opt.Since.IsZero() {
+		q.Set("since", opt.Since.Format(time.RFC3339))
+	}
+	if opt.Follow {
+		q.Set("follow", "true")
+	}
+	if opt.Stderr {
+		q.Set("stderr", "true")
+	}
+	if len(opt.Instance) > 0 {
+		q.Set("instance", opt.Instance)
+	}
+
+	path := server.ApplicationPath(tag, "logs")
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	resp, err := b.send(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (b *remoteBackend) CreateConfig(ctx context.Context, config *engine.Config) error {
+	return b.do(ctx, http.MethodPost, server.PathConfigs, config, nil)
+}
+
+func (b *remoteBackend) RemoveConfig(ctx context.Context, name string) error {
+	return b.do(ctx, http.MethodDelete, server.ConfigPath(name), nil, nil)
+}
+
+func (b *remoteBackend) ListConfigs(ctx context.Context) ([]*engine.Config, error) {
+	var configs []*engine.Config
+	if err := b.do(ctx, http.MethodGet, server.PathConfigs, nil, &configs); err != nil {
+		return nil, err
+	}
+	return configs, nil
+}
+
+func (b *remoteBackend) Close() error {
+	return nil
+}
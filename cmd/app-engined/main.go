@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	engine "github.com/jimi36/app-engine"
+	"github.com/jimi36/app-engine/kube"
+	"github.com/jimi36/app-engine/log"
+	"github.com/jimi36/app-engine/native"
+	"github.com/jimi36/app-engine/server"
+)
+
+// shutdownTimeout is the deadline of the requests in flight when the daemon exits
+const shutdownTimeout = time.Second * 10
+
+func main() {
+	typ := flag.String("engine", string(engine.Native), "engine type, native or kube")
+	basePath := flag.String("base-path", "", "base path of the engine")
+	kubeConfig := flag.String("kubeconfig", "", "kube config path of the kube engine")
+	namespace := flag.String("namespace", "", "namespace of the kube engine")
+	inCluster := flag.Bool("in-cluster", false, "use the in-cluster config of the kube engine")
+	listen := flag.String("listen", server.DefaultAddress, "listen address, unix:///path or host:port")
+	insecure := flag.Bool("insecure", false, "allow listening on the tcp address out of the loopback interface, the api has no authentication")
+	manifestDir := flag.String("manifest-dir", "", "apply the manifest files of the folder, such as "+engine.DefaultManifestDir)
+	reconcile := flag.Duration("reconcile-interval", 0, "interval of the periodic reconciliation, disabled if 0")
+	keep := flag.Bool("keep-applications", false, "keep the applications running when the daemon exits")
+	level := flag.String("log-level", "info", "log level")
+	flag.Parse()
+
+	if err := log.SetLevel(*level); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid log level: %s\n", err.Error())
+		os.Exit(2)
+	}
+
+	var impl engine.ClientImpl
+	var err error
+	switch engine.EngineType(*typ) {
+	case engine.Native:
+		var opts []engine.Option
+		if len(*basePath) > 0 {
+			opts = append(opts, native.BasePath(*basePath))
+		}
+		impl, err = native.NewClient(opts...)
+	case engine.Kube:
+		opts := []engine.Option{kube.InKubeCluster(*inCluster)}
+		if len(*basePath) > 0 {
+			opts = append(opts, kube.BasePath(*basePath))
+		}
+		if len(*kubeConfig) > 0 {
+			opts = append(opts, kube.KubeConfPath(*kubeConfig))
+		}
+		if len(*namespace) > 0 {
+			opts = append(opts, kube.KubeNamespace(*namespace))
+		}
+		impl, err = kube.NewClient(opts...)
+	default:
+		err = engine.ErrOptionInvalid
+	}
+	if err != nil {
+		log.Errorf("create %s engine error: %s", *typ, err.Error())
+		os.Exit(1)
+	}
+
+	cli := engine.NewClient(impl, engine.ReconcileInterval(*reconcile))
+	if err := cli.Start(); err != nil {
+		log.Errorf("start engine error: %s", err.Error())
+		os.Exit(1)
+	}
+
+	if len(*manifestDir) > 0 {
+		if _, err := cli.WatchManifestDir(&engine.ManifestDirOption{Dir: *manifestDir}); err != nil {
+			log.Errorf("watch manifest folder[%s] error: %s", *manifestDir, err.Error())
+			cli.Stop(&engine.StopOption{KeepApplications: *keep})
+			os.Exit(1)
+		}
+	}
+
+	l, err := server.Listen(*listen, *insecure)
+	if err != nil {
+		log.Errorf("listen %s error: %s", *listen, err.Error())
+		cli.Stop(&engine.StopOption{KeepApplications: *keep})
+		os.Exit(1)
+	}
+	srv := &http.Server{Handler: server.New(cli)}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(l)
+	}()
+	log.Infof("daemon is listening on %s", *listen)
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+
+	code := 0
+	select {
+	case sig := <-sigCh:
+		log.Infof("daemon received signal %s", sig.String())
+	case err := <-errCh:
+		log.Errorf("serve %s error: %s", *listen, err.Error())
+		code = 1
+	}
+
+	// the event streams and followed logs are closed at the shutdown deadline
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	if err := srv.Shutdown(ctx); err != nil {
+		srv.Close()
+	}
+	cancel()
+	if err := cli.Stop(&engine.StopOption{KeepApplications: *keep}); err != nil {
+		code = 1
+	}
+
+	os.Exit(code)
+}
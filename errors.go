@@ -8,10 +8,13 @@ var (
 	ErrOptionInvalid         = errors.New("option invalid")
 	ErrParamInvalid          = errors.New("param invalid")
 	ErrClientNotStarted      = errors.New("cleint is not started")
+	ErrClientStarted         = errors.New("client is already started")
 	ErrApplicationExisted    = errors.New("application is existed")
 	ErrApplicationNoExisted  = errors.New("application is not existed")
 	ErrApplicationStarted    = errors.New("application is started")
 	ErrApplicationNotStarted = errors.New("application is not started")
+	ErrApplicationUpgrading  = errors.New("application is upgrading")
+	ErrNoKnownGoodVersion    = errors.New("no known good version")
 	ErrConfigExisted         = errors.New("config is existed")
 	ErrConfigNoExisted       = errors.New("config is not existed")
 
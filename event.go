@@ -1,19 +1,53 @@
 package engine
 
+import (
+	"context"
+)
+
 func (cli *Client) appEventLoop() {
+	defer close(cli.loopDone)
+
 	for {
 		select {
 		case ev := <-cli.eventCh:
-			ret := ev.Handler(ev)
-			if ev.Rc != nil {
-				ev.Rc <- ret
+			cli.handleTaskEvent(ev)
+		case <-cli.quit:
+			// drain the pending task events, new ones are already rejected
+			for {
+				select {
+				case ev := <-cli.eventCh:
+					if err := cli.stopCtx.Err(); err != nil {
+						// the stop deadline is exceeded, fail the left ones
+						if ev.Rc != nil {
+							ev.Rc <- &TaskResult{Err: contextError(cli.stopCtx)}
+						}
+						continue
+					}
+					cli.handleTaskEvent(ev)
+				default:
+					return
+				}
 			}
 		}
 	}
 }
 
-func (cli *Client) postTaskEvent(in interface{}, h TaskHandler, waitRet bool) (chan *TaskResult, error) {
+func (cli *Client) handleTaskEvent(ev *TaskEvent) {
+	var ret *TaskResult
+	if err := ev.Context().Err(); err != nil {
+		// the poster has gone away, skip the handler
+		ret = &TaskResult{Err: err}
+	} else {
+		ret = ev.Handler(ev)
+	}
+	if ev.Rc != nil {
+		ev.Rc <- ret
+	}
+}
+
+func (cli *Client) postTaskEvent(ctx context.Context, in interface{}, h TaskHandler, waitRet bool) (chan *TaskResult, error) {
 	tv := &TaskEvent{
+		Ctx:     ctx,
 		In:      in,
 		Handler: h,
 	}
@@ -21,7 +55,16 @@ func (cli *Client) postTaskEvent(in interface{}, h TaskHandler, waitRet bool) (c
 		tv.Rc = make(chan *TaskResult, 1)
 	}
 
+	cli.mu.RLock()
+	defer cli.mu.RUnlock()
+
+	if cli.state != clientStarted {
+		return nil, ErrClientNotStarted
+	}
+
 	select {
+	case <-tv.Context().Done():
+		return nil, contextError(tv.Context())
 	case cli.eventCh <- tv:
 	}
 
@@ -29,15 +72,25 @@ func (cli *Client) postTaskEvent(in interface{}, h TaskHandler, waitRet bool) (c
 }
 
 type TaskEvent struct {
+	Ctx     context.Context
 	In      interface{}
 	Rc      chan *TaskResult
 	Handler TaskHandler
 }
 
+// Context returns the context of the task event, never nil.
+func (ev *TaskEvent) Context() context.Context {
+	if ev.Ctx == nil {
+		return context.Background()
+	}
+	return ev.Ctx
+}
+
 type TaskResult struct {
 	Out interface{}
 	Err error
 }
 
 type TaskHandler func(*TaskEvent) *TaskResult
-type PostTaskEventFunc func(interface{}, TaskHandler, bool) (chan *TaskResult, error)
+type PostTaskEventFunc func(context.Context, interface{}, TaskHandler, bool) (chan *TaskResult, error)
+type NotifyEventFunc func(*ApplicationEvent)
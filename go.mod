@@ -19,4 +19,5 @@ require (
 	k8s.io/client-go v12.0.0+incompatible
 	k8s.io/metrics v0.17.4
 	k8s.io/utils v0.0.0-20200731180307-f00132d28269 // indirect
+	sigs.k8s.io/yaml v1.1.0
 )
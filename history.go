@@ -0,0 +1,244 @@
+package engine
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/jimi36/app-engine/log"
+)
+
+// MaxHistoryRecords is the max count of the deployment records of an application.
+var MaxHistoryRecords = 100
+
+type HistoryOutcome string
+
+const (
+	HistoryRunning HistoryOutcome = "running"
+	HistoryStopped HistoryOutcome = "stopped"
+	HistoryExited  HistoryOutcome = "exited"
+	HistoryFailed  HistoryOutcome = "failed"
+)
+
+type HistoryRecord struct {
+	Version   string         `json:"version,omitempty"`
+	StartTime time.Time      `json:"startTime,omitempty"`
+	StopTime  time.Time      `json:"stopTime,omitempty"`
+	Outcome   HistoryOutcome `json:"outcome,omitempty"`
+	Reason    string         `json:"reason,omitempty"`
+}
+
+// ApplicationHistory is the deployment history of an application name,
+// the records are ordered from the oldest to the newest.
+type ApplicationHistory struct {
+	Name    string           `json:"name,omitempty"`
+	Records []*HistoryRecord `json:"records,omitempty"`
+}
+
+// lastRunning returns the last running record of the version.
+func (h *ApplicationHistory) lastRunning(version string) *HistoryRecord {
+	if n := len(h.Records); n > 0 {
+		if r := h.Records[n-1]; r.Outcome == HistoryRunning && (len(version) == 0 || r.Version == version) {
+			return r
+		}
+	}
+	return nil
+}
+
+// KnownGood returns the newest version which was stopped normally except
+// the excluded version, and an empty string if there isn't one. The versions
+// not existed are skipped if exists is not nil.
+func (h *ApplicationHistory) KnownGood(exclude string, exists func(version string) bool) string {
+	for i := len(h.Records) - 1; i >= 0; i-- {
+		r := h.Records[i]
+		if r.Version == exclude || r.Outcome != HistoryStopped {
+			continue
+		}
+		if exists == nil || exists(r.Version) {
+			return r.Version
+		}
+	}
+	return ""
+}
+
+var historyMu sync.Mutex
+
+// RecordHistory updates the deployment history of the application by the
+// event, it is called by the client impls when the events are notified.
+func RecordHistory(store Store, ev *ApplicationEvent) {
+	switch ev.Type {
+	case ApplicationStarted, ApplicationStopped, ApplicationExited, ApplicationFailed:
+	default:
+		return
+	}
+
+	now := ev.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	err := store.UpdateApplicationHistory(ev.Name, func(h *ApplicationHistory) error {
+		switch ev.Type {
+		case ApplicationStarted:
+			if h.lastRunning(ev.Version) != nil {
+				return nil
+			}
+			// the instance of other version is replaced
+			if r := h.lastRunning(""); r != nil {
+				r.StopTime = now
+				r.Outcome = HistoryStopped
+			}
+			h.Records = append(h.Records, &HistoryRecord{
+				Version:   ev.Version,
+				StartTime: now,
+				Outcome:   HistoryRunning,
+			})
+		case ApplicationStopped, ApplicationExited, ApplicationFailed:
+			outcome := HistoryStopped
+			if ev.Type == ApplicationExited {
+				outcome = HistoryExited
+			} else if ev.Type == ApplicationFailed {
+				outcome = HistoryFailed
+			}
+			r := h.lastRunning(ev.Version)
+			if r == nil {
+				if ev.Type != ApplicationFailed {
+					return nil
+				}
+				// failed before it is started
+				r = &HistoryRecord{
+					Version:   ev.Version,
+					StartTime: now,
+				}
+				h.Records = append(h.Records, r)
+			}
+			r.StopTime = now
+			r.Outcome = outcome
+			r.Reason = ev.Reason
+		}
+
+		if n := len(h.Records); n > MaxHistoryRecords {
+			h.Records = h.Records[n-MaxHistoryRecords:]
+		}
+		return nil
+	})
+	if err != nil {
+		log.Warnf("record application[%s] history error: %s", ev.Tag(), err.Error())
+	}
+}
+
+// GetApplicationHistory gets the deployment history of the application
+// with the default TaskHandleTimeout.
+func (c *Client) GetApplicationHistory(name string) (*ApplicationHistory, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TaskHandleTimeout)
+	defer cancel()
+	return c.GetApplicationHistoryWithContext(ctx, name)
+}
+
+// GetApplicationHistoryWithContext gets the deployment history of the
+// application, the call is aborted when ctx is done.
+func (c *Client) GetApplicationHistoryWithContext(ctx context.Context, name string) (*ApplicationHistory, error) {
+	log.Debugf("get application[%s] history......", name)
+
+	if len(name) == 0 {
+		log.Warnf("get application[%s] history error: %s", name, ErrParamInvalid.Error())
+		return nil, ErrParamInvalid
+	}
+
+	rc, err := c.postTaskEvent(ctx, name, c.impl.GetApplicationHistory, true)
+	if err != nil {
+		log.Warnf("get application[%s] history error: %s", name, err.Error())
+		return nil, err
+	}
+
+	var ret *TaskResult
+	select {
+	case <-ctx.Done():
+		err := contextError(ctx)
+		log.Warnf("get application[%s] history error: %s", name, err.Error())
+		return nil, err
+	case ret = <-rc:
+	}
+
+	if ret.Err != nil {
+		log.Warnf("get application[%s] history error: %s", name, ret.Err.Error())
+		return nil, ret.Err
+	}
+
+	out, ok := ret.Out.(*ApplicationHistory)
+	if !ok {
+		log.Warnf("get application[%s] history error: %s", name, ErrTaskResultInvalid.Error())
+		return nil, ErrTaskResultInvalid
+	}
+
+	log.Debugf("get application[%s] history finished", name)
+
+	return out, nil
+}
+
+// RollbackApplication restarts the last known-good version of the
+// application with the default TaskHandleTimeout.
+func (c *Client) RollbackApplication(name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), TaskHandleTimeout)
+	defer cancel()
+	return c.RollbackApplicationWithContext(ctx, name)
+}
+
+// RollbackApplicationWithContext restarts the last known-good version of the
+// application, which is the newest existed version stopped normally other than
+// the running one, or the last deployed one if no version is running. The
+// running version is upgraded to it, or it is started if no version is running.
+func (c *Client) RollbackApplicationWithContext(ctx context.Context, name string) error {
+	log.Debugf("rollback application[%s]......", name)
+
+	h, err := c.GetApplicationHistoryWithContext(ctx, name)
+	if err != nil {
+		log.Warnf("rollback application[%s] error: %s", name, err.Error())
+		return err
+	}
+
+	tags, err := c.ListApplicationsWithContext(ctx, &ListApplicationOption{Size: math.MaxInt32})
+	if err != nil {
+		log.Warnf("rollback application[%s] error: %s", name, err.Error())
+		return err
+	}
+	versions := make(map[string]bool)
+	for _, tag := range tags {
+		if tag.Name == name {
+			versions[tag.Version] = true
+		}
+	}
+
+	// the last deployed version is excluded even if it is stopped
+	current, exclude := "", ""
+	if r := h.lastRunning(""); r != nil {
+		current, exclude = r.Version, r.Version
+	} else if n := len(h.Records); n > 0 {
+		exclude = h.Records[n-1].Version
+	}
+	version := h.KnownGood(exclude, func(v string) bool {
+		return versions[v]
+	})
+	if len(version) == 0 {
+		log.Warnf("rollback application[%s] error: %s", name, ErrNoKnownGoodVersion.Error())
+		return ErrNoKnownGoodVersion
+	}
+
+	if len(current) > 0 {
+		err = c.UpgradeApplicationWithContext(ctx, name, current, version)
+	} else {
+		err = c.StartApplicationWithContext(ctx, &ApplicationTag{Name: name, Version: version})
+	}
+	if err != nil {
+		log.Warnf("rollback application[%s] to %s error: %s", name, version, err.Error())
+		return err
+	}
+
+	log.Debugf("rollback application[%s] to %s finished", name, version)
+
+	return nil
+}
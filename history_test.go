@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testHistory(records ...*HistoryRecord) *ApplicationHistory {
+	return &ApplicationHistory{Name: "a", Records: records}
+}
+
+func TestKnownGood(t *testing.T) {
+	h := testHistory(
+		&HistoryRecord{Version: "1", Outcome: HistoryStopped},
+		&HistoryRecord{Version: "2", Outcome: HistoryStopped},
+		&HistoryRecord{Version: "3", Outcome: HistoryFailed},
+	)
+
+	cases := []struct {
+		exclude string
+		exists  func(string) bool
+		version string
+	}{
+		{"", nil, "2"},
+		{"2", nil, "1"},
+		{"", func(v string) bool { return v != "2" }, "1"},
+		{"1", func(v string) bool { return v != "2" }, ""},
+	}
+
+	for _, c := range cases {
+		if version := h.KnownGood(c.exclude, c.exists); version != c.version {
+			t.Errorf("known good excluding %q is %q, want %q", c.exclude, version, c.version)
+		}
+	}
+}
+
+func TestRollbackApplication(t *testing.T) {
+	cases := []struct {
+		name    string
+		history *ApplicationHistory
+		apps    []*Application
+		calls   []string
+		err     error
+	}{
+		{
+			"nothing running",
+			testHistory(
+				&HistoryRecord{Version: "1", Outcome: HistoryStopped},
+				&HistoryRecord{Version: "2", Outcome: HistoryStopped},
+			),
+			[]*Application{testApp("a", "1", nil, nil), testApp("a", "2", nil, nil)},
+			[]string{"start a-1"},
+			nil,
+		},
+		{
+			"removed version",
+			testHistory(
+				&HistoryRecord{Version: "1", Outcome: HistoryStopped},
+				&HistoryRecord{Version: "2", Outcome: HistoryStopped},
+				&HistoryRecord{Version: "3", Outcome: HistoryRunning},
+			),
+			[]*Application{testApp("a", "1", nil, nil), testApp("a", "3", nil, nil)},
+			[]string{"upgrade a from 3 to 1"},
+			nil,
+		},
+		{
+			"only the last deployed",
+			testHistory(
+				&HistoryRecord{Version: "1", Outcome: HistoryStopped},
+				&HistoryRecord{Version: "2", Outcome: HistoryStopped},
+			),
+			[]*Application{testApp("a", "2", nil, nil)},
+			nil,
+			ErrNoKnownGoodVersion,
+		},
+	}
+
+	for _, c := range cases {
+		impl := &fakeImpl{history: c.history, apps: c.apps}
+		cli, cleanup := newTestClient(t, impl)
+		err := cli.RollbackApplication("a")
+		cleanup()
+		if err != c.err {
+			t.Errorf("%s: rollback error %v, want %v", c.name, err, c.err)
+		}
+		if !reflect.DeepEqual(impl.calls, c.calls) {
+			t.Errorf("%s: rolled back by %q, want %q", c.name, impl.calls, c.calls)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package kube
 import (
 	engine "github.com/jimi36/app-engine"
 	"github.com/jimi36/app-engine/log"
+	"github.com/pkg/errors"
 )
 
 func (cli *Client) CreateApplication(ev *engine.TaskEvent) *engine.TaskResult {
@@ -16,6 +17,20 @@ func (cli *Client) CreateApplication(ev *engine.TaskEvent) *engine.TaskResult {
 
 	log.Debugf("create kube application[%s]......", app.Tag())
 
+	if app.KubeSpec == nil || app.Replicas < 0 {
+		log.Warnf("create kube application[%s] error: %s", app.Tag(), engine.ErrParamInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrParamInvalid,
+		}
+	}
+	if err := checkImage(app.KubeSpec.Image, cli.allowedImages); err != nil {
+		err = errors.Wrap(engine.ErrParamInvalid, err.Error())
+		log.Warnf("create kube application[%s] error: %s", app.Tag(), err.Error())
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
+
 	if err := cli.store.AddApplication(app); err != nil {
 		log.Warnf("create kube application[%s] error: %s", app.Tag(), err.Error())
 		return &engine.TaskResult{
@@ -23,11 +38,64 @@ func (cli *Client) CreateApplication(ev *engine.TaskEvent) *engine.TaskResult {
 		}
 	}
 
+	cli.notifyEvent(&engine.ApplicationEvent{
+		ApplicationTag: app.ApplicationTag,
+		Type:           engine.ApplicationCreated,
+	})
+
 	log.Debugf("create kube application[%s] finished", app.Tag())
 
 	return &engine.TaskResult{}
 }
 
+// UpdateApplication replaces the spec of the version in place, the running
+// version is refused.
+func (cli *Client) UpdateApplication(ev *engine.TaskEvent) *engine.TaskResult {
+	app, ok := ev.In.(*engine.Application)
+	if !ok {
+		log.Fatalf("update kube application error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	log.Debugf("update kube application[%s]......", app.Tag())
+
+	if app.KubeSpec == nil || app.Replicas < 0 {
+		log.Warnf("update kube application[%s] error: %s", app.Tag(), engine.ErrParamInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrParamInvalid,
+		}
+	}
+	if err := checkImage(app.KubeSpec.Image, cli.allowedImages); err != nil {
+		err = errors.Wrap(engine.ErrParamInvalid, err.Error())
+		log.Warnf("update kube application[%s] error: %s", app.Tag(), err.Error())
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
+
+	if rt, _ := cli.store.GetApplicationRuntime(app.Name); rt != nil && rt.Version == app.Version && rt.ToStart {
+		log.Warnf("update kube application[%s] error: %s", app.Tag(), engine.ErrApplicationStarted.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrApplicationStarted,
+		}
+	}
+
+	if err := cli.store.UpdateApplication(&app.ApplicationTag, func(cur *engine.Application) {
+		*cur = *app
+	}); err != nil {
+		log.Warnf("update kube application[%s] error: %s", app.Tag(), err.Error())
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
+
+	log.Debugf("update kube application[%s] finished", app.Tag())
+
+	return &engine.TaskResult{}
+}
+
 func (cli *Client) RemoveApplication(ev *engine.TaskEvent) *engine.TaskResult {
 	tag, ok := ev.In.(*engine.ApplicationTag)
 	if !ok {
@@ -55,6 +123,11 @@ func (cli *Client) RemoveApplication(ev *engine.TaskEvent) *engine.TaskResult {
 		}
 	}
 
+	cli.notifyEvent(&engine.ApplicationEvent{
+		ApplicationTag: *tag,
+		Type:           engine.ApplicationRemoved,
+	})
+
 	log.Debugf("remove kube application[%s] finished", tag.Tag())
 
 	return &engine.TaskResult{}
@@ -137,3 +210,29 @@ func (cli *Client) GetStartedApplications(ev *engine.TaskEvent) *engine.TaskResu
 		Out: rts,
 	}
 }
+
+func (cli *Client) GetApplication(ev *engine.TaskEvent) *engine.TaskResult {
+	tag, ok := ev.In.(*engine.ApplicationTag)
+	if !ok {
+		log.Fatalf("get kube application error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	log.Debugf("get kube application[%s]......", tag.Tag())
+
+	app, err := cli.store.GetApplication(tag)
+	if err != nil {
+		log.Warnf("get kube application[%s] error: %s", tag.Tag(), err.Error())
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
+
+	log.Debugf("get kube application[%s] finished", tag.Tag())
+
+	return &engine.TaskResult{
+		Out: app,
+	}
+}
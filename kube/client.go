@@ -1,6 +1,7 @@
 package kube
 
 import (
+	"context"
 	"os/user"
 	"path/filepath"
 	"time"
@@ -44,8 +45,11 @@ func NewClient(opts ...engine.Option) (engine.ClientImpl, error) {
 			return nil, err
 		}
 		cli.store = dbStore
+		cli.ownStore = true
 	}
 
+	cli.ctx, cli.cancel = context.WithCancel(context.Background())
+
 	return cli, nil
 }
 
@@ -59,16 +63,31 @@ type Client struct {
 
 	// post task func
 	postTaskEvent engine.PostTaskEventFunc
+	// notify application event func
+	notifyEvent engine.NotifyEventFunc
 
 	basePath string
 
+	// allow-list of the image registries and digests
+	allowedImages []string
+
 	store engine.Store
+	// store is opened by the client
+	ownStore bool
+
+	// canceled when the client is closed
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 var _ engine.ClientImpl = (*Client)(nil)
 
-func (cli *Client) Init(postFunc engine.PostTaskEventFunc) error {
+func (cli *Client) Init(postFunc engine.PostTaskEventFunc, notifyFunc engine.NotifyEventFunc) error {
 	cli.postTaskEvent = postFunc
+	cli.notifyEvent = func(ev *engine.ApplicationEvent) {
+		engine.RecordHistory(cli.store, ev)
+		notifyFunc(ev)
+	}
 
 	go cli.monitorInstance()
 
@@ -82,3 +101,53 @@ func getDefaultKubeConfigPath() string {
 	}
 	return u.HomeDir + "/.kube/config"
 }
+
+func (cli *Client) Close(ev *engine.TaskEvent) *engine.TaskResult {
+	opt, ok := ev.In.(*engine.StopOption)
+	if !ok {
+		log.Fatalf("close kube client error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	log.Debugf("close kube client......")
+
+	// stop deployment watcher
+	cli.cancel()
+
+	if !opt.KeepApplications {
+		var rts []*engine.ApplicationRuntime
+		cli.store.ForeachApplicationRunTime(func(rt *engine.ApplicationRuntime) {
+			if rt.ToStart {
+				rts = append(rts, rt)
+			}
+		})
+		for _, rt := range rts {
+			if err := cli.deleteService(rt.Name); err != nil {
+				log.Warnf("close kube client stop application[%s] error: %s", rt.Tag(), err.Error())
+			}
+			if err := cli.kubeCli.AppsV1().Deployments(cli.ns).Delete(rt.Name, nil); err != nil {
+				log.Warnf("close kube client stop application[%s] error: %s", rt.Tag(), err.Error())
+			}
+			// keep ToStart, the application is started again by the next client
+			cli.store.UpdateApplicationRuntime(rt.Name, func(runtime *engine.ApplicationRuntime) error {
+				runtime.IsStarted = false
+				return nil
+			})
+		}
+	}
+
+	if cli.ownStore {
+		if err := cli.store.Close(); err != nil {
+			log.Warnf("close kube client error: %s", err.Error())
+			return &engine.TaskResult{
+				Err: err,
+			}
+		}
+	}
+
+	log.Debugf("close kube client finished")
+
+	return &engine.TaskResult{}
+}
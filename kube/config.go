@@ -39,6 +39,38 @@ func (cli *Client) CreateConfig(ev *engine.TaskEvent) *engine.TaskResult {
 	return &engine.TaskResult{}
 }
 
+// UpdateConfig updates the ConfigMap of the config in place.
+func (cli *Client) UpdateConfig(ev *engine.TaskEvent) *engine.TaskResult {
+	config, ok := ev.In.(*engine.Config)
+	if !ok {
+		log.Fatalf("update kube config error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	log.Debugf("update kube config[%s]......", config.Name)
+
+	kubeConfig := toKubeConfigMap(config)
+	if _, err := cli.kubeCli.CoreV1().ConfigMaps(cli.ns).Update(kubeConfig); err != nil {
+		log.Warnf("update kube config[%s] error: %s", config.Name, err.Error())
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
+
+	if err := cli.store.AddConfig(config); err != nil {
+		log.Warnf("update kube config[%s] error: %s", config.Name, err.Error())
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
+
+	log.Debugf("update kube config[%s] finished", config.Name)
+
+	return &engine.TaskResult{}
+}
+
 func (cli *Client) RemoveConfig(ev *engine.TaskEvent) *engine.TaskResult {
 	name, ok := ev.In.(string)
 	if !ok {
@@ -78,3 +110,23 @@ func toKubeConfigMap(config *engine.Config) *coreV1.ConfigMap {
 		Data: config.Data,
 	}
 }
+
+func (cli *Client) ListConfigs(ev *engine.TaskEvent) *engine.TaskResult {
+	log.Debugf("list kube configs......")
+
+	var configs []*engine.Config
+	if err := cli.store.ForeachConfig(func(config *engine.Config) {
+		configs = append(configs, config)
+	}); err != nil {
+		log.Warnf("list kube configs error: %s", err.Error())
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
+
+	log.Debugf("list kube configs finished")
+
+	return &engine.TaskResult{
+		Out: configs,
+	}
+}
@@ -1,8 +1,13 @@
 package kube
 
 import (
+	"context"
+	"net/http"
+	"time"
+
 	appV1 "k8s.io/api/apps/v1"
 	coreV1 "k8s.io/api/core/v1"
+	kubeErrors "k8s.io/apimachinery/pkg/api/errors"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	labels "k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/watch"
@@ -12,6 +17,13 @@ import (
 	"github.com/pkg/errors"
 )
 
+const (
+	// rewatchDelay is the delay before watching the deployments again after the watch is closed
+	rewatchDelay = time.Second
+	// watchRetryInterval is the delay before watching the deployments again after an error
+	watchRetryInterval = time.Second * 5
+)
+
 type instanceEvent struct {
 	name    string
 	version string
@@ -19,23 +31,70 @@ type instanceEvent struct {
 	err     string
 }
 
+// monitorInstance watches the deployments until the client is closed, the
+// closed watch is established again from the last seen resource version.
 func (cli *Client) monitorInstance() {
-	deployWatcher, err := cli.kubeCli.AppsV1().Deployments(cli.ns).Watch(metaV1.ListOptions{})
+	resourceVersion := ""
+	for {
+		rv, err := cli.watchDeployments(resourceVersion)
+		resourceVersion = rv
+
+		delay := rewatchDelay
+		if err != nil {
+			log.Warnf("monitor kube application instance error: %s", err.Error())
+			delay = watchRetryInterval
+		}
+		select {
+		case <-cli.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// watchDeployments watches the deployments from the resource version until
+// the watch is closed, and returns the last seen resource version, which is
+// reset if it's expired.
+func (cli *Client) watchDeployments(resourceVersion string) (string, error) {
+	deployWatcher, err := cli.kubeCli.AppsV1().Deployments(cli.ns).Watch(metaV1.ListOptions{
+		ResourceVersion: resourceVersion,
+	})
 	if err != nil {
-		log.Warnf("monitor kube application instance error: %s", err.Error())
-		return
+		if kubeErrors.IsResourceExpired(err) || kubeErrors.IsGone(err) {
+			return "", err
+		}
+		return resourceVersion, err
 	}
+	defer deployWatcher.Stop()
 
 	for {
 		select {
-		case e := <-deployWatcher.ResultChan():
+		case <-cli.ctx.Done():
+			return resourceVersion, nil
+		case e, ok := <-deployWatcher.ResultChan():
+			if !ok {
+				log.Debugf("monitor kube application instance: watch channel closed, watch again")
+				return resourceVersion, nil
+			}
+			if e.Type == watch.Error {
+				if status, ok := e.Object.(*metaV1.Status); ok {
+					if status.Code == http.StatusGone {
+						// the resource version is too old, watch from now on
+						return "", kubeErrors.FromObject(status)
+					}
+					return resourceVersion, kubeErrors.FromObject(status)
+				}
+			}
+			if deploy, ok := e.Object.(*appV1.Deployment); ok {
+				resourceVersion = deploy.ResourceVersion
+			}
 			if e.Type == watch.Added || e.Type == watch.Modified {
 				if deploy, ok := e.Object.(*appV1.Deployment); ok {
 					if deploy.Status.AvailableReplicas > 0 {
 						name, _ := deploy.Labels[labelEdgeApp]
 						version, _ := deploy.Labels[labelEdgeAppVersion]
 						if len(name) != 0 && len(version) != 0 {
-							cli.postTaskEvent(&engine.ApplicationTag{name, version}, cli.markApplicationStarted, false)
+							cli.postTaskEvent(context.Background(), &engine.ApplicationTag{name, version}, cli.markApplicationStarted, false)
 						}
 					}
 				}
@@ -44,7 +103,7 @@ func (cli *Client) monitorInstance() {
 					name, _ := deploy.Labels[labelEdgeApp]
 					version, _ := deploy.Labels[labelEdgeAppVersion]
 					if len(name) != 0 && len(version) != 0 {
-						cli.postTaskEvent(&engine.ApplicationTag{name, version}, cli.markApplicationStopped, false)
+						cli.postTaskEvent(context.Background(), &engine.ApplicationTag{name, version}, cli.markApplicationStopped, false)
 					}
 				}
 			}
@@ -72,13 +131,19 @@ func (cli *Client) markApplicationStarted(ev *engine.TaskEvent) *engine.TaskResu
 		return nil
 	})
 	if err != nil {
-		log.Fatalf("mark kube application started: %s", err.Error())
+		// already started or not managed, the deployment is just modified
+		log.Debugf("mark kube application[%s] started: %s", tag.Tag(), err.Error())
 		return &engine.TaskResult{
 			Err: err,
 		}
 	}
 
-	log.Debugf("mark kube application[%s] started finished: %s", tag.Tag())
+	cli.notifyEvent(&engine.ApplicationEvent{
+		ApplicationTag: *tag,
+		Type:           engine.ApplicationStarted,
+	})
+
+	log.Debugf("mark kube application[%s] started finished", tag.Tag())
 
 	return &engine.TaskResult{}
 }
@@ -102,7 +167,8 @@ func (cli *Client) markApplicationStopped(ev *engine.TaskEvent) *engine.TaskResu
 		return nil
 	})
 	if err != nil {
-		log.Fatalf("mark kube application stopped: %s", err.Error())
+		// stopped by the client or not managed
+		log.Debugf("mark kube application[%s] stopped: %s", tag.Tag(), err.Error())
 		return &engine.TaskResult{
 			Err: err,
 		}
@@ -115,7 +181,14 @@ func (cli *Client) markApplicationStopped(ev *engine.TaskEvent) *engine.TaskResu
 		log.Warnf("mark kube application[%s] stopped error: %s", tag.Tag(), err.Error())
 	}
 
-	log.Debugf("mark kube application[%s] stopped finished: %s", tag.Tag())
+	cli.notifyEvent(&engine.ApplicationEvent{
+		ApplicationTag: *tag,
+		Type:           engine.ApplicationExited,
+		ExitCode:       -1,
+		Reason:         "deployment is deleted",
+	})
+
+	log.Debugf("mark kube application[%s] stopped finished", tag.Tag())
 
 	return &engine.TaskResult{}
 }
@@ -145,10 +218,13 @@ func (cli *Client) getInstanceStates(name string) []engine.InstanceState {
 		if err != nil {
 			return insStates
 		}
+		ready, healthy := podProbeResults(&pod, name)
 		if len(podMetric.Containers) < 1 {
 			insStates = append(insStates, engine.InstanceState{
 				Name:    pod.Name,
 				Running: pod.Status.Phase == coreV1.PodRunning,
+				Ready:   ready,
+				Healthy: healthy,
 			})
 		} else {
 			cpu, _ := podMetric.Containers[0].Usage.Cpu().AsInt64()
@@ -156,6 +232,8 @@ func (cli *Client) getInstanceStates(name string) []engine.InstanceState {
 			insStates = append(insStates, engine.InstanceState{
 				Name:    pod.Name,
 				Running: pod.Status.Phase == coreV1.PodRunning,
+				Ready:   ready,
+				Healthy: healthy,
 				Cpu:     cpu / 100,  // %
 				Mem:     mem / 1024, // kb
 			})
@@ -164,3 +242,20 @@ func (cli *Client) getInstanceStates(name string) []engine.InstanceState {
 
 	return insStates
 }
+
+// podProbeResults returns the ready condition of the pod and whether the
+// application container is running without being restarted by the liveness probe.
+func podProbeResults(pod *coreV1.Pod, name string) (bool, bool) {
+	ready, healthy := false, false
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == coreV1.PodReady {
+			ready = cond.Status == coreV1.ConditionTrue
+		}
+	}
+	for _, st := range pod.Status.ContainerStatuses {
+		if st.Name == name {
+			healthy = st.State.Running != nil
+		}
+	}
+	return ready, healthy
+}
@@ -0,0 +1,86 @@
+package kube
+
+import (
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+
+	engine "github.com/jimi36/app-engine"
+	"github.com/jimi36/app-engine/log"
+)
+
+func (cli *Client) GetApplicationLogs(ev *engine.TaskEvent) *engine.TaskResult {
+	req, ok := ev.In.(*engine.LogRequest)
+	if !ok {
+		log.Fatalf("get kube application logs error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	tag := req.Tag
+	opt := req.Option
+	if opt == nil {
+		opt = &engine.LogOption{}
+	}
+
+	log.Debugf("get kube application[%s] logs......", tag.Tag())
+
+	// check application runtime version
+	rt, err := cli.store.GetApplicationRuntime(tag.Name)
+	if err != nil || rt.Version != tag.Version {
+		log.Warnf("get kube application[%s] logs error: %s", tag.Tag(), engine.ErrApplicationNotStarted.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrApplicationNotStarted,
+		}
+	}
+
+	podName := opt.Instance
+	if len(podName) == 0 {
+		selector := labels.SelectorFromSet(map[string]string{
+			labelEdgeApp:        tag.Name,
+			labelEdgeAppVersion: tag.Version,
+		})
+		pods, err := cli.kubeCli.CoreV1().Pods(cli.ns).List(metaV1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			log.Warnf("get kube application[%s] logs error: %s", tag.Tag(), err.Error())
+			return &engine.TaskResult{
+				Err: err,
+			}
+		}
+		if len(pods.Items) == 0 {
+			log.Warnf("get kube application[%s] logs error: %s", tag.Tag(), engine.ErrApplicationNotStarted.Error())
+			return &engine.TaskResult{
+				Err: engine.ErrApplicationNotStarted,
+			}
+		}
+		podName = pods.Items[0].Name
+	}
+
+	logOpts := &coreV1.PodLogOptions{
+		Container: tag.Name,
+		Follow:    opt.Follow,
+	}
+	if opt.TailLines > 0 {
+		tailLines := int64(opt.TailLines)
+		logOpts.TailLines = &tailLines
+	}
+	if !opt.Since.IsZero() {
+		since := metaV1.NewTime(opt.Since)
+		logOpts.SinceTime = &since
+	}
+
+	rc, err := cli.kubeCli.CoreV1().Pods(cli.ns).GetLogs(podName, logOpts).Stream()
+	if err != nil {
+		log.Warnf("get kube application[%s] logs error: %s", tag.Tag(), err.Error())
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
+
+	log.Debugf("get kube application[%s] logs finished", tag.Tag())
+
+	return &engine.TaskResult{
+		Out: rc,
+	}
+}
@@ -64,6 +64,19 @@ func Store(store engine.Store) engine.Option {
 	}
 }
 
+// AllowedImages sets the allow-list of the image registries, repositories
+// and digests, the application with other images can't be created or started.
+func AllowedImages(entries ...string) engine.Option {
+	return func(cli engine.ClientImpl) error {
+		c, ok := cli.(*Client)
+		if !ok {
+			return engine.ErrOptionInvalid
+		}
+		c.allowedImages = append(c.allowedImages, entries...)
+		return nil
+	}
+}
+
 func openKubeClient(cli engine.ClientImpl) error {
 	c, _ := cli.(*Client)
 	kubeConfig, err := func() (*rest.Config, error) {
@@ -0,0 +1,82 @@
+package kube
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultRegistry = "docker.io"
+)
+
+// normalizeImage adds the implicit registry and repository of docker hub.
+func normalizeImage(image string) string {
+	i := strings.Index(image, "/")
+	if i < 0 {
+		return defaultRegistry + "/library/" + image
+	}
+	host := image[:i]
+	if !strings.ContainsAny(host, ".:") && host != "localhost" {
+		return defaultRegistry + "/" + image
+	}
+	return image
+}
+
+// splitImage splits the normalized image into the registry and the
+// repository components, the tag and the digest are dropped.
+func splitImage(image string) []string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	parts := strings.Split(image, "/")
+	// the colon of the registry is the port, and the one of the last
+	// repository component is the tag
+	if last := len(parts) - 1; last > 0 {
+		if i := strings.LastIndex(parts[last], ":"); i >= 0 {
+			parts[last] = parts[last][:i]
+		}
+	}
+	return parts
+}
+
+// checkImage checks the image against the allow-list, an entry is a digest
+// like sha256:<hex> matching the image pinned by it, or a registry or
+// repository prefix like registry.example.com/team, which matches the whole
+// registry and repository components. All images are allowed if the
+// allow-list is empty.
+func checkImage(image string, allowed []string) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+
+	image = normalizeImage(image)
+	parts := splitImage(image)
+	for _, entry := range allowed {
+		if strings.HasPrefix(entry, "sha256:") {
+			if strings.HasSuffix(image, "@"+entry) {
+				return nil
+			}
+			continue
+		}
+		if matchComponents(parts, strings.Split(strings.TrimSuffix(entry, "/"), "/")) {
+			return nil
+		}
+	}
+
+	return errors.Errorf("image %s is not allowed", image)
+}
+
+// matchComponents reports whether the prefix components are the leading
+// components of the image.
+func matchComponents(parts, prefix []string) bool {
+	if len(prefix) > len(parts) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != parts[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,52 @@
+package kube
+
+import (
+	"testing"
+)
+
+func TestCheckImage(t *testing.T) {
+	digest := "sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	allowed := []string{
+		"registry.example.com",
+		"registry.example.org:5000/team/",
+		"docker.io/library/nginx",
+		digest,
+	}
+
+	cases := []struct {
+		image string
+		allow bool
+	}{
+		{"registry.example.com/app", true},
+		{"registry.example.com/team/app:1.0", true},
+		{"registry.example.com/app@" + digest, true},
+		{"registry.example.com:5000/app", false},
+		{"registry.example.com.evil/app", false},
+		{"registry.example.comevil/app", false},
+		{"registry.example.org:5000/team/app:1.0", true},
+		{"registry.example.org:5000/team", true},
+		{"registry.example.org:5000/teamevil/app", false},
+		{"registry.example.org/team/app", false},
+		{"nginx", true},
+		{"nginx:1.19", true},
+		{"library/nginx@" + digest, true},
+		{"docker.io/library/nginx-evil", false},
+		{"docker.io/library/nginx/evil", true},
+		{"busybox", false},
+		{"evil.com/busybox@" + digest, true},
+		{"evil.com/busybox@sha256:" + "f0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcde", false},
+	}
+
+	for _, c := range cases {
+		err := checkImage(c.image, allowed)
+		if c.allow && err != nil {
+			t.Errorf("image %s should be allowed: %v", c.image, err)
+		} else if !c.allow && err == nil {
+			t.Errorf("image %s should not be allowed", c.image)
+		}
+	}
+
+	if err := checkImage("any.example.com/app", nil); err != nil {
+		t.Errorf("any image should be allowed by the empty allow-list: %v", err)
+	}
+}
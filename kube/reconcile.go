@@ -0,0 +1,157 @@
+package kube
+
+import (
+	"fmt"
+	"sort"
+
+	appV1 "k8s.io/api/apps/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	engine "github.com/jimi36/app-engine"
+	"github.com/jimi36/app-engine/log"
+)
+
+func (cli *Client) ReconcileApplications(ev *engine.TaskEvent) *engine.TaskResult {
+	opt, ok := ev.In.(*engine.ReconcileOption)
+	if !ok {
+		log.Fatalf("reconcile kube applications error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	log.Debugf("reconcile kube applications......")
+
+	rts := make(map[string]*engine.ApplicationRuntime)
+	var names []string
+	cli.store.ForeachApplicationRunTime(func(rt *engine.ApplicationRuntime) {
+		rts[rt.Name] = rt
+		names = append(names, rt.Name)
+	})
+	sort.Strings(names)
+
+	// the deployments managed by the engine
+	deployCli := cli.kubeCli.AppsV1().Deployments(cli.ns)
+	list, err := deployCli.List(metaV1.ListOptions{LabelSelector: labelEdgeApp})
+	if err != nil {
+		log.Warnf("reconcile kube applications error: %s", err.Error())
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
+	deploys := make(map[string]*appV1.Deployment)
+	for i := range list.Items {
+		deploy := &list.Items[i]
+		if deploy.DeletionTimestamp == nil {
+			deploys[deploy.Name] = deploy
+		}
+	}
+
+	var actions []*engine.ReconcileAction
+
+	// the deployments which shouldn't be running
+	for name, deploy := range deploys {
+		if rt := rts[name]; rt != nil && rt.ToStart {
+			continue
+		}
+		action := &engine.ReconcileAction{
+			ApplicationTag: engine.ApplicationTag{Name: name, Version: deploy.Labels[labelEdgeAppVersion]},
+			Type:           engine.ReconcileStop,
+			Reason:         "application is not to be started",
+		}
+		if !opt.DryRun {
+			if err := cli.deleteService(name); err != nil {
+				log.Warnf("reconcile kube application[%s] error: %s", action.Tag(), err.Error())
+			}
+			if err := deployCli.Delete(name, nil); err != nil {
+				action.Err = err.Error()
+			}
+		}
+		actions = append(actions, action)
+	}
+
+	// the applications which should be running
+	for _, name := range names {
+		rt := rts[name]
+		if !rt.ToStart {
+			continue
+		}
+		tag := &engine.ApplicationTag{Name: rt.Name, Version: rt.Version}
+
+		deploy, found := deploys[name]
+		if !found {
+			action := &engine.ReconcileAction{
+				ApplicationTag: *tag,
+				Type:           engine.ReconcileStart,
+				Reason:         "deployment is missing",
+			}
+			if !opt.DryRun {
+				if err := cli.redeployApplication(tag); err != nil {
+					action.Err = err.Error()
+				}
+			}
+			actions = append(actions, action)
+			continue
+		}
+
+		app, err := cli.store.GetApplication(tag)
+		if err != nil {
+			continue
+		}
+		replicas := replicaCount(app)
+		if deploy.Spec.Replicas != nil && *deploy.Spec.Replicas != replicas {
+			action := &engine.ReconcileAction{
+				ApplicationTag: *tag,
+				Type:           engine.ReconcileScale,
+				Reason:         fmt.Sprintf("deployment has %d replicas instead of %d", *deploy.Spec.Replicas, replicas),
+			}
+			if !opt.DryRun {
+				deploy.Spec.Replicas = &replicas
+				if _, err := deployCli.Update(deploy); err != nil {
+					action.Err = err.Error()
+				}
+			}
+			actions = append(actions, action)
+		}
+	}
+
+	log.Debugf("reconcile kube applications finished, %d drifts", len(actions))
+
+	return &engine.TaskResult{
+		Out: actions,
+	}
+}
+
+// redeployApplication creates the deployment of the started application
+// again, the service is created or updated as it may be left.
+func (cli *Client) redeployApplication(tag *engine.ApplicationTag) error {
+	app, err := cli.store.GetApplication(tag)
+	if err != nil {
+		return err
+	}
+	if err := checkImage(app.KubeSpec.Image, cli.allowedImages); err != nil {
+		return err
+	}
+
+	initLabels(app)
+
+	if err := cli.updateService(app); err != nil {
+		return err
+	}
+	if _, err := cli.kubeCli.AppsV1().Deployments(cli.ns).Create(loadDeploymentSpec(app)); err != nil {
+		return err
+	}
+
+	cli.store.UpdateApplicationRuntime(tag.Name, func(rt *engine.ApplicationRuntime) error {
+		rt.IsStarted = false
+		rt.Err = ""
+		return nil
+	})
+
+	cli.notifyEvent(&engine.ApplicationEvent{
+		ApplicationTag: *tag,
+		Type:           engine.ApplicationStarting,
+	})
+
+	return nil
+}
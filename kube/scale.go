@@ -0,0 +1,72 @@
+package kube
+
+import (
+	kubeErrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	engine "github.com/jimi36/app-engine"
+	"github.com/jimi36/app-engine/log"
+)
+
+func (cli *Client) ScaleApplication(ev *engine.TaskEvent) *engine.TaskResult {
+	req, ok := ev.In.(*engine.ScaleRequest)
+	if !ok {
+		log.Fatalf("scale kube application error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	tag := req.Tag
+
+	log.Debugf("scale kube application[%s] to %d......", tag.Tag(), req.Replicas)
+
+	if has, _ := cli.store.HasApplication(tag); !has {
+		log.Warnf("scale kube application[%s] error: %s", tag.Tag(), engine.ErrApplicationNoExisted.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrApplicationNoExisted,
+		}
+	}
+
+	// scale the deployment of the version to start, which may be still
+	// starting, and the deployment not created yet takes the replicas of the
+	// stored application
+	if rt, _ := cli.store.GetApplicationRuntime(tag.Name); rt != nil && rt.Version == tag.Version && rt.ToStart {
+		deployCli := cli.kubeCli.AppsV1().Deployments(cli.ns)
+		deploy, err := deployCli.Get(tag.Name, metaV1.GetOptions{})
+		if err == nil {
+			replicas := int32(req.Replicas)
+			deploy.Spec.Replicas = &replicas
+			_, err = deployCli.Update(deploy)
+		} else if kubeErrors.IsNotFound(err) {
+			err = nil
+		}
+		if err != nil {
+			log.Warnf("scale kube application[%s] error: %s", tag.Tag(), err.Error())
+			return &engine.TaskResult{
+				Err: err,
+			}
+		}
+	}
+
+	if err := cli.store.UpdateApplication(tag, func(app *engine.Application) {
+		app.Replicas = req.Replicas
+	}); err != nil {
+		log.Warnf("scale kube application[%s] error: %s", tag.Tag(), err.Error())
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
+
+	log.Debugf("scale kube application[%s] to %d finished", tag.Tag(), req.Replicas)
+
+	return &engine.TaskResult{}
+}
+
+// replicaCount returns the instance count of the application.
+func replicaCount(app *engine.Application) int32 {
+	if app.Replicas > 0 {
+		return int32(app.Replicas)
+	}
+	return 1
+}
@@ -2,6 +2,7 @@ package kube
 
 import (
 	coreV1 "k8s.io/api/core/v1"
+	kubeErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
@@ -22,6 +23,36 @@ func (cli *Client) newService(app *engine.Application) error {
 	return nil
 }
 
+// updateService updates the service to the spec of the application version,
+// it is created or deleted if only one version has the service.
+func (cli *Client) updateService(app *engine.Application) error {
+	svcCli := cli.kubeCli.CoreV1().Services(cli.ns)
+	spec := loadServiceSpec(app)
+
+	svc, err := svcCli.Get(app.Name, metav1.GetOptions{})
+	if err != nil {
+		if !kubeErrors.IsNotFound(err) {
+			return err
+		}
+		if spec == nil {
+			return nil
+		}
+		_, err = svcCli.Create(spec)
+		return err
+	}
+	if spec == nil {
+		return cli.deleteService(app.Name)
+	}
+
+	// keep the allocated cluster ip
+	svc.Labels = spec.Labels
+	svc.Spec.Selector = spec.Spec.Selector
+	svc.Spec.Type = spec.Spec.Type
+	svc.Spec.Ports = spec.Spec.Ports
+	_, err = svcCli.Update(svc)
+	return err
+}
+
 func (cli *Client) deleteService(name string) error {
 	if err := cli.kubeCli.CoreV1().Services(cli.ns).Delete(name, nil); err != nil {
 		return err
@@ -51,7 +82,7 @@ func loadServiceSpec(app *engine.Application) *coreV1.Service {
 			Labels: app.Labels,
 		},
 		Spec: coreV1.ServiceSpec{
-			Selector: app.Labels,
+			Selector: appSelector(app),
 			Type:     app.KubeSpec.Service.Type,
 			Ports:    ports,
 		},
@@ -1,9 +1,13 @@
 package kube
 
 import (
+	"strings"
+
 	appV1 "k8s.io/api/apps/v1"
 	coreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 
 	engine "github.com/jimi36/app-engine"
 	"github.com/jimi36/app-engine/log"
@@ -86,12 +90,31 @@ func (cli *Client) StartApplication(ev *engine.TaskEvent) *engine.TaskResult {
 		})
 	}
 
-	// init appliation labels
-	if app.Labels == nil {
-		app.Labels = make(map[string]string)
+	cli.notifyEvent(&engine.ApplicationEvent{
+		ApplicationTag: *tag,
+		Type:           engine.ApplicationStarting,
+	})
+
+	// the allow-list may be changed after the application is created
+	if err := checkImage(app.KubeSpec.Image, cli.allowedImages); err != nil {
+		log.Warnf("start kube application[%s] error: %s", tag.Tag(), err.Error())
+		cli.store.UpdateApplicationRuntime(tag.Name, func(rt *engine.ApplicationRuntime) error {
+			rt.ToStart = false
+			rt.IsStarted = false
+			rt.Err = err.Error()
+			return nil
+		})
+		cli.notifyEvent(&engine.ApplicationEvent{
+			ApplicationTag: *tag,
+			Type:           engine.ApplicationFailed,
+			Reason:         err.Error(),
+		})
+		return &engine.TaskResult{
+			Err: err,
+		}
 	}
-	app.Labels[labelEdgeApp] = app.Name
-	app.Labels[labelEdgeAppVersion] = app.Version
+
+	initLabels(app)
 
 	if err := cli.newService(app); err != nil {
 		log.Warnf("start kube application[%s] error: %s", tag.Tag(), err.Error())
@@ -101,12 +124,36 @@ func (cli *Client) StartApplication(ev *engine.TaskEvent) *engine.TaskResult {
 			rt.Err = err.Error()
 			return nil
 		})
+		cli.notifyEvent(&engine.ApplicationEvent{
+			ApplicationTag: *tag,
+			Type:           engine.ApplicationFailed,
+			Reason:         err.Error(),
+		})
 		return &engine.TaskResult{
 			Err: err,
 		}
 	}
 
 	spec := loadDeploymentSpec(app)
+	if err := ev.Context().Err(); err != nil {
+		// the caller has gone away, roll back the service
+		log.Warnf("start kube application[%s] error: %s", tag.Tag(), err.Error())
+		cli.deleteService(app.Name)
+		cli.store.UpdateApplicationRuntime(tag.Name, func(rt *engine.ApplicationRuntime) error {
+			rt.ToStart = false
+			rt.IsStarted = false
+			rt.Err = err.Error()
+			return nil
+		})
+		cli.notifyEvent(&engine.ApplicationEvent{
+			ApplicationTag: *tag,
+			Type:           engine.ApplicationFailed,
+			Reason:         err.Error(),
+		})
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
 	if _, err := cli.kubeCli.AppsV1().Deployments(cli.ns).Create(spec); err != nil {
 		log.Warnf("start kube application[%s] error: %s", tag.Tag(), err.Error())
 		cli.deleteService(app.Name)
@@ -116,6 +163,11 @@ func (cli *Client) StartApplication(ev *engine.TaskEvent) *engine.TaskResult {
 			rt.Err = err.Error()
 			return nil
 		})
+		cli.notifyEvent(&engine.ApplicationEvent{
+			ApplicationTag: *tag,
+			Type:           engine.ApplicationFailed,
+			Reason:         err.Error(),
+		})
 		return &engine.TaskResult{
 			Err: err,
 		}
@@ -126,6 +178,22 @@ func (cli *Client) StartApplication(ev *engine.TaskEvent) *engine.TaskResult {
 	return &engine.TaskResult{}
 }
 
+// initLabels adds the application name and version labels.
+func initLabels(app *engine.Application) {
+	if app.Labels == nil {
+		app.Labels = make(map[string]string)
+	}
+	app.Labels[labelEdgeApp] = app.Name
+	app.Labels[labelEdgeAppVersion] = app.Version
+}
+
+// appSelector selects the pods of all versions of the application.
+func appSelector(app *engine.Application) map[string]string {
+	return map[string]string{
+		labelEdgeApp: app.Name,
+	}
+}
+
 func loadDeploymentSpec(app *engine.Application) *appV1.Deployment {
 	deploy := &appV1.Deployment{
 		ObjectMeta: metaV1.ObjectMeta{
@@ -133,8 +201,11 @@ func loadDeploymentSpec(app *engine.Application) *appV1.Deployment {
 			Labels: app.Labels,
 		},
 	}
+	replicas := replicaCount(app)
+	deploy.Spec.Replicas = &replicas
+	// the selector is immutable, the version is not in it to upgrade the deployment
 	deploy.Spec.Selector = &metaV1.LabelSelector{
-		MatchLabels: app.Labels,
+		MatchLabels: appSelector(app),
 	}
 	deploy.Spec.Template = coreV1.PodTemplateSpec{
 		ObjectMeta: metaV1.ObjectMeta{
@@ -183,11 +254,86 @@ func loadContainerSpecs(app *engine.Application) []coreV1.Container {
 			Env:             env,
 			VolumeMounts:    volMounts,
 			Ports:           containerPorts,
+			Resources:       loadResourceSpec(app.KubeSpec.Resources),
+			LivenessProbe:   loadProbeSpec(app.KubeSpec.LivenessProbe),
+			ReadinessProbe:  loadProbeSpec(app.KubeSpec.ReadinessProbe),
 			ImagePullPolicy: coreV1.PullIfNotPresent,
 		},
 	}
 }
 
+func loadResourceSpec(res *engine.ResourceSpec) coreV1.ResourceRequirements {
+	var reqs coreV1.ResourceRequirements
+	if res == nil {
+		return reqs
+	}
+
+	limits := coreV1.ResourceList{}
+	if res.CpuMillis > 0 {
+		limits[coreV1.ResourceCPU] = *resource.NewMilliQuantity(res.CpuMillis, resource.DecimalSI)
+	}
+	if res.MemoryMB > 0 {
+		limits[coreV1.ResourceMemory] = *resource.NewQuantity(res.MemoryMB*1024*1024, resource.BinarySI)
+	}
+	if len(limits) > 0 {
+		reqs.Limits = limits
+	}
+
+	requests := coreV1.ResourceList{}
+	if res.CpuRequestMillis > 0 {
+		requests[coreV1.ResourceCPU] = *resource.NewMilliQuantity(res.CpuRequestMillis, resource.DecimalSI)
+	}
+	if res.MemoryRequestMB > 0 {
+		requests[coreV1.ResourceMemory] = *resource.NewQuantity(res.MemoryRequestMB*1024*1024, resource.BinarySI)
+	}
+	if len(requests) > 0 {
+		reqs.Requests = requests
+	}
+
+	return reqs
+}
+
+func loadProbeSpec(probe *engine.Probe) *coreV1.Probe {
+	if probe == nil {
+		return nil
+	}
+
+	spec := &coreV1.Probe{
+		InitialDelaySeconds: int32(probe.InitialDelaySeconds),
+		PeriodSeconds:       int32(probe.PeriodSeconds),
+		TimeoutSeconds:      int32(probe.TimeoutSeconds),
+		FailureThreshold:    int32(probe.FailureThreshold),
+		SuccessThreshold:    int32(probe.SuccessThreshold),
+	}
+	switch {
+	case probe.Exec != nil:
+		spec.Exec = &coreV1.ExecAction{
+			Command: probe.Exec.Command,
+		}
+	case probe.HttpGet != nil:
+		var headers []coreV1.HTTPHeader
+		for name, value := range probe.HttpGet.Headers {
+			headers = append(headers, coreV1.HTTPHeader{
+				Name:  name,
+				Value: value,
+			})
+		}
+		spec.HTTPGet = &coreV1.HTTPGetAction{
+			Host:        probe.HttpGet.Host,
+			Port:        intstr.FromInt(int(probe.HttpGet.Port)),
+			Path:        probe.HttpGet.Path,
+			Scheme:      coreV1.URIScheme(strings.ToUpper(probe.HttpGet.Scheme)),
+			HTTPHeaders: headers,
+		}
+	case probe.TcpSocket != nil:
+		spec.TCPSocket = &coreV1.TCPSocketAction{
+			Host: probe.TcpSocket.Host,
+			Port: intstr.FromInt(int(probe.TcpSocket.Port)),
+		}
+	}
+	return spec
+}
+
 func loadVolumeSpecs(app *engine.Application) []coreV1.Volume {
 	var vols []coreV1.Volume
 	for _, v := range app.KubeSpec.Volumes {
@@ -43,7 +43,12 @@ func (cli *Client) StopApplication(ev *engine.TaskEvent) *engine.TaskResult {
 		log.Warnf("stop kube application[%s] error: %s", tag.Tag(), err.Error())
 	}
 
-	log.Debugf("stop kube application[%s] finished: %s", tag.Tag())
+	cli.notifyEvent(&engine.ApplicationEvent{
+		ApplicationTag: *tag,
+		Type:           engine.ApplicationStopped,
+	})
+
+	log.Debugf("stop kube application[%s] finished", tag.Tag())
 
 	return &engine.TaskResult{}
 }
@@ -0,0 +1,32 @@
+package kube
+
+import (
+	engine "github.com/jimi36/app-engine"
+	"github.com/jimi36/app-engine/log"
+)
+
+// PrefetchApplication is not supported, images are pulled by the kubelet.
+func (cli *Client) PrefetchApplication(ev *engine.TaskEvent) *engine.TaskResult {
+	tag, ok := ev.In.(*engine.ApplicationTag)
+	if !ok {
+		log.Fatalf("prefetch kube application error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	log.Warnf("prefetch kube application[%s] error: %s", tag.Tag(), engine.ErrNotImplement.Error())
+
+	return &engine.TaskResult{
+		Err: engine.ErrNotImplement,
+	}
+}
+
+// CollectGarbage is not supported, the objects are deleted with the application.
+func (cli *Client) CollectGarbage(ev *engine.TaskEvent) *engine.TaskResult {
+	log.Warnf("collect kube garbage error: %s", engine.ErrNotImplement.Error())
+
+	return &engine.TaskResult{
+		Err: engine.ErrNotImplement,
+	}
+}
@@ -0,0 +1,253 @@
+package kube
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	appV1 "k8s.io/api/apps/v1"
+	coreV1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	engine "github.com/jimi36/app-engine"
+	"github.com/jimi36/app-engine/log"
+)
+
+const (
+	rolloutCheckInterval = time.Second * 2
+)
+
+type upgradeState struct {
+	from *engine.Application
+	to   *engine.Application
+	// deployment before upgrading
+	oldDeploy *appV1.Deployment
+	reason    string
+}
+
+// UpgradeApplication updates the pod template of the deployment to the new
+// version, and waits for the rollout in background, the result is sent to
+// the returned channel. The deployment is rolled back if the rollout fails.
+func (cli *Client) UpgradeApplication(ev *engine.TaskEvent) *engine.TaskResult {
+	req, ok := ev.In.(*engine.UpgradeRequest)
+	if !ok {
+		log.Fatalf("upgrade kube application error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	fromTag := &engine.ApplicationTag{Name: req.Name, Version: req.FromVersion}
+	toTag := &engine.ApplicationTag{Name: req.Name, Version: req.ToVersion}
+
+	log.Debugf("upgrade kube application[%s] to %s......", fromTag.Tag(), toTag.Version)
+
+	if rt, _ := cli.store.GetApplicationRuntime(req.Name); rt == nil || rt.Version != req.FromVersion || !rt.ToStart {
+		log.Warnf("upgrade kube application[%s] error: %s", fromTag.Tag(), engine.ErrApplicationNotStarted.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrApplicationNotStarted,
+		}
+	}
+
+	from, err := cli.store.GetApplication(fromTag)
+	if err != nil {
+		log.Warnf("upgrade kube application[%s] error: %s", fromTag.Tag(), err.Error())
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
+	to, err := cli.store.GetApplication(toTag)
+	if err != nil || to.KubeSpec == nil {
+		log.Warnf("upgrade kube application[%s] error: %s", toTag.Tag(), engine.ErrApplicationNoExisted.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrApplicationNoExisted,
+		}
+	}
+	if err := checkImage(to.KubeSpec.Image, cli.allowedImages); err != nil {
+		log.Warnf("upgrade kube application[%s] error: %s", toTag.Tag(), err.Error())
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
+	initLabels(from)
+	initLabels(to)
+
+	deployCli := cli.kubeCli.AppsV1().Deployments(cli.ns)
+	deploy, err := deployCli.Get(req.Name, metaV1.GetOptions{})
+	if err != nil {
+		log.Warnf("upgrade kube application[%s] error: %s", fromTag.Tag(), err.Error())
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
+	// the deployment created with the version in its selector can't be upgraded
+	for k, v := range deploy.Spec.Selector.MatchLabels {
+		if to.Labels[k] != v {
+			err := errors.New("deployment selector includes the version, restart the application before upgrading")
+			log.Warnf("upgrade kube application[%s] error: %s", fromTag.Tag(), err.Error())
+			return &engine.TaskResult{
+				Err: err,
+			}
+		}
+	}
+
+	state := &upgradeState{
+		from:      from,
+		to:        to,
+		oldDeploy: deploy.DeepCopy(),
+	}
+
+	spec := loadDeploymentSpec(to)
+	deploy.Labels = spec.Labels
+	deploy.Spec.Replicas = spec.Spec.Replicas
+	deploy.Spec.Template = spec.Spec.Template
+	deploy, err = deployCli.Update(deploy)
+	if err != nil {
+		log.Warnf("upgrade kube application[%s] error: %s", toTag.Tag(), err.Error())
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
+	if err := cli.updateService(to); err != nil {
+		log.Warnf("upgrade kube application[%s] service error: %s", toTag.Tag(), err.Error())
+	}
+
+	cli.store.UpdateApplicationRuntime(req.Name, func(rt *engine.ApplicationRuntime) error {
+		rt.Version = req.ToVersion
+		rt.ToStart = true
+		rt.IsStarted = false
+		rt.Err = ""
+		return nil
+	})
+
+	cli.notifyEvent(&engine.ApplicationEvent{
+		ApplicationTag: *toTag,
+		Type:           engine.ApplicationStarting,
+	})
+
+	// the rollout is aborted when the caller has gone away or the client is closed
+	ctx, cancel := context.WithCancel(ev.Context())
+	go func() {
+		select {
+		case <-cli.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	done := make(chan error, 1)
+	generation := deploy.Generation
+	go func() {
+		defer cancel()
+
+		err := cli.waitRollout(ctx, req.Name, generation)
+		if err != nil && cli.ctx.Err() == nil {
+			log.Warnf("upgrade kube application[%s] error: %s, roll back to %s", toTag.Tag(), err.Error(), fromTag.Version)
+			state.reason = "upgrade failed: " + err.Error()
+			if _, err := cli.postTaskEvent(cli.ctx, state, cli.rollbackUpgrade, false); err != nil {
+				log.Warnf("roll back kube application[%s] error: %s", fromTag.Tag(), err.Error())
+			}
+		}
+		done <- err
+	}()
+
+	log.Debugf("upgrade kube application[%s] to %s finished", fromTag.Tag(), toTag.Version)
+
+	return &engine.TaskResult{
+		Out: (<-chan error)(done),
+	}
+}
+
+// waitRollout waits until all replicas of the deployment are updated and available.
+func (cli *Client) waitRollout(ctx context.Context, name string, generation int64) error {
+	deployCli := cli.kubeCli.AppsV1().Deployments(cli.ns)
+	for {
+		deploy, err := deployCli.Get(name, metaV1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		replicas := int32(1)
+		if deploy.Spec.Replicas != nil {
+			replicas = *deploy.Spec.Replicas
+		}
+		st := deploy.Status
+		if st.ObservedGeneration >= generation &&
+			st.UpdatedReplicas == replicas &&
+			st.Replicas == replicas &&
+			st.AvailableReplicas == replicas {
+			return nil
+		}
+		for _, cond := range st.Conditions {
+			if cond.Type == appV1.DeploymentProgressing && cond.Status == coreV1.ConditionFalse {
+				return errors.Errorf("deployment is not progressing: %s", cond.Message)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "wait deployment rollout")
+		case <-time.After(rolloutCheckInterval):
+		}
+	}
+}
+
+func (cli *Client) rollbackUpgrade(ev *engine.TaskEvent) *engine.TaskResult {
+	state, ok := ev.In.(*upgradeState)
+	if !ok {
+		log.Fatalf("roll back kube application error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	from := &state.from.ApplicationTag
+
+	log.Debugf("roll back kube application[%s]......", from.Tag())
+
+	// the application may be stopped while upgrading
+	if rt, _ := cli.store.GetApplicationRuntime(from.Name); rt == nil || rt.Version != state.to.Version {
+		log.Warnf("roll back kube application[%s] error: %s", from.Tag(), engine.ErrApplicationNotStarted.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrApplicationNotStarted,
+		}
+	}
+
+	deployCli := cli.kubeCli.AppsV1().Deployments(cli.ns)
+	deploy, err := deployCli.Get(from.Name, metaV1.GetOptions{})
+	if err == nil {
+		deploy.Labels = state.oldDeploy.Labels
+		deploy.Spec.Template = state.oldDeploy.Spec.Template
+		_, err = deployCli.Update(deploy)
+	}
+	if err != nil {
+		log.Warnf("roll back kube application[%s] error: %s", from.Tag(), err.Error())
+		cli.store.UpdateApplicationRuntime(from.Name, func(rt *engine.ApplicationRuntime) error {
+			rt.Err = state.reason + ", roll back error: " + err.Error()
+			return nil
+		})
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
+	if err := cli.updateService(state.from); err != nil {
+		log.Warnf("roll back kube application[%s] service error: %s", from.Tag(), err.Error())
+	}
+
+	cli.store.UpdateApplicationRuntime(from.Name, func(rt *engine.ApplicationRuntime) error {
+		rt.Version = from.Version
+		rt.IsStarted = true
+		rt.Err = state.reason
+		return nil
+	})
+
+	cli.notifyEvent(&engine.ApplicationEvent{
+		ApplicationTag: state.to.ApplicationTag,
+		Type:           engine.ApplicationFailed,
+		Reason:         state.reason,
+	})
+
+	log.Debugf("roll back kube application[%s] finished", from.Tag())
+
+	return &engine.TaskResult{}
+}
@@ -0,0 +1,451 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+type ManifestKind string
+
+const (
+	KindApplication ManifestKind = "Application"
+	KindConfig      ManifestKind = "Config"
+)
+
+var (
+	// the line of the yaml error, which is relative to the document
+	yamlErrorLine = regexp.MustCompile(`line (\d+): (.*)`)
+	// the field name of the json error
+	jsonErrorField = regexp.MustCompile(`unknown field "([^"]+)"`)
+	// the document separator of the multi-document yaml
+	yamlSeparator = regexp.MustCompile(`^---(\s.*)?$`)
+)
+
+// ManifestError is an error of the manifest document at the line.
+type ManifestError struct {
+	File string `json:"file,omitempty"`
+	Line int    `json:"line,omitempty"`
+	Msg  string `json:"msg,omitempty"`
+}
+
+func (e *ManifestError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+// ManifestErrors are the errors of all the invalid documents.
+type ManifestErrors []*ManifestError
+
+func (es ManifestErrors) Error() string {
+	msgs := make([]string, 0, len(es))
+	for _, e := range es {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// manifestPos is where the object is defined.
+type manifestPos struct {
+	file string
+	line int
+}
+
+// manifestDoc is a yaml or json document of the manifest file.
+type manifestDoc struct {
+	file string
+	// first line of the document in the file
+	line int
+	// lines of the document
+	lines []string
+}
+
+func (d *manifestDoc) errorf(line int, format string, args ...interface{}) *ManifestError {
+	return &ManifestError{
+		File: d.file,
+		Line: line,
+		Msg:  fmt.Sprintf(format, args...),
+	}
+}
+
+// fieldLine returns the line of the first key of the field in the document,
+// or the first line of the document if it's not found.
+func (d *manifestDoc) fieldLine(field string) int {
+	if i := strings.LastIndex(field, "."); i >= 0 {
+		field = field[i+1:]
+	}
+	if len(field) > 0 {
+		key := regexp.MustCompile(`^\s*(-\s+)?["']?` + regexp.QuoteMeta(field) + `["']?\s*:`)
+		for i, l := range d.lines {
+			if key.MatchString(l) {
+				return d.line + i
+			}
+		}
+	}
+	return d.line
+}
+
+// LoadManifest loads the manifest file, or the *.yaml, *.yml and *.json files
+// of the folder in name order. The errors of all the invalid documents are
+// returned as ManifestErrors.
+func LoadManifest(path string) (*Manifest, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{path}
+	if fi.IsDir() {
+		if files, err = manifestFiles(path); err != nil {
+			return nil, err
+		}
+	}
+
+	docs := []*manifestDoc{}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		fdocs, err := splitManifest(file, data)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, fdocs...)
+	}
+
+	return parseManifestDocs(docs)
+}
+
+// ParseManifest parses the multi-document yaml, or the json documents if the
+// file name ends with .json. The file name is only used in the errors.
+func ParseManifest(file string, data []byte) (*Manifest, error) {
+	docs, err := splitManifest(file, data)
+	if err != nil {
+		return nil, err
+	}
+	return parseManifestDocs(docs)
+}
+
+// manifestFiles returns the manifest files of the folder, the hidden ones are ignored.
+func manifestFiles(dir string) ([]string, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, fi := range fis {
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(fi.Name())) {
+		case ".yaml", ".yml", ".json":
+			files = append(files, filepath.Join(dir, fi.Name()))
+		}
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+func splitManifest(file string, data []byte) ([]*manifestDoc, error) {
+	if strings.ToLower(filepath.Ext(file)) == ".json" {
+		return splitJsonManifest(file, data)
+	}
+
+	var docs []*manifestDoc
+	doc := &manifestDoc{file: file, line: 1}
+	for i, l := range strings.Split(string(data), "\n") {
+		l = strings.TrimSuffix(l, "\r")
+		if yamlSeparator.MatchString(l) || l == "..." {
+			docs = append(docs, doc)
+			doc = &manifestDoc{file: file, line: i + 2}
+			continue
+		}
+		doc.lines = append(doc.lines, l)
+	}
+	docs = append(docs, doc)
+
+	return docs, nil
+}
+
+// splitJsonManifest splits the json values, which are the documents.
+func splitJsonManifest(file string, data []byte) ([]*manifestDoc, error) {
+	var docs []*manifestDoc
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var raw json.RawMessage
+		start := dec.InputOffset()
+		if err := dec.Decode(&raw); err != nil {
+			if err == io.EOF {
+				break
+			}
+			offset := dec.InputOffset()
+			if se, ok := err.(*json.SyntaxError); ok {
+				offset = se.Offset
+			}
+			return nil, ManifestErrors{{
+				File: file,
+				Line: lineOf(data, offset),
+				Msg:  err.Error(),
+			}}
+		}
+		// skip the spaces before the value
+		start += int64(len(data[start:]) - len(bytes.TrimLeft(data[start:], " \t\r\n")))
+		docs = append(docs, &manifestDoc{
+			file:  file,
+			line:  lineOf(data, start),
+			lines: strings.Split(string(raw), "\n"),
+		})
+	}
+
+	return docs, nil
+}
+
+func lineOf(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+func parseManifestDocs(docs []*manifestDoc) (*Manifest, error) {
+	manifest := &Manifest{}
+	var errs ManifestErrors
+
+	// where the objects are defined
+	configs := make(map[string]*manifestPos)
+	apps := make(map[string]*manifestPos)
+	running := make(map[string]*manifestPos)
+
+	for _, doc := range docs {
+		objs, err := parseManifestDoc(doc)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, obj := range objs {
+			switch o := obj.(type) {
+			case *Config:
+				at := &manifestPos{doc.file, doc.fieldLine("name")}
+				if first, found := configs[o.Name]; found {
+					errs = append(errs, doc.errorf(at.line, "config %s is duplicated, first defined at %s:%d", o.Name, first.file, first.line))
+					continue
+				}
+				configs[o.Name] = at
+				manifest.Configs = append(manifest.Configs, o)
+			case *ManifestApplication:
+				at := &manifestPos{doc.file, doc.fieldLine("name")}
+				if first, found := apps[o.Tag()]; found {
+					errs = append(errs, doc.errorf(at.line, "application %s is duplicated, first defined at %s:%d", o.Tag(), first.file, first.line))
+					continue
+				}
+				if first, found := running[o.Name]; found && o.Running {
+					errs = append(errs, doc.errorf(doc.fieldLine("running"), "application %s has another running version at %s:%d", o.Name, first.file, first.line))
+					continue
+				}
+				apps[o.Tag()] = at
+				if o.Running {
+					running[o.Name] = &manifestPos{doc.file, doc.fieldLine("running")}
+				}
+				manifest.Applications = append(manifest.Applications, o)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return manifest, nil
+}
+
+// parseManifestDoc parses the document, which is an object or a list of objects.
+func parseManifestDoc(doc *manifestDoc) ([]interface{}, *ManifestError) {
+	data, err := yaml.YAMLToJSONStrict([]byte(strings.Join(doc.lines, "\n")))
+	if err != nil {
+		line, msg := doc.line, strings.TrimPrefix(err.Error(), "yaml: ")
+		if m := yamlErrorLine.FindStringSubmatch(msg); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			line, msg = doc.line+n-1, m[2]
+		}
+		return nil, doc.errorf(line, "%s", msg)
+	}
+
+	data = bytes.TrimSpace(data)
+	switch {
+	case len(data) == 0 || bytes.Equal(data, []byte("null")):
+		// empty document
+		return nil, nil
+	case data[0] == '[':
+		var items []json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, doc.errorf(doc.line, "%s", err.Error())
+		}
+		var objs []interface{}
+		for _, item := range items {
+			obj, err := parseManifestObject(doc, item)
+			if err != nil {
+				return nil, err
+			}
+			objs = append(objs, obj)
+		}
+		return objs, nil
+	default:
+		obj, err := parseManifestObject(doc, data)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{obj}, nil
+	}
+}
+
+func parseManifestObject(doc *manifestDoc, data []byte) (interface{}, *ManifestError) {
+	var kind struct {
+		Kind ManifestKind `json:"kind"`
+	}
+	if err := json.Unmarshal(data, &kind); err != nil {
+		return nil, doc.errorf(doc.line, "document is not an object")
+	}
+
+	switch kind.Kind {
+	case KindApplication:
+		obj := &struct {
+			Kind ManifestKind `json:"kind"`
+			ManifestApplication
+		}{}
+		if err := decodeStrict(data, obj); err != nil {
+			return nil, decodeError(doc, err)
+		}
+		if field, err := validateApplication(&obj.Application); err != nil {
+			return nil, doc.errorf(doc.fieldLine(field), "%s", err.Error())
+		}
+		return &obj.ManifestApplication, nil
+	case KindConfig:
+		obj := &struct {
+			Kind ManifestKind `json:"kind"`
+			Config
+		}{}
+		if err := decodeStrict(data, obj); err != nil {
+			return nil, decodeError(doc, err)
+		}
+		if len(obj.Name) == 0 {
+			return nil, doc.errorf(doc.line, "config name is required")
+		}
+		return &obj.Config, nil
+	case "":
+		return nil, doc.errorf(doc.line, "kind is required, %s or %s", KindApplication, KindConfig)
+	default:
+		return nil, doc.errorf(doc.fieldLine("kind"), "kind %s not supported", kind.Kind)
+	}
+}
+
+func decodeStrict(data []byte, obj interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(obj)
+}
+
+func decodeError(doc *manifestDoc, err error) *ManifestError {
+	if te, ok := err.(*json.UnmarshalTypeError); ok {
+		return doc.errorf(doc.fieldLine(te.Field), "%s should be %s, not %s", te.Field, te.Type.String(), te.Value)
+	}
+	if m := jsonErrorField.FindStringSubmatch(err.Error()); m != nil {
+		return doc.errorf(doc.fieldLine(m[1]), "unknown field %s", m[1])
+	}
+	return doc.errorf(doc.line, "%s", strings.TrimPrefix(err.Error(), "json: "))
+}
+
+// ValidateApplication validates the application regardless of the engine,
+// the engine specific fields are validated when it's created.
+func ValidateApplication(app *Application) error {
+	if _, err := validateApplication(app); err != nil {
+		return err
+	}
+	return nil
+}
+
+// NativeReservedNames are the folders under the base path of the native
+// engine, which are not application folders.
+var NativeReservedNames = map[string]bool{
+	"db":     true,
+	"cache":  true,
+	"config": true,
+}
+
+// CheckFolderName checks the application name, version or config name which
+// is used as a folder name under the base path of the native engine.
+func CheckFolderName(name string) error {
+	if len(name) == 0 || name == "." || name == ".." || strings.ContainsAny(name, "/\\\x00") {
+		return fmt.Errorf("%q is not a valid folder name", name)
+	}
+	return nil
+}
+
+// validateApplication returns the invalid field with the error.
+func validateApplication(app *Application) (string, error) {
+	switch {
+	case len(app.Name) == 0:
+		return "", fmt.Errorf("application name is required")
+	case len(app.Version) == 0:
+		return "name", fmt.Errorf("application %s version is required", app.Name)
+	}
+	if err := CheckFolderName(app.Name); err != nil {
+		return "name", fmt.Errorf("application name %s", err.Error())
+	}
+	if err := CheckFolderName(app.Version); err != nil {
+		return "version", fmt.Errorf("application version %s", err.Error())
+	}
+	if app.Replicas < 0 {
+		return "replicas", fmt.Errorf("replicas must not be negative")
+	}
+
+	switch app.Type {
+	case Native:
+		if app.KubeSpec != nil {
+			return "kubeSpec", fmt.Errorf("kubeSpec is not for native application")
+		}
+		if NativeReservedNames[app.Name] {
+			return "name", fmt.Errorf("application name %s is reserved", app.Name)
+		}
+		spec := app.NativeSpec
+		if spec == nil || len(spec.Command) == 0 {
+			return "nativeSpec", fmt.Errorf("nativeSpec.command is required")
+		}
+		if spec.Restart != nil {
+			switch spec.Restart.Type {
+			case "", RestartNever, RestartOnFailure, RestartAlways:
+			default:
+				return "restart", fmt.Errorf("restart type should be %s, %s or %s", RestartNever, RestartOnFailure, RestartAlways)
+			}
+		}
+		switch spec.UpgradeStrategy {
+		case "", UpgradeStartFirst, UpgradeStopFirst:
+		default:
+			return "upgradeStrategy", fmt.Errorf("upgrade strategy should be %s or %s", UpgradeStartFirst, UpgradeStopFirst)
+		}
+	case Kube:
+		if app.NativeSpec != nil {
+			return "nativeSpec", fmt.Errorf("nativeSpec is not for kube application")
+		}
+		if app.KubeSpec == nil || len(app.KubeSpec.Image) == 0 {
+			return "kubeSpec", fmt.Errorf("kubeSpec.image is required")
+		}
+	case "":
+		return "", fmt.Errorf("application type is required, %s or %s", Native, Kube)
+	default:
+		return "type", fmt.Errorf("application type %s not supported", app.Type)
+	}
+
+	return "", nil
+}
@@ -0,0 +1,188 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+// parseManifestErrors parses the manifest which must be invalid.
+func parseManifestErrors(t *testing.T, file, data string) ManifestErrors {
+	_, err := ParseManifest(file, []byte(data))
+	errs, ok := err.(ManifestErrors)
+	if !ok {
+		t.Fatalf("parse %s error %v, want manifest errors", file, err)
+	}
+	return errs
+}
+
+func checkManifestError(t *testing.T, e *ManifestError, file string, line int, msg string) {
+	if e.File != file || e.Line != line || !strings.Contains(e.Msg, msg) {
+		t.Errorf("error %s, want %s:%d: ...%s...", e.Error(), file, line, msg)
+	}
+}
+
+func TestParseManifestYAML(t *testing.T) {
+	data := `kind: Config
+name: c1
+data:
+  k: v
+--- # the applications
+kind: Application
+name: a
+version: "1"
+type: native
+running: true
+nativeSpec:
+  command: ["/bin/true"]
+...
+kind: Application
+name: a
+version: "2"
+type: native
+nativeSpec:
+  command: ["/bin/true"]
+`
+	manifest, err := ParseManifest("m.yaml", []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Configs) != 1 || manifest.Configs[0].Data["k"] != "v" {
+		t.Errorf("configs %+v", manifest.Configs)
+	}
+	if len(manifest.Applications) != 2 || !manifest.Applications[0].Running || manifest.Applications[1].Version != "2" {
+		t.Errorf("applications %+v", manifest.Applications)
+	}
+
+	// the lines are of the file, not of the document
+	errs := parseManifestErrors(t, "m.yaml", `kind: Config
+name: c1
+---
+kind: Application
+name: a
+version: "1"
+type: native
+nativeSpec:
+  command: ["/bin/true"]
+  unknown: 1
+---
+kind: Application
+name: b
+version: "1"
+type: native
+replicas: many
+nativeSpec:
+  command: ["/bin/true"]
+---
+kind: Config
+name: c2
+data: [
+`)
+	if len(errs) != 3 {
+		t.Fatalf("%d errors, want 3: %v", len(errs), errs)
+	}
+	checkManifestError(t, errs[0], "m.yaml", 10, "unknown field unknown")
+	checkManifestError(t, errs[1], "m.yaml", 16, "replicas should be int")
+	if errs[2].Line < 20 {
+		t.Errorf("syntax error %s is not in the last document", errs[2].Error())
+	}
+}
+
+func TestParseManifestJSON(t *testing.T) {
+	data := `{"kind": "Config", "name": "c1"}
+[
+  {"kind": "Application", "name": "a", "version": "1", "type": "native",
+   "nativeSpec": {"command": ["/bin/true"]}},
+  {"kind": "Application", "name": "b", "version": "1", "type": "kube",
+   "kubeSpec": {"image": "nginx"}}
+]
+`
+	manifest, err := ParseManifest("m.json", []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Configs) != 1 || len(manifest.Applications) != 2 {
+		t.Errorf("parsed %d configs and %d applications, want 1 and 2", len(manifest.Configs), len(manifest.Applications))
+	}
+
+	// the line of the second value, not of the first
+	errs := parseManifestErrors(t, "m.json", `{"kind": "Config", "name": "c1"}
+
+{"kind": "Config",
+ "name": "c2",
+ "labels": {"k": 1}}
+`)
+	if len(errs) != 1 {
+		t.Fatalf("%d errors, want 1: %v", len(errs), errs)
+	}
+	checkManifestError(t, errs[0], "m.json", 3, "labels.k should be string")
+
+	errs = parseManifestErrors(t, "m.json", `{"kind": "Config", "name": "c1"}
+{"kind": "Config", "name": }`)
+	checkManifestError(t, errs[0], "m.json", 2, "invalid character")
+}
+
+func TestParseManifestDuplicated(t *testing.T) {
+	errs := parseManifestErrors(t, "m.yaml", `kind: Application
+name: a
+version: "1"
+type: native
+running: true
+nativeSpec:
+  command: ["/bin/true"]
+---
+kind: Application
+name: a
+version: "1"
+type: native
+nativeSpec:
+  command: ["/bin/true"]
+---
+kind: Application
+name: a
+version: "2"
+type: native
+running: true
+nativeSpec:
+  command: ["/bin/true"]
+---
+kind: Config
+name: c1
+---
+kind: Config
+name: c1
+`)
+	if len(errs) != 3 {
+		t.Fatalf("%d errors, want 3: %v", len(errs), errs)
+	}
+	checkManifestError(t, errs[0], "m.yaml", 10, "application a-1 is duplicated, first defined at m.yaml:2")
+	checkManifestError(t, errs[1], "m.yaml", 20, "another running version at m.yaml:5")
+	checkManifestError(t, errs[2], "m.yaml", 28, "config c1 is duplicated, first defined at m.yaml:25")
+}
+
+func TestValidateApplicationName(t *testing.T) {
+	for _, name := range []string{".", "..", "a/b", `a\b`, "a\x00"} {
+		if err := CheckFolderName(name); err == nil {
+			t.Errorf("folder name %q should be invalid", name)
+		}
+	}
+
+	errs := parseManifestErrors(t, "m.yaml", `kind: Application
+name: db
+version: "1"
+type: native
+nativeSpec:
+  command: ["/bin/true"]
+---
+kind: Application
+name: app
+version: ../1
+type: native
+nativeSpec:
+  command: ["/bin/true"]
+`)
+	if len(errs) != 2 {
+		t.Fatalf("%d errors, want 2: %v", len(errs), errs)
+	}
+	checkManifestError(t, errs[0], "m.yaml", 2, "application name db is reserved")
+	checkManifestError(t, errs[1], "m.yaml", 10, "is not a valid folder name")
+}
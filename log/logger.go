@@ -58,3 +58,13 @@ func Errorln(args ...interface{}) {
 func Fatalln(args ...interface{}) {
 	logger.Fatalln(args...)
 }
+
+// SetLevel sets the level of the logger, such as debug, info, warn and error.
+func SetLevel(level string) error {
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	logger.SetLevel(lvl)
+	return nil
+}
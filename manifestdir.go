@@ -0,0 +1,224 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jimi36/app-engine/log"
+)
+
+const (
+	// DefaultManifestDir is the default folder of the manifest files
+	DefaultManifestDir = "/etc/app-engine/apps.d"
+	// DefaultManifestDirInterval is the default interval to check the manifest files
+	DefaultManifestDirInterval = time.Second * 5
+	// ManifestSourceLabel is the label of the objects applied from the manifest folder
+	ManifestSourceLabel = "app-engine.io/source"
+)
+
+type ManifestDirOption struct {
+	// DefaultManifestDir if empty
+	Dir string `json:"dir,omitempty"`
+	// DefaultManifestDirInterval if 0
+	Interval time.Duration `json:"interval,omitempty"`
+	// value of ManifestSourceLabel, the folder name if empty
+	Source string `json:"source,omitempty"`
+	// buffer size of the sync channel
+	BufferSize int `json:"bufferSize,omitempty"`
+}
+
+type ManifestSync struct {
+	Time    time.Time      `json:"time,omitempty"`
+	Results []*ApplyResult `json:"results,omitempty"`
+	// error of loading or applying the manifest files
+	Err error `json:"-"`
+}
+
+// ManifestDirWatcher applies the manifest files of the folder when they are
+// added, changed or removed. The applied objects are labeled with
+// ManifestSourceLabel, and the labeled ones which are not in the folder any
+// more are removed.
+type ManifestDirWatcher struct {
+	cli  *Client
+	opt  ManifestDirOption
+	ch   chan ManifestSync
+	stop chan struct{}
+	once sync.Once
+	// digest of the applied files
+	digest string
+}
+
+// Syncs returns the sync channel, it is closed when the watcher is stopped.
+// Syncs are dropped if the channel is full.
+func (w *ManifestDirWatcher) Syncs() <-chan ManifestSync {
+	return w.ch
+}
+
+// Stop stops watching the folder, the applied objects are kept.
+func (w *ManifestDirWatcher) Stop() {
+	w.once.Do(func() {
+		close(w.stop)
+	})
+}
+
+// WatchManifestDir applies the manifest files of the folder now and whenever
+// they are changed, until the watcher or the client is stopped.
+func (c *Client) WatchManifestDir(opt *ManifestDirOption) (*ManifestDirWatcher, error) {
+	w := &ManifestDirWatcher{
+		cli:  c,
+		stop: make(chan struct{}),
+	}
+	if opt != nil {
+		w.opt = *opt
+	}
+	if len(w.opt.Dir) == 0 {
+		w.opt.Dir = DefaultManifestDir
+	}
+	if w.opt.Interval <= 0 {
+		w.opt.Interval = DefaultManifestDirInterval
+	}
+	if len(w.opt.Source) == 0 {
+		w.opt.Source = filepath.Base(w.opt.Dir)
+	}
+	if w.opt.BufferSize <= 0 {
+		w.opt.BufferSize = DefaultWatchBufferSize
+	}
+	w.ch = make(chan ManifestSync, w.opt.BufferSize)
+
+	c.mu.RLock()
+	state := c.state
+	c.mu.RUnlock()
+	if state != clientStarted {
+		return nil, ErrClientNotStarted
+	}
+
+	go w.loop()
+
+	return w, nil
+}
+
+func (w *ManifestDirWatcher) loop() {
+	defer close(w.ch)
+
+	ticker := time.NewTicker(w.opt.Interval)
+	defer ticker.Stop()
+
+	for {
+		w.sync()
+
+		select {
+		case <-w.stop:
+			return
+		case <-w.cli.quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sync applies the manifest files if they are changed since the last sync.
+func (w *ManifestDirWatcher) sync() {
+	if _, err := os.Stat(w.opt.Dir); err != nil {
+		// the missing folder is not taken as the empty one,
+		// which prunes all the objects of the source
+		log.Warnf("watch manifest folder[%s] error: %s", w.opt.Dir, err.Error())
+		return
+	}
+
+	digest, err := manifestDigest(w.opt.Dir)
+	if err != nil {
+		log.Warnf("watch manifest folder[%s] error: %s", w.opt.Dir, err.Error())
+		return
+	}
+	if digest == w.digest {
+		return
+	}
+
+	log.Debugf("sync manifest folder[%s]......", w.opt.Dir)
+
+	s := ManifestSync{Time: time.Now()}
+	// the invalid files are applied after they are changed again
+	w.digest = digest
+
+	manifest, err := LoadManifest(w.opt.Dir)
+	if err != nil {
+		log.Warnf("load manifest folder[%s] error: %s", w.opt.Dir, err.Error())
+		s.Err = err
+		w.send(s)
+		return
+	}
+
+	selector := map[string]string{ManifestSourceLabel: w.opt.Source}
+	for _, config := range manifest.Configs {
+		config.Labels = withLabels(config.Labels, selector)
+	}
+	for _, app := range manifest.Applications {
+		app.Labels = withLabels(app.Labels, selector)
+	}
+	manifest.Prune = true
+	manifest.PruneSelector = selector
+
+	ctx, cancel := context.WithTimeout(context.Background(), TaskHandleTimeout)
+	defer cancel()
+	s.Results, s.Err = w.cli.ApplyWithContext(ctx, manifest, nil)
+	if s.Err != nil {
+		log.Warnf("sync manifest folder[%s] error: %s", w.opt.Dir, s.Err.Error())
+		// retried in the next sync
+		w.digest = ""
+	}
+	for _, ret := range s.Results {
+		if len(ret.Err) > 0 {
+			// retried in the next sync
+			w.digest = ""
+			break
+		}
+	}
+	w.send(s)
+
+	log.Infof("sync manifest folder[%s] finished", w.opt.Dir)
+}
+
+func (w *ManifestDirWatcher) send(s ManifestSync) {
+	select {
+	case w.ch <- s:
+	default:
+	}
+}
+
+// manifestDigest returns the digest of the names and contents of the manifest files.
+func manifestDigest(dir string) (string, error) {
+	files, err := manifestFiles(dir)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		sum := sha256.Sum256(data)
+		h.Write([]byte(file))
+		h.Write(sum[:])
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func withLabels(labels, extra map[string]string) map[string]string {
+	out := make(map[string]string, len(labels)+len(extra))
+	for k, v := range labels {
+		out[k] = v
+	}
+	for k, v := range extra {
+		out[k] = v
+	}
+	return out
+}
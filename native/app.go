@@ -1,8 +1,14 @@
 package native
 
 import (
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"time"
+
 	engine "github.com/jimi36/app-engine"
 	"github.com/jimi36/app-engine/log"
+	"github.com/pkg/errors"
 )
 
 func (cli *Client) CreateApplication(ev *engine.TaskEvent) *engine.TaskResult {
@@ -16,6 +22,13 @@ func (cli *Client) CreateApplication(ev *engine.TaskEvent) *engine.TaskResult {
 
 	log.Debugf("create native application[%s]......", app.Tag())
 
+	if err := cli.checkApplication(app); err != nil {
+		log.Warnf("create native application[%s] error: %s", app.Tag(), err.Error())
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
+
 	if err := cli.store.AddApplication(app); err != nil {
 		log.Warnf("create native application[%s] error: %s", app.Tag(), err.Error())
 		return &engine.TaskResult{
@@ -23,11 +36,83 @@ func (cli *Client) CreateApplication(ev *engine.TaskEvent) *engine.TaskResult {
 		}
 	}
 
+	cli.cache.ref(app)
+
+	cli.notifyEvent(&engine.ApplicationEvent{
+		ApplicationTag: app.ApplicationTag,
+		Type:           engine.ApplicationCreated,
+	})
+
 	log.Debugf("create native application[%s] finished", app.Tag())
 
 	return &engine.TaskResult{}
 }
 
+// UpdateApplication replaces the spec of the version in place, the running
+// or upgrading version is refused. The fetched files are removed if the
+// resource is changed, they are fetched again by the next start.
+func (cli *Client) UpdateApplication(ev *engine.TaskEvent) *engine.TaskResult {
+	app, ok := ev.In.(*engine.Application)
+	if !ok {
+		log.Fatalf("update native application error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	log.Debugf("update native application[%s]......", app.Tag())
+
+	if err := cli.checkApplication(app); err != nil {
+		log.Warnf("update native application[%s] error: %s", app.Tag(), err.Error())
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
+
+	tag := &app.ApplicationTag
+	ins, found := cli.appInstances[tag.Name]
+	candidate, upgrading := cli.candidates[tag.Name]
+	if found && ins.Version == tag.Version || !found && cli.restartPending(tag) || upgrading && candidate.Version == tag.Version {
+		log.Warnf("update native application[%s] error: %s", app.Tag(), engine.ErrApplicationStarted.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrApplicationStarted,
+		}
+	}
+
+	old, err := cli.store.GetApplication(tag)
+	if err != nil {
+		log.Warnf("update native application[%s] error: %s", app.Tag(), err.Error())
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
+	if err := cli.store.UpdateApplication(tag, func(cur *engine.Application) {
+		*cur = *app
+	}); err != nil {
+		log.Warnf("update native application[%s] error: %s", app.Tag(), err.Error())
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
+	cli.cache.unref(old)
+	cli.cache.ref(app)
+	cli.cache.evict()
+
+	if !reflect.DeepEqual(old.NativeSpec.Rc, app.NativeSpec.Rc) {
+		cli.cancelPrefetch(tag)
+		cli.versionLocks.lock(tag.Tag())
+		_, err := removeVersionFolder(cli.basePath, tag, cli.keepLogs)
+		cli.versionLocks.unlock(tag.Tag())
+		if err != nil {
+			log.Warnf("update native application[%s] folder error: %s", tag.Tag(), err.Error())
+		}
+	}
+
+	log.Debugf("update native application[%s] finished", app.Tag())
+
+	return &engine.TaskResult{}
+}
+
 func (cli *Client) RemoveApplication(ev *engine.TaskEvent) *engine.TaskResult {
 	tag, ok := ev.In.(*engine.ApplicationTag)
 	if !ok {
@@ -39,24 +124,53 @@ func (cli *Client) RemoveApplication(ev *engine.TaskEvent) *engine.TaskResult {
 
 	log.Debugf("remove native application[%s]......", tag.Tag())
 
-	if ins, found := cli.appInstances[tag.Name]; found && ins.Version == tag.Version {
-		// stop application instance
-		if err := ins.Stop(); err != nil {
+	ins, found := cli.appInstances[tag.Name]
+	if found && ins.Version == tag.Version || !found && cli.restartPending(tag) {
+		// stop application instance and its replicas
+		var inss []*Instance
+		if found {
+			inss = append(inss, ins)
+		}
+		inss = append(inss, cli.takeReplicas(tag.Name)...)
+		if _, err := stopInstances(ev.Context(), inss); err != nil {
 			log.Warnf("remove native application[%s] error: %s", tag.Tag(), err.Error())
 			return &engine.TaskResult{
 				Err: err,
 			}
 		}
-		// remove application runtime
+		// remove application runtime, the pending restart is canceled with it
 		cli.store.RemoveApplicationRunTime(tag.Name)
+		cli.cancelRestart(tag.Name)
 	}
 
+	app, _ := cli.store.GetApplication(tag)
 	if err := cli.store.RemoveApplication(tag); err != nil {
 		log.Warnf("remove native application[%s] error: %s", tag.Tag(), err.Error())
 		return &engine.TaskResult{
 			Err: err,
 		}
 	}
+	if app != nil {
+		cli.cache.unref(app)
+		cli.cache.evict()
+	}
+
+	// the instance of the version has been stopped, and the prefetch in
+	// flight is canceled and waited for
+	cli.cancelPrefetch(tag)
+	cli.versionLocks.lock(tag.Tag())
+	reclaimed, err := removeVersionFolder(cli.basePath, tag, cli.keepLogs)
+	cli.versionLocks.unlock(tag.Tag())
+	if err != nil {
+		log.Warnf("remove native application[%s] folder error: %s", tag.Tag(), err.Error())
+	} else {
+		log.Debugf("remove native application[%s] folder, %d bytes reclaimed", tag.Tag(), reclaimed)
+	}
+
+	cli.notifyEvent(&engine.ApplicationEvent{
+		ApplicationTag: *tag,
+		Type:           engine.ApplicationRemoved,
+	})
 
 	log.Debugf("remove native application[%s] finished", tag.Tag())
 
@@ -114,12 +228,31 @@ func (cli *Client) GetApplicationStates(ev *engine.TaskEvent) *engine.TaskResult
 			state.ToStart = rt.ToStart
 			state.IsStarted = rt.IsStarted
 			state.Err = rt.Err
+			state.StartTime = rt.StartTime
+			state.RestartCount = rt.RestartCount
+			state.LastExitCode = rt.LastExitCode
+			state.LastExitSignal = rt.LastExitSignal
+			state.LastExitReason = rt.LastExitReason
+			state.LastExitTime = rt.LastExitTime
+			state.OomKills = rt.OomKills
+			state.DownloadedBytes = rt.DownloadedBytes
+			state.TotalBytes = rt.TotalBytes
 		}
 
 		if ins, found := cli.appInstances[tag.Name]; found && ins.Version == tag.Version {
+			state.OomKills += ins.OomKills()
 			if insState, _ := ins.GetState(); insState != nil {
 				state.Instances = append(state.Instances, *insState)
 			}
+			for _, replica := range cli.replicas[tag.Name] {
+				if replica == nil {
+					continue
+				}
+				state.OomKills += replica.OomKills()
+				if insState, _ := replica.GetState(); insState != nil {
+					state.Instances = append(state.Instances, *insState)
+				}
+			}
 		}
 
 		appStates = append(appStates, state)
@@ -143,3 +276,103 @@ func (cli *Client) GetStartedApplications(ev *engine.TaskEvent) *engine.TaskResu
 		Out: rts,
 	}
 }
+
+// checkApplication validates the application, and its resource must be
+// signed if the signature is required.
+func (cli *Client) checkApplication(app *engine.Application) error {
+	if err := validateApplication(app); err != nil {
+		return err
+	}
+	if rc := app.NativeSpec.Rc; cli.requireSignature && rc != nil && len(rc.Signature) == 0 {
+		return errors.Wrap(engine.ErrParamInvalid, "resource is not signed")
+	}
+	return nil
+}
+
+func validateApplication(app *engine.Application) error {
+	// the name and the version are the folders of the application
+	if err := engine.CheckFolderName(app.Name); err != nil {
+		return errors.Wrap(engine.ErrParamInvalid, "application name "+err.Error())
+	}
+	if engine.NativeReservedNames[app.Name] {
+		return errors.Wrapf(engine.ErrParamInvalid, "application name %s is reserved", app.Name)
+	}
+	if err := engine.CheckFolderName(app.Version); err != nil {
+		return errors.Wrap(engine.ErrParamInvalid, "application version "+err.Error())
+	}
+	spec := app.NativeSpec
+	if spec == nil || len(spec.Command) == 0 {
+		return errors.Wrap(engine.ErrParamInvalid, "native spec command is empty")
+	}
+	if app.Replicas < 0 {
+		return errors.Wrap(engine.ErrParamInvalid, "replicas must not be negative")
+	}
+	if len(spec.StopSignal) > 0 {
+		if _, found := stopSignals[spec.StopSignal]; !found {
+			return errors.Wrapf(engine.ErrParamInvalid, "stop signal %s not supported", spec.StopSignal)
+		}
+	}
+	if maxGrace := int(maxStopGracePeriod / time.Second); spec.StopGracePeriodSeconds < 0 || spec.StopGracePeriodSeconds > maxGrace {
+		return errors.Wrapf(engine.ErrParamInvalid, "stop grace period must be in [0, %d] seconds", maxGrace)
+	}
+	if _, err := lookupCredential(spec); err != nil {
+		return errors.Wrap(engine.ErrParamInvalid, err.Error())
+	}
+	if _, err := parseUmask(spec.Umask); err != nil {
+		return errors.Wrap(engine.ErrParamInvalid, err.Error())
+	}
+	if rc := spec.Rc; rc != nil {
+		switch strings.ToLower(rc.SignatureType) {
+		case "", signatureEd25519, signatureX509:
+		default:
+			return errors.Wrap(engine.ErrParamInvalid, "signature type not supported")
+		}
+		if _, err := base64.StdEncoding.DecodeString(rc.Signature); err != nil {
+			return errors.Wrap(engine.ErrParamInvalid, "signature invalid")
+		}
+		if err := checkDigests(rc); err != nil {
+			return errors.Wrap(engine.ErrParamInvalid, err.Error())
+		}
+	}
+	if err := validateProbe(spec.LivenessProbe); err != nil {
+		return errors.Wrap(engine.ErrParamInvalid, "liveness "+err.Error())
+	}
+	if err := validateProbe(spec.ReadinessProbe); err != nil {
+		return errors.Wrap(engine.ErrParamInvalid, "readiness "+err.Error())
+	}
+	if res := spec.Resources; res != nil {
+		if res.CpuMillis < 0 || res.MemoryMB < 0 || res.Pids < 0 {
+			return errors.Wrap(engine.ErrParamInvalid, "resource limits must not be negative")
+		}
+		if res.IOWeight < 0 || res.IOWeight > 10000 {
+			return errors.Wrap(engine.ErrParamInvalid, "io weight must be in [1, 10000]")
+		}
+	}
+	return nil
+}
+
+func (cli *Client) GetApplication(ev *engine.TaskEvent) *engine.TaskResult {
+	tag, ok := ev.In.(*engine.ApplicationTag)
+	if !ok {
+		log.Fatalf("get native application error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	log.Debugf("get native application[%s]......", tag.Tag())
+
+	app, err := cli.store.GetApplication(tag)
+	if err != nil {
+		log.Warnf("get native application[%s] error: %s", tag.Tag(), err.Error())
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
+
+	log.Debugf("get native application[%s] finished", tag.Tag())
+
+	return &engine.TaskResult{
+		Out: app,
+	}
+}
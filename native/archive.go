@@ -0,0 +1,324 @@
+package native
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	engine "github.com/jimi36/app-engine"
+)
+
+const (
+	archiveTar   = "tar"
+	archiveTarGz = "tar.gz"
+	archiveZip   = "zip"
+)
+
+func isArchiveType(typ string) bool {
+	switch strings.ToLower(typ) {
+	case archiveTar, archiveTarGz, "tgz", archiveZip:
+		return true
+	}
+	return false
+}
+
+// archiveFormat returns the archive format of the resource by the resource
+// type or the file name, and an empty string if it is not an archive.
+func archiveFormat(rc *engine.NativeResource) string {
+	switch strings.ToLower(rc.Type) {
+	case archiveTar:
+		return archiveTar
+	case archiveTarGz, "tgz":
+		return archiveTarGz
+	case archiveZip:
+		return archiveZip
+	}
+
+	name := strings.ToLower(rc.FileName)
+	switch {
+	case strings.HasSuffix(name, ".tar"):
+		return archiveTar
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return archiveTarGz
+	case strings.HasSuffix(name, ".zip"):
+		return archiveZip
+	}
+	return ""
+}
+
+// extractedMarker returns the marker file written after the archive is
+// extracted, which contains the sha256 of the extracted archive.
+func extractedMarker(filePath string) string {
+	return filepath.Join(filepath.Dir(filePath), "."+filepath.Base(filePath)+".extracted")
+}
+
+// extractResource extracts the archive resource into its folder, it is
+// skipped if the same archive has been extracted.
+func extractResource(ctx context.Context, rc *engine.NativeResource, filePath string) error {
+	format := archiveFormat(rc)
+	if len(format) == 0 {
+		return nil
+	}
+
+	sum, err := fileSHA256(filePath)
+	if err != nil {
+		return err
+	}
+	marker := extractedMarker(filePath)
+	if data, err := ioutil.ReadFile(marker); err == nil && string(data) == sum {
+		return nil
+	}
+	os.Remove(marker)
+
+	destDir := filepath.Dir(filePath)
+	switch format {
+	case archiveZip:
+		err = extractZip(ctx, filePath, destDir)
+	default:
+		err = extractTar(ctx, filePath, destDir, format == archiveTarGz)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "extract %s", filepath.Base(filePath))
+	}
+
+	return ioutil.WriteFile(marker, []byte(sum), 0644)
+}
+
+// safeJoin joins the entry name to the dest folder and rejects the entry
+// escaping from the dest folder, by the path or by the links extracted before.
+func safeJoin(destDir, name string) (string, error) {
+	if filepath.IsAbs(name) || strings.HasPrefix(name, "/") {
+		return "", errors.Errorf("illegal entry path %s", name)
+	}
+	target := filepath.Join(destDir, name)
+	if target != destDir && !strings.HasPrefix(target, destDir+string(os.PathSeparator)) {
+		return "", errors.Errorf("illegal entry path %s", name)
+	}
+	if err := checkParents(destDir, target); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// checkParents rejects the target if one of its existing parent folders
+// under the dest folder is a link, which may point out of the dest folder.
+func checkParents(destDir, target string) error {
+	rel, err := filepath.Rel(destDir, filepath.Dir(target))
+	if err != nil || rel == "." {
+		return err
+	}
+
+	p := destDir
+	for _, seg := range strings.Split(rel, string(os.PathSeparator)) {
+		p = filepath.Join(p, seg)
+		fi, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return errors.Errorf("illegal entry path %s through link %s", target, p)
+		}
+	}
+	return nil
+}
+
+// mkdirEntry creates the folder entry, which must not be an existing link.
+func mkdirEntry(target string) error {
+	if fi, err := os.Lstat(target); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		return errors.Errorf("illegal folder entry %s which is a link", target)
+	}
+	return os.MkdirAll(target, 0755)
+}
+
+// checkLink rejects the link whose target escapes from the dest folder.
+func checkLink(destDir, linkPath, linkName string) error {
+	target := linkName
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(linkPath), target)
+	}
+	target = filepath.Clean(target)
+	if target != destDir && !strings.HasPrefix(target, destDir+string(os.PathSeparator)) {
+		return errors.Errorf("illegal link %s -> %s", linkPath, linkName)
+	}
+	return nil
+}
+
+func writeEntryFile(target string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	// replace the existed one, it may be a running binary or a link
+	os.Remove(target)
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	// the mode of a created file is masked by umask
+	return os.Chmod(target, mode)
+}
+
+func extractTar(ctx context.Context, filePath, destDir string, gz bool) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var r io.Reader = &ctxReader{ctx: ctx, r: file}
+	if gz {
+		gzr, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gzr.Close()
+		r = gzr
+	}
+
+	type dirMode struct {
+		path string
+		mode os.FileMode
+	}
+	var dirs []dirMode
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		target, err := safeJoin(destDir, hdr.Name)
+		if err != nil {
+			return err
+		}
+		mode := os.FileMode(hdr.Mode).Perm()
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := mkdirEntry(target); err != nil {
+				return err
+			}
+			dirs = append(dirs, dirMode{path: target, mode: mode})
+		case tar.TypeReg, tar.TypeRegA:
+			if err := writeEntryFile(target, tr, mode); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := checkLink(destDir, target, hdr.Linkname); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			os.Remove(target)
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			src, err := safeJoin(destDir, hdr.Linkname)
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			os.Remove(target)
+			if err := os.Link(src, target); err != nil {
+				return err
+			}
+		default:
+			// devices and fifos are not allowed in application packages
+			return errors.Errorf("unsupported entry %s type %c", hdr.Name, hdr.Typeflag)
+		}
+	}
+
+	// set folder modes after the files are created in them
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chmod(dirs[i].path, dirs[i].mode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func extractZip(ctx context.Context, filePath, destDir string) error {
+	zr, err := zip.OpenReader(filePath)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		target, err := safeJoin(destDir, f.Name)
+		if err != nil {
+			return err
+		}
+
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			if err := mkdirEntry(target); err != nil {
+				return err
+			}
+		case mode&os.ModeSymlink != 0:
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			linkName, err := ioutil.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+			if err := checkLink(destDir, target, string(linkName)); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			os.Remove(target)
+			if err := os.Symlink(string(linkName), target); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			err = writeEntryFile(target, rc, mode.Perm())
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		default:
+			return errors.Errorf("unsupported entry %s mode %s", f.Name, mode)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package native
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testEntry struct {
+	name     string
+	linkname string
+	body     string
+	dir      bool
+}
+
+func writeTestTar(t *testing.T, path string, entries []testEntry) {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644}
+		switch {
+		case e.dir:
+			hdr.Typeflag = tar.TypeDir
+			hdr.Mode = 0755
+		case len(e.linkname) > 0:
+			hdr.Typeflag = tar.TypeSymlink
+			hdr.Linkname = e.linkname
+		default:
+			hdr.Typeflag = tar.TypeReg
+			hdr.Size = int64(len(e.body))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(e.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestZip(t *testing.T, path string, entries []testEntry) {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for _, e := range entries {
+		fh := &zip.FileHeader{Name: e.name, Method: zip.Store}
+		body := e.body
+		switch {
+		case e.dir:
+			fh.Name += "/"
+			fh.SetMode(os.ModeDir | 0755)
+		case len(e.linkname) > 0:
+			fh.SetMode(os.ModeSymlink | 0777)
+			body = e.linkname
+		default:
+			fh.SetMode(0644)
+		}
+		w, err := zw.CreateHeader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// extractTestArchive extracts the archive of the entries into the dest
+// folder under a temp folder, and returns the temp folder.
+func extractTestArchive(t *testing.T, format string, entries []testEntry) (string, error) {
+	root, err := ioutil.TempDir("", "archive-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	destDir := filepath.Join(root, "dest")
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	filePath := filepath.Join(root, "archive")
+	if format == archiveZip {
+		writeTestZip(t, filePath, entries)
+		return root, extractZip(context.Background(), filePath, destDir)
+	}
+	writeTestTar(t, filePath, entries)
+	return root, extractTar(context.Background(), filePath, destDir, false)
+}
+
+func TestExtractArchive(t *testing.T) {
+	entries := []testEntry{
+		{name: "bin", dir: true},
+		{name: "bin/app", body: "app"},
+		{name: "app", linkname: "bin/app"},
+	}
+	for _, format := range []string{archiveTar, archiveZip} {
+		root, err := extractTestArchive(t, format, entries)
+		defer os.RemoveAll(root)
+		if err != nil {
+			t.Fatalf("%s: extract error: %v", format, err)
+		}
+		data, err := ioutil.ReadFile(filepath.Join(root, "dest", "app"))
+		if err != nil || string(data) != "app" {
+			t.Fatalf("%s: read extracted file: %q, %v", format, data, err)
+		}
+	}
+}
+
+func TestExtractArchiveRejectsEscape(t *testing.T) {
+	cases := map[string][]testEntry{
+		"traversal": {
+			{name: "../evil", body: "evil"},
+		},
+		"absolute": {
+			{name: "/tmp/evil", body: "evil"},
+		},
+		"link out": {
+			{name: "l", linkname: "../"},
+		},
+		"absolute link": {
+			{name: "l", linkname: "/"},
+		},
+		"link into link": {
+			{name: "a", linkname: "."},
+			{name: "a/evil", body: "evil"},
+		},
+		"chained links": {
+			{name: "a", linkname: "."},
+			{name: "a/l", linkname: ".."},
+			{name: "a/l/evil", body: "evil"},
+		},
+		"folder over link": {
+			{name: "a", linkname: "."},
+			{name: "a", dir: true},
+		},
+	}
+
+	for _, format := range []string{archiveTar, archiveZip} {
+		for name, entries := range cases {
+			root, err := extractTestArchive(t, format, entries)
+			defer os.RemoveAll(root)
+			if err == nil {
+				t.Errorf("%s %s: extract should fail", format, name)
+			}
+			if _, err := os.Lstat(filepath.Join(root, "evil")); err == nil {
+				t.Errorf("%s %s: file escaped from the dest folder", format, name)
+			}
+		}
+	}
+}
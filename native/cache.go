@@ -0,0 +1,379 @@
+package native
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	engine "github.com/jimi36/app-engine"
+	"github.com/jimi36/app-engine/log"
+)
+
+const (
+	defaultArtifactCacheSize = 4096 // MB
+	listApplicationsPageSize = 100
+)
+
+// artifactCache stores the fetched resources under basePath/cache keyed by
+// their digests, which are linked into the version folders. The entries
+// referenced by applications are never evicted, others are evicted in
+// LRU order when the cache size exceeds the cap.
+type artifactCache struct {
+	dir     string
+	maxSize int64
+
+	mu sync.Mutex
+	// application references of the entries
+	refs map[string]int
+	// entries being fetched or linked
+	locks *keyLocks
+}
+
+func newArtifactCache(dir string, maxSize int64) *artifactCache {
+	return &artifactCache{
+		dir:     dir,
+		maxSize: maxSize,
+		refs:    make(map[string]int),
+		locks:   newKeyLocks(),
+	}
+}
+
+// keyLocks holds a mutex for each key in use.
+type keyLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	sync.Mutex
+	users int
+}
+
+func newKeyLocks() *keyLocks {
+	return &keyLocks{
+		locks: make(map[string]*keyLock),
+	}
+}
+
+func (l *keyLocks) lock(key string) {
+	l.mu.Lock()
+	lock, found := l.locks[key]
+	if !found {
+		lock = &keyLock{}
+		l.locks[key] = lock
+	}
+	lock.users++
+	l.mu.Unlock()
+
+	lock.Lock()
+}
+
+func (l *keyLocks) unlock(key string) {
+	l.mu.Lock()
+	lock := l.locks[key]
+	lock.Unlock()
+	if lock.users--; lock.users <= 0 {
+		delete(l.locks, key)
+	}
+	l.mu.Unlock()
+}
+
+// inUse reports whether the key is locked or waited for.
+func (l *keyLocks) inUse(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, found := l.locks[key]
+	return found
+}
+
+// cacheKey returns the key of the resource by its strongest digest, and an
+// empty string if the resource has no sha digest, which is not cached since
+// md5 is not collision resistant.
+func cacheKey(rc *engine.NativeResource) string {
+	if rc == nil || checkDigests(rc) != nil {
+		return ""
+	}
+	switch {
+	case len(rc.Sha512) > 0:
+		return "sha512/" + strings.ToLower(rc.Sha512)
+	case len(rc.Sha256) > 0:
+		return "sha256/" + strings.ToLower(rc.Sha256)
+	}
+	return ""
+}
+
+func (c *artifactCache) path(key string) string {
+	return filepath.Join(c.dir, filepath.FromSlash(key))
+}
+
+func (c *artifactCache) ref(app *engine.Application) {
+	if app.NativeSpec == nil {
+		return
+	}
+	if key := cacheKey(app.NativeSpec.Rc); len(key) > 0 {
+		c.mu.Lock()
+		c.refs[key]++
+		c.mu.Unlock()
+	}
+}
+
+func (c *artifactCache) unref(app *engine.Application) {
+	if app.NativeSpec == nil {
+		return
+	}
+	if key := cacheKey(app.NativeSpec.Rc); len(key) > 0 {
+		c.mu.Lock()
+		if c.refs[key]--; c.refs[key] <= 0 {
+			delete(c.refs, key)
+		}
+		c.mu.Unlock()
+	}
+}
+
+// acquire locks the entry to fetch or link it, and the entry is not evicted
+// until it is released.
+func (c *artifactCache) acquire(key string) {
+	c.locks.lock(key)
+}
+
+func (c *artifactCache) release(key string) {
+	c.locks.unlock(key)
+}
+
+type cacheEntry struct {
+	key     string
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// evict removes the unused entries in LRU order until the cache size is not
+// larger than the cap. The modification time of an entry is its last use time.
+func (c *artifactCache) evict() {
+	if c.maxSize <= 0 {
+		return
+	}
+
+	var entries []cacheEntry
+	var total int64
+	filepath.Walk(c.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || strings.HasSuffix(path, partialFileSuffix) {
+			return nil
+		}
+		rel, err := filepath.Rel(c.dir, path)
+		if err != nil {
+			return nil
+		}
+		entries = append(entries, cacheEntry{
+			key:     filepath.ToSlash(rel),
+			path:    path,
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+		total += info.Size()
+		return nil
+	})
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].modTime.Before(entries[j].modTime)
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, e := range entries {
+		if total <= c.maxSize {
+			break
+		}
+		if c.refs[e.key] > 0 || c.locks.inUse(e.key) {
+			continue
+		}
+		if err := os.Remove(e.path); err != nil {
+			log.Warnf("evict artifact cache %s error: %s", e.key, err.Error())
+			continue
+		}
+		log.Debugf("evict artifact cache %s, %d bytes", e.key, e.size)
+		total -= e.size
+	}
+}
+
+// fetchArtifact fetches the resource to the file path through the artifact cache.
+func (cli *Client) fetchArtifact(ctx context.Context, tag *engine.ApplicationTag, rc *engine.NativeResource, filePath string) error {
+	key := cacheKey(rc)
+	if len(key) == 0 {
+		return cli.fetchResource(ctx, tag, rc, filePath)
+	}
+
+	cachePath := cli.cache.path(key)
+	cli.cache.acquire(key)
+	err := os.MkdirAll(filepath.Dir(cachePath), 0755)
+	if err == nil {
+		err = cli.fetchResource(ctx, tag, rc, cachePath)
+	}
+	if err == nil {
+		err = linkFile(cachePath, filePath)
+	}
+	if err == nil {
+		now := time.Now()
+		os.Chtimes(cachePath, now, now)
+	}
+	cli.cache.release(key)
+
+	cli.cache.evict()
+
+	return err
+}
+
+// linkFile hard links the file to the dest path, or copies it if the
+// hard link is not supported.
+func linkFile(srcPath, destPath string) error {
+	srcInfo, err := os.Stat(srcPath)
+	if err != nil {
+		return err
+	}
+	if destInfo, err := os.Stat(destPath); err == nil && os.SameFile(srcInfo, destInfo) {
+		return nil
+	}
+
+	os.Remove(destPath)
+	if err := os.Link(srcPath, destPath); err == nil {
+		return nil
+	}
+
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmpPath := destPath + partialFileSuffix
+	dest, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, srcInfo.Mode())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dest, src); err != nil {
+		dest.Close()
+		return err
+	}
+	if err := dest.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, destPath)
+}
+
+// loadCacheRefs counts the references of the stored applications.
+func (cli *Client) loadCacheRefs() error {
+	lastPos := ""
+	for {
+		tags, pos, err := cli.store.ListApplications(listApplicationsPageSize, lastPos)
+		if err != nil {
+			return err
+		}
+		for _, tag := range tags {
+			if app, err := cli.store.GetApplication(tag); err == nil {
+				cli.cache.ref(app)
+			}
+		}
+		if len(tags) < listApplicationsPageSize {
+			return nil
+		}
+		lastPos = pos
+	}
+}
+
+// prefetch is the prefetch in flight, which is canceled when the
+// application is removed.
+type prefetch struct {
+	tag    engine.ApplicationTag
+	cancel context.CancelFunc
+}
+
+// PrefetchApplication fetches the resource of the application into the
+// artifact cache and its version folder before it is started. The result is
+// sent to the returned channel, and the fetch goes on in background until
+// the client is closed or the application is removed even if the caller has
+// gone away. The start of the application waits for the prefetch in flight.
+func (cli *Client) PrefetchApplication(ev *engine.TaskEvent) *engine.TaskResult {
+	tag, ok := ev.In.(*engine.ApplicationTag)
+	if !ok {
+		log.Fatalf("prefetch native application error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	log.Debugf("prefetch native application[%s]......", tag.Tag())
+
+	app, err := cli.store.GetApplication(tag)
+	if err != nil {
+		log.Warnf("prefetch native application[%s] error: %s", tag.Tag(), err.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrApplicationNoExisted,
+		}
+	}
+
+	done := make(chan error, 1)
+	if app.NativeSpec == nil || app.NativeSpec.Rc == nil {
+		done <- nil
+	} else {
+		ctx, cancel := context.WithCancel(cli.ctx)
+		p := &prefetch{tag: *tag, cancel: cancel}
+		if prev, found := cli.prefetches[tag.Tag()]; found {
+			// the previous one is canceled along with this one
+			p.cancel = func() {
+				prev.cancel()
+				cancel()
+			}
+		}
+		cli.prefetches[tag.Tag()] = p
+		go func() {
+			rc := app.NativeSpec.Rc
+			filePath := filepath.Join(cli.basePath, app.Name, app.Version, rc.FileName)
+			err := cli.prepareResource(ctx, tag, rc, filePath)
+			if err != nil {
+				log.Warnf("prefetch native application[%s] error: %s", tag.Tag(), err.Error())
+			}
+			cancel()
+			if _, err := cli.postTaskEvent(cli.ctx, p, cli.prefetchApplicationDone, false); err != nil {
+				log.Debugf("prefetch native application[%s] error: %s", tag.Tag(), err.Error())
+			}
+			done <- err
+		}()
+	}
+
+	log.Debugf("prefetch native application[%s] finished", tag.Tag())
+
+	return &engine.TaskResult{
+		Out: (<-chan error)(done),
+	}
+}
+
+func (cli *Client) prefetchApplicationDone(ev *engine.TaskEvent) *engine.TaskResult {
+	p, ok := ev.In.(*prefetch)
+	if !ok {
+		log.Fatalf("prefetch native application done error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	// a newer prefetch of the application may be in flight
+	if cli.prefetches[p.tag.Tag()] == p {
+		delete(cli.prefetches, p.tag.Tag())
+	}
+
+	return &engine.TaskResult{}
+}
+
+// cancelPrefetch cancels the prefetch in flight of the application.
+func (cli *Client) cancelPrefetch(tag *engine.ApplicationTag) {
+	if p, found := cli.prefetches[tag.Tag()]; found {
+		p.cancel()
+		delete(cli.prefetches, tag.Tag())
+	}
+}
@@ -0,0 +1,117 @@
+package native
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	engine "github.com/jimi36/app-engine"
+)
+
+func TestCacheKey(t *testing.T) {
+	md5 := strings.Repeat("a", 32)
+	sha256 := strings.Repeat("B", 64)
+	sha512 := strings.Repeat("c", 128)
+
+	cases := []struct {
+		rc  *engine.NativeResource
+		key string
+	}{
+		{nil, ""},
+		{&engine.NativeResource{}, ""},
+		{&engine.NativeResource{Md5: md5}, ""},
+		{&engine.NativeResource{Md5: md5, Sha256: sha256}, "sha256/" + strings.ToLower(sha256)},
+		{&engine.NativeResource{Sha256: sha256, Sha512: sha512}, "sha512/" + sha512},
+		{&engine.NativeResource{Sha256: "../../etc"}, ""},
+		{&engine.NativeResource{Sha256: sha256[:62]}, ""},
+		{&engine.NativeResource{Sha512: sha256}, ""},
+		{&engine.NativeResource{Md5: "x", Sha256: sha256}, ""},
+	}
+
+	for _, c := range cases {
+		if key := cacheKey(c.rc); key != c.key {
+			t.Errorf("cache key of %+v is %q, want %q", c.rc, key, c.key)
+		}
+	}
+}
+
+func TestPrefetchSerialized(t *testing.T) {
+	content := []byte("#!/bin/sh\nsleep 10\n")
+	sum := sha256.Sum256(content)
+	var requests int32
+	aborted := make(chan struct{}, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path == "/hang/app.sh" {
+			<-r.Context().Done()
+			aborted <- struct{}{}
+			return
+		}
+		time.Sleep(time.Millisecond * 300)
+		w.Write(content)
+	}))
+	defer ts.Close()
+
+	cli, cleanup := newTestEngine(t)
+	defer cleanup()
+
+	for _, version := range []string{"ok", "hang"} {
+		// the resource of the hang version is never served
+		if version == "hang" {
+			sum = sha256.Sum256([]byte(version))
+		}
+		app := &engine.Application{
+			ApplicationTag: engine.ApplicationTag{Name: "app", Version: version},
+			Type:           engine.Native,
+			NativeSpec: &engine.NativeAppSpec{
+				Command: []string{"/bin/sh", "sh", "-c", "sleep 10"},
+				Rc: &engine.NativeResource{
+					FileName: "app.sh",
+					Url:      ts.URL + "/" + version + "/app.sh",
+					Sha256:   hex.EncodeToString(sum[:]),
+				},
+			},
+		}
+		if err := cli.CreateApplication(app); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the start waits for the prefetch in flight instead of fetching again
+	w := cli.Watch(&engine.WatchOption{Names: []string{"app"}})
+	defer w.Stop()
+	tag := &engine.ApplicationTag{Name: "app", Version: "ok"}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	cli.PrefetchApplicationWithContext(ctx, tag)
+	cancel()
+	if err := cli.StartApplication(tag); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, w, engine.ApplicationStarted)
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("%d requests sent, want 1", n)
+	}
+	if err := cli.StopApplication(tag); err != nil {
+		t.Fatal(err)
+	}
+
+	// the removal cancels the prefetch in flight
+	tag = &engine.ApplicationTag{Name: "app", Version: "hang"}
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond*50)
+	cli.PrefetchApplicationWithContext(ctx, tag)
+	cancel()
+	if err := cli.RemoveApplication(tag); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-aborted:
+	case <-time.After(time.Second * 5):
+		t.Fatal("prefetch is not canceled by the removal")
+	}
+}
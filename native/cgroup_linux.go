@@ -0,0 +1,181 @@
+package native
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	engine "github.com/jimi36/app-engine"
+	"github.com/jimi36/app-engine/utils"
+)
+
+const (
+	cgroupRoot          = "/sys/fs/cgroup"
+	defaultCgroupParent = "/sys/fs/cgroup/app-engine"
+	cpuMaxPeriod        = 100000
+)
+
+type cgroup struct {
+	path string
+}
+
+func cgroupPath(parent, name string) string {
+	return filepath.Join(parent, name)
+}
+
+// newCgroup creates the cgroup v2 of the instance under parent and applies the limits.
+func newCgroup(parent, name string, res *engine.ResourceSpec) (*cgroup, error) {
+	if !utils.IsExistedPath(filepath.Join(cgroupRoot, "cgroup.controllers")) {
+		return nil, errors.New("cgroup v2 is not available")
+	}
+	if err := utils.CreateFolder(parent); err != nil {
+		return nil, err
+	}
+	if err := enableControllers(parent, usedControllers(res)); err != nil {
+		return nil, errors.Wrap(err, "enable cgroup controllers error")
+	}
+
+	cg := &cgroup{path: cgroupPath(parent, name)}
+	if err := utils.CreateFolder(cg.path); err != nil {
+		return nil, err
+	}
+
+	var limits [][2]string
+	if res.CpuMillis > 0 {
+		quota := res.CpuMillis * cpuMaxPeriod / 1000
+		limits = append(limits, [2]string{"cpu.max", strconv.FormatInt(quota, 10) + " " + strconv.Itoa(cpuMaxPeriod)})
+	}
+	if res.MemoryMB > 0 {
+		limits = append(limits, [2]string{"memory.max", strconv.FormatInt(res.MemoryMB*1024*1024, 10)})
+	}
+	if res.Pids > 0 {
+		limits = append(limits, [2]string{"pids.max", strconv.FormatInt(res.Pids, 10)})
+	}
+	if res.IOWeight > 0 {
+		limits = append(limits, [2]string{"io.weight", "default " + strconv.FormatInt(res.IOWeight, 10)})
+	}
+	for _, limit := range limits {
+		if err := ioutil.WriteFile(filepath.Join(cg.path, limit[0]), []byte(limit[1]), 0644); err != nil {
+			cg.remove()
+			return nil, errors.Wrapf(err, "write cgroup %s error", limit[0])
+		}
+	}
+
+	return cg, nil
+}
+
+// openCgroup opens the existed cgroup of a bound instance.
+func openCgroup(parent, name string) *cgroup {
+	path := cgroupPath(parent, name)
+	if !utils.IsDir(path) {
+		return nil
+	}
+	return &cgroup{path: path}
+}
+
+// usedControllers returns the controllers of the limits set in res.
+func usedControllers(res *engine.ResourceSpec) []string {
+	var ctls []string
+	if res.CpuMillis > 0 {
+		ctls = append(ctls, "cpu")
+	}
+	if res.MemoryMB > 0 {
+		ctls = append(ctls, "memory")
+	}
+	if res.Pids > 0 {
+		ctls = append(ctls, "pids")
+	}
+	if res.IOWeight > 0 {
+		ctls = append(ctls, "io")
+	}
+	return ctls
+}
+
+// readControllers reads the controller list in the cgroup file.
+func readControllers(file string) (map[string]bool, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	ctls := map[string]bool{}
+	for _, ctl := range strings.Fields(string(data)) {
+		ctls[ctl] = true
+	}
+	return ctls, nil
+}
+
+// enableControllers enables ctls from the cgroup root down to dir, the
+// controllers already enabled are left untouched.
+func enableControllers(dir string, ctls []string) error {
+	rel, err := filepath.Rel(cgroupRoot, dir)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return errors.New("cgroup parent is not under " + cgroupRoot)
+	}
+
+	path := cgroupRoot
+	parts := []string{}
+	if rel != "." {
+		parts = strings.Split(rel, string(filepath.Separator))
+	}
+	for i := 0; i <= len(parts); i++ {
+		available, err := readControllers(filepath.Join(path, "cgroup.controllers"))
+		if err != nil {
+			return err
+		}
+		control := filepath.Join(path, "cgroup.subtree_control")
+		enabled, err := readControllers(control)
+		if err != nil {
+			return err
+		}
+		for _, ctl := range ctls {
+			if enabled[ctl] {
+				continue
+			}
+			if !available[ctl] {
+				return errors.Errorf("controller %s is not available in %s", ctl, path)
+			}
+			if err := ioutil.WriteFile(control, []byte("+"+ctl), 0644); err != nil {
+				return errors.Wrapf(err, "enable %s in %s", ctl, path)
+			}
+		}
+		if i < len(parts) {
+			path = filepath.Join(path, parts[i])
+		}
+	}
+
+	return nil
+}
+
+func (cg *cgroup) addProcess(pid int) error {
+	return ioutil.WriteFile(filepath.Join(cg.path, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644)
+}
+
+// oomKills reads the oom_kill count in memory.events.
+func (cg *cgroup) oomKills() int {
+	f, err := os.Open(filepath.Join(cg.path, "memory.events"))
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			n, _ := strconv.Atoi(fields[1])
+			return n
+		}
+	}
+
+	return 0
+}
+
+// remove removes the cgroup, it fails if there are processes left.
+func (cg *cgroup) remove() error {
+	return os.Remove(cg.path)
+}
@@ -0,0 +1,34 @@
+package native
+
+import (
+	"github.com/pkg/errors"
+
+	engine "github.com/jimi36/app-engine"
+)
+
+const (
+	defaultCgroupParent = ""
+)
+
+type cgroup struct{}
+
+// newCgroup fails, resource limits are not supported on windows.
+func newCgroup(parent, name string, res *engine.ResourceSpec) (*cgroup, error) {
+	return nil, errors.New("cgroup is not supported")
+}
+
+func openCgroup(parent, name string) *cgroup {
+	return nil
+}
+
+func (cg *cgroup) addProcess(pid int) error {
+	return errors.New("cgroup is not supported")
+}
+
+func (cg *cgroup) oomKills() int {
+	return 0
+}
+
+func (cg *cgroup) remove() error {
+	return nil
+}
@@ -1,7 +1,9 @@
 package native
 
 import (
+	"context"
 	"path/filepath"
+	"time"
 
 	engine "github.com/jimi36/app-engine"
 	"github.com/jimi36/app-engine/log"
@@ -11,8 +13,19 @@ import (
 
 func NewClient(opts ...engine.Option) (engine.ClientImpl, error) {
 	cli := &Client{
-		basePath:     "/var/lib/engine/native",
-		appInstances: make(map[string]*Instance),
+		basePath:        "/var/lib/engine/native",
+		cgroupParent:    defaultCgroupParent,
+		cacheSize:       defaultArtifactCacheSize,
+		gcInterval:      defaultGCInterval,
+		fetchers:        defaultFetchers(),
+		appInstances:    make(map[string]*Instance),
+		replicas:        make(map[string][]*Instance),
+		pendingRestarts: make(map[string]*time.Timer),
+		exited:          make(map[string]bool),
+		candidates:      make(map[string]*Instance),
+		upgrading:       make(map[string]bool),
+		versionLocks:    newKeyLocks(),
+		prefetches:      make(map[string]*prefetch),
 	}
 
 	if err := applyOptions(cli, opts); err != nil {
@@ -30,25 +43,145 @@ func NewClient(opts ...engine.Option) (engine.ClientImpl, error) {
 			return nil, err
 		}
 		cli.store = dbStore
+		cli.ownStore = true
 	}
 
+	cli.cache = newArtifactCache(filepath.Join(cli.basePath, "cache"), cli.cacheSize*1024*1024)
+	if err := cli.loadCacheRefs(); err != nil {
+		log.Errorf("load artifact cache refs error: %s", err.Error())
+		return nil, err
+	}
+
+	cli.ctx, cli.cancel = context.WithCancel(context.Background())
+
 	return cli, nil
 }
 
 type Client struct {
 	// store
 	store engine.Store
+	// store is opened by the client
+	ownStore bool
 	// base path
 	basePath string
+	// parent cgroup of the application cgroups
+	cgroupParent string
+	// artifact cache and its size cap in MB
+	cache     *artifactCache
+	cacheSize int64
+	// interval of the periodic garbage collection
+	gcInterval time.Duration
+	// keep the log files when the application is removed
+	keepLogs bool
+	// resource signatures are verified against the trust store
+	trustStore       *TrustStore
+	requireSignature bool
+	// resource fetchers keyed on resource type
+	fetchers map[string]Fetcher
 	// post task func
 	postTaskEvent engine.PostTaskEventFunc
+	// notify application event func
+	notifyEvent engine.NotifyEventFunc
 	// application instances
 	appInstances map[string]*Instance
+	// replicas of the application instances except the first one, nil if exited
+	replicas map[string][]*Instance
+	// applications to be restarted after the backoff
+	pendingRestarts map[string]*time.Timer
+	// applications exited and not restarted by the restart policy
+	exited map[string]bool
+	// instances of the upgrading versions, which are not ready yet
+	candidates map[string]*Instance
+	upgrading  map[string]bool
+	// serializes preparing and removing the version folders
+	versionLocks *keyLocks
+	// prefetches in flight keyed on the application tag
+	prefetches map[string]*prefetch
+	// canceled when the client is closed
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 var _ engine.ClientImpl = (*Client)(nil)
 
-func (cli *Client) Init(postFunc engine.PostTaskEventFunc) error {
+func (cli *Client) Init(postFunc engine.PostTaskEventFunc, notifyFunc engine.NotifyEventFunc) error {
 	cli.postTaskEvent = postFunc
+	cli.notifyEvent = func(ev *engine.ApplicationEvent) {
+		engine.RecordHistory(cli.store, ev)
+		notifyFunc(ev)
+	}
+	if cli.gcInterval > 0 {
+		go cli.gcLoop()
+	}
 	return nil
 }
+
+func (cli *Client) Close(ev *engine.TaskEvent) *engine.TaskResult {
+	opt, ok := ev.In.(*engine.StopOption)
+	if !ok {
+		log.Fatalf("close native client error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	log.Debugf("close native client......")
+
+	// stop monitor goroutines
+	cli.cancel()
+
+	var replicas []*Instance
+	for name := range cli.replicas {
+		replicas = append(replicas, cli.takeReplicas(name)...)
+	}
+
+	if !opt.KeepApplications {
+		// stop instances in parallel, each one may wait its grace period
+		inss := replicas
+		for _, ins := range cli.appInstances {
+			inss = append(inss, ins)
+		}
+		if _, err := stopInstances(ev.Context(), inss); err != nil {
+			log.Warnf("close native client error: %s", err.Error())
+		}
+	}
+	for _, ins := range replicas {
+		ins.Release()
+	}
+
+	// candidates are not recorded in the runtime, always stop them
+	for name, ins := range cli.candidates {
+		if _, err := ins.Stop(ev.Context()); err != nil {
+			log.Warnf("close native client stop instance[%s] error: %s", ins.String(), err.Error())
+		}
+		ins.Release()
+		delete(cli.candidates, name)
+	}
+
+	for name, ins := range cli.appInstances {
+		if !opt.KeepApplications {
+			// keep ToStart, the application is started again by the next client
+			cli.store.UpdateApplicationRuntime(name, func(rt *engine.ApplicationRuntime) error {
+				rt.IsStarted = false
+				rt.Pid = -1
+				rt.ReplicaPids = nil
+				return nil
+			})
+		}
+		ins.Release()
+		delete(cli.appInstances, name)
+	}
+
+	if cli.ownStore {
+		if err := cli.store.Close(); err != nil {
+			log.Warnf("close native client error: %s", err.Error())
+			return &engine.TaskResult{
+				Err: err,
+			}
+		}
+	}
+
+	log.Debugf("close native client finished")
+
+	return &engine.TaskResult{}
+}
@@ -2,6 +2,8 @@ package native
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
 
 	engine "github.com/jimi36/app-engine"
 	"github.com/jimi36/app-engine/log"
@@ -51,6 +53,68 @@ func (cli *Client) CreateConfig(ev *engine.TaskEvent) *engine.TaskResult {
 	return &engine.TaskResult{}
 }
 
+// UpdateConfig rewrites the files of the config in place, and the files of
+// the removed keys are removed.
+func (cli *Client) UpdateConfig(ev *engine.TaskEvent) *engine.TaskResult {
+	config, ok := ev.In.(*engine.Config)
+	if !ok {
+		log.Fatalf("update native config error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	log.Debugf("update native config[%s]......", config.Name)
+
+	if found, err := cli.store.HasConfig(config.Name); err != nil || !found {
+		if err == nil {
+			err = engine.ErrConfigNoExisted
+		}
+		log.Warnf("update native config[%s] error: %s", config.Name, err.Error())
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
+
+	configPath := genConfigPath(cli.basePath, config.Name)
+	if !utils.IsExistedPath(configPath) {
+		if err := utils.CreateFolder(configPath); err != nil {
+			log.Warnf("update native config[%s] folder error: %s", config.Name, err.Error())
+			return &engine.TaskResult{
+				Err: err,
+			}
+		}
+	}
+
+	for k, v := range config.Data {
+		filePath := genConfigFilePath(configPath, k)
+		if err := utils.CreateFile(filePath, []byte(v)); err != nil {
+			log.Warnf("update native config[%s] error: %s", config.Name, err.Error())
+			return &engine.TaskResult{
+				Err: err,
+			}
+		}
+	}
+	if files, err := ioutil.ReadDir(configPath); err == nil {
+		for _, f := range files {
+			if _, found := config.Data[f.Name()]; !found {
+				os.RemoveAll(genConfigFilePath(configPath, f.Name()))
+			}
+		}
+	}
+
+	if err := cli.store.AddConfig(config); err != nil {
+		log.Warnf("update native config[%s] error: %s", config.Name, err.Error())
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
+
+	log.Debugf("update native config[%s] finished", config.Name)
+
+	return &engine.TaskResult{}
+}
+
 func (cli *Client) RemoveConfig(ev *engine.TaskEvent) *engine.TaskResult {
 	name, ok := ev.In.(string)
 	if !ok {
@@ -96,3 +160,23 @@ func genConfigPath(basePath, name string) string {
 func genConfigFilePath(configPath, name string) string {
 	return fmt.Sprintf("%s/%s", configPath, name)
 }
+
+func (cli *Client) ListConfigs(ev *engine.TaskEvent) *engine.TaskResult {
+	log.Debugf("list native configs......")
+
+	var configs []*engine.Config
+	if err := cli.store.ForeachConfig(func(config *engine.Config) {
+		configs = append(configs, config)
+	}); err != nil {
+		log.Warnf("list native configs error: %s", err.Error())
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
+
+	log.Debugf("list native configs finished")
+
+	return &engine.TaskResult{
+		Out: configs,
+	}
+}
@@ -0,0 +1,130 @@
+package native
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	engine "github.com/jimi36/app-engine"
+)
+
+type ProcAttr struct {
+	// working directory
+	Dir string
+	// credential, nil to inherit the engine's
+	Credential *Credential
+	// umask, negative to inherit the engine's
+	Umask int
+	// cgroup joined before the command runs, nil to inherit the engine's
+	cgroup *cgroup
+}
+
+type Credential struct {
+	Uid    uint32
+	Gid    uint32
+	Groups []uint32
+}
+
+func lookupUid(name string) (uint32, uint32, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		if u, err = user.LookupId(name); err != nil {
+			return 0, 0, errors.Errorf("user %s not existed", name)
+		}
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return 0, 0, errors.Errorf("user %s id invalid", name)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return 0, 0, errors.Errorf("user %s group id invalid", name)
+	}
+	return uint32(uid), uint32(gid), nil
+}
+
+func lookupGid(name string) (uint32, error) {
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		if g, err = user.LookupGroupId(name); err != nil {
+			return 0, errors.Errorf("group %s not existed", name)
+		}
+	}
+	gid, err := strconv.ParseUint(g.Gid, 10, 32)
+	if err != nil {
+		return 0, errors.Errorf("group %s id invalid", name)
+	}
+	return uint32(gid), nil
+}
+
+// lookupCredential resolves the user and groups of the spec by name or id,
+// it returns nil if the spec has no user and group.
+func lookupCredential(spec *engine.NativeAppSpec) (*Credential, error) {
+	if len(spec.User) == 0 && len(spec.Group) == 0 && len(spec.SupplementaryGroups) == 0 {
+		return nil, nil
+	}
+
+	cred := &Credential{
+		Uid:    uint32(os.Getuid()),
+		Gid:    uint32(os.Getgid()),
+		Groups: []uint32{},
+	}
+
+	if len(spec.User) > 0 {
+		uid, gid, err := lookupUid(spec.User)
+		if err != nil {
+			return nil, err
+		}
+		cred.Uid, cred.Gid = uid, gid
+	}
+
+	if len(spec.Group) > 0 {
+		gid, err := lookupGid(spec.Group)
+		if err != nil {
+			return nil, err
+		}
+		cred.Gid = gid
+	}
+
+	for _, group := range spec.SupplementaryGroups {
+		gid, err := lookupGid(group)
+		if err != nil {
+			return nil, err
+		}
+		cred.Groups = append(cred.Groups, gid)
+	}
+
+	return cred, nil
+}
+
+// newProcAttr resolves the credential and umask of the spec for the
+// processes run in dir.
+func newProcAttr(spec *engine.NativeAppSpec, dir string) (*ProcAttr, error) {
+	cred, err := lookupCredential(spec)
+	if err != nil {
+		return nil, err
+	}
+	umask, err := parseUmask(spec.Umask)
+	if err != nil {
+		return nil, err
+	}
+	return &ProcAttr{
+		Dir:        dir,
+		Credential: cred,
+		Umask:      umask,
+	}, nil
+}
+
+// parseUmask parses the octal umask, it returns -1 if umask is empty.
+func parseUmask(umask string) (int, error) {
+	if len(umask) == 0 {
+		return -1, nil
+	}
+	mask, err := strconv.ParseUint(umask, 8, 32)
+	if err != nil || mask > 0777 {
+		return -1, errors.Errorf("umask %s invalid", umask)
+	}
+	return int(mask), nil
+}
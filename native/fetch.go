@@ -0,0 +1,517 @@
+package native
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	engine "github.com/jimi36/app-engine"
+	"github.com/jimi36/app-engine/log"
+	"github.com/jimi36/app-engine/utils"
+)
+
+const (
+	defaultFetchRetries         = 3
+	defaultFetchRetryBackoff    = time.Second
+	defaultFetchRetryMaxBackoff = time.Minute
+	fetchProgressInterval       = time.Second
+	partialFileSuffix           = ".part"
+	// the validator of the partial file, ending with the partial suffix to
+	// be skipped as the partial file
+	validatorFileSuffix = ".validator" + partialFileSuffix
+)
+
+// Fetcher fetches the resource of a native application to the file.
+type Fetcher interface {
+	Fetch(ctx context.Context, rc *engine.NativeResource, file *FetchFile) error
+}
+
+// FetcherFunc is an adapter to use an ordinary function as a Fetcher.
+type FetcherFunc func(ctx context.Context, rc *engine.NativeResource, file *FetchFile) error
+
+func (f FetcherFunc) Fetch(ctx context.Context, rc *engine.NativeResource, file *FetchFile) error {
+	return f(ctx, rc, file)
+}
+
+// FetchFile is the partially fetched file of a resource. Fetchers supporting
+// resume continue writing from Offset, others call Reset before writing.
+type FetchFile struct {
+	file      *os.File
+	mu        sync.Mutex
+	offset    int64
+	total     int64
+	validator string
+	progress  func(done, total int64)
+	reported  time.Time
+}
+
+// Offset returns the size of the partially fetched file.
+func (f *FetchFile) Offset() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.offset
+}
+
+// SetTotal sets the total size of the resource if it is known.
+func (f *FetchFile) SetTotal(total int64) {
+	f.mu.Lock()
+	f.total = total
+	f.mu.Unlock()
+}
+
+// Validator returns the ETag or Last-Modified of the partially fetched
+// content, which is empty if it is unknown.
+func (f *FetchFile) Validator() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.validator
+}
+
+// SetValidator sets the ETag or Last-Modified of the fetched content, the
+// resume of the partial file is validated by it.
+func (f *FetchFile) SetValidator(validator string) {
+	f.mu.Lock()
+	f.validator = validator
+	f.mu.Unlock()
+}
+
+// Reset truncates the partially fetched file.
+func (f *FetchFile) Reset() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	f.offset = 0
+	f.validator = ""
+	return nil
+}
+
+func (f *FetchFile) Write(p []byte) (int, error) {
+	n, err := f.file.Write(p)
+
+	f.mu.Lock()
+	f.offset += int64(n)
+	report := time.Since(f.reported) >= fetchProgressInterval
+	if report {
+		f.reported = time.Now()
+	}
+	done, total := f.offset, f.total
+	f.mu.Unlock()
+
+	if report && f.progress != nil {
+		f.progress(done, total)
+	}
+
+	return n, err
+}
+
+func defaultFetchers() map[string]Fetcher {
+	httpFetcher := FetcherFunc(fetchHttpFile)
+	localFetcher := FetcherFunc(fetchLocalFile)
+	return map[string]Fetcher{
+		"http":  httpFetcher,
+		"https": httpFetcher,
+		"file":  localFetcher,
+		"local": localFetcher,
+		"s3":    FetcherFunc(fetchS3File),
+	}
+}
+
+// fetcherType returns the resource type, which is the url scheme by default
+// or if the type is an archive format, and a url without scheme is a local path.
+func fetcherType(rc *engine.NativeResource) string {
+	if len(rc.Type) > 0 && !isArchiveType(rc.Type) {
+		return strings.ToLower(rc.Type)
+	}
+	if u, err := url.Parse(rc.Url); err == nil && len(u.Scheme) > 1 {
+		return strings.ToLower(u.Scheme)
+	}
+	return "local"
+}
+
+// fetchResource fetches the resource to a partial file, which is renamed to
+// the file path after its digests are verified. A failed fetch is retried
+// with backoff and resumed from the partial file.
+func (cli *Client) fetchResource(ctx context.Context, tag *engine.ApplicationTag, rc *engine.NativeResource, filePath string) error {
+	if utils.IsExistedPath(filePath) && hasDigest(rc) {
+		if err := verifyDigests(rc, filePath); err == nil {
+			return nil
+		}
+	}
+
+	typ := fetcherType(rc)
+	fetcher, found := cli.fetchers[typ]
+	if !found {
+		return errors.Errorf("fetcher %s not found", typ)
+	}
+
+	retries := defaultFetchRetries
+	if rc.Retries > 0 {
+		retries = rc.Retries
+	} else if rc.Retries < 0 {
+		retries = 0
+	}
+	backoff := defaultFetchRetryBackoff
+	if rc.RetryBackoffSeconds > 0 {
+		backoff = time.Duration(rc.RetryBackoffSeconds) * time.Second
+	}
+
+	progress := func(done, total int64) {
+		cli.reportFetchProgress(ctx, tag, done, total)
+	}
+
+	partPath := filePath + partialFileSuffix
+	for i := 0; ; i++ {
+		err := fetchPartialFile(ctx, fetcher, rc, partPath, progress)
+		if err == nil {
+			if err = verifyDigests(rc, partPath); err != nil {
+				// the partial file is broken, fetch it again
+				os.Remove(partPath)
+				os.Remove(filePath + validatorFileSuffix)
+			}
+		}
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil || i >= retries {
+			return err
+		}
+
+		log.Warnf("fetch resource %s error: %s, retry after %s", rc.Url, err.Error(), backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > defaultFetchRetryMaxBackoff {
+			backoff = defaultFetchRetryMaxBackoff
+		}
+	}
+
+	os.Remove(filePath + validatorFileSuffix)
+	return os.Rename(partPath, filePath)
+}
+
+// fetchPartialFile fetches the resource to the partial file, the validator
+// of the partial content is saved alongside for the resume.
+func fetchPartialFile(ctx context.Context, fetcher Fetcher, rc *engine.NativeResource, partPath string, progress func(int64, int64)) error {
+	file, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	validatorPath := strings.TrimSuffix(partPath, partialFileSuffix) + validatorFileSuffix
+	validator, _ := ioutil.ReadFile(validatorPath)
+
+	ff := &FetchFile{
+		file:      file,
+		offset:    offset,
+		validator: string(validator),
+		progress:  progress,
+	}
+	err = fetcher.Fetch(ctx, rc, ff)
+	if v := ff.Validator(); v != string(validator) {
+		if len(v) > 0 {
+			ioutil.WriteFile(validatorPath, []byte(v), 0644)
+		} else {
+			os.Remove(validatorPath)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	done := ff.Offset()
+	progress(done, done)
+
+	return file.Sync()
+}
+
+type fetchProgress struct {
+	tag   engine.ApplicationTag
+	done  int64
+	total int64
+}
+
+func (cli *Client) reportFetchProgress(ctx context.Context, tag *engine.ApplicationTag, done, total int64) {
+	in := &fetchProgress{tag: *tag, done: done, total: total}
+	if _, err := cli.postTaskEvent(ctx, in, cli.updateFetchProgress, false); err != nil {
+		log.Debugf("report native application[%s] fetch progress error: %s", tag.Tag(), err.Error())
+	}
+}
+
+func (cli *Client) updateFetchProgress(ev *engine.TaskEvent) *engine.TaskResult {
+	p, ok := ev.In.(*fetchProgress)
+	if !ok {
+		log.Fatalf("update native application fetch progress error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	cli.store.UpdateApplicationRuntime(p.tag.Name, func(rt *engine.ApplicationRuntime) error {
+		if rt.Version != p.tag.Version {
+			return errors.New("version not match")
+		}
+		rt.DownloadedBytes = p.done
+		rt.TotalBytes = p.total
+		return nil
+	})
+
+	return &engine.TaskResult{}
+}
+
+func hasDigest(rc *engine.NativeResource) bool {
+	return len(rc.Md5) > 0 || len(rc.Sha256) > 0 || len(rc.Sha512) > 0
+}
+
+// checkDigests checks the digests of the resource are the hex strings of
+// their hash sizes.
+func checkDigests(rc *engine.NativeResource) error {
+	for _, d := range []struct {
+		name  string
+		value string
+		size  int
+	}{
+		{"md5", rc.Md5, md5.Size},
+		{"sha256", rc.Sha256, sha256.Size},
+		{"sha512", rc.Sha512, sha512.Size},
+	} {
+		if len(d.value) == 0 {
+			continue
+		}
+		if b, err := hex.DecodeString(d.value); err != nil || len(b) != d.size {
+			return errors.Errorf("%s digest invalid", d.name)
+		}
+	}
+	return nil
+}
+
+// verifyDigests checks the digests of the resource by reading the file once.
+func verifyDigests(rc *engine.NativeResource, filePath string) error {
+	type digest struct {
+		name string
+		want string
+		h    hash.Hash
+	}
+	var digests []digest
+	if len(rc.Md5) > 0 {
+		digests = append(digests, digest{"md5", rc.Md5, md5.New()})
+	}
+	if len(rc.Sha256) > 0 {
+		digests = append(digests, digest{"sha256", rc.Sha256, sha256.New()})
+	}
+	if len(rc.Sha512) > 0 {
+		digests = append(digests, digest{"sha512", rc.Sha512, sha512.New()})
+	}
+	if len(digests) == 0 {
+		return nil
+	}
+
+	var writers []io.Writer
+	for _, d := range digests {
+		writers = append(writers, d.h)
+	}
+	if err := hashFile(filePath, io.MultiWriter(writers...)); err != nil {
+		return err
+	}
+
+	for _, d := range digests {
+		if !strings.EqualFold(hex.EncodeToString(d.h.Sum(nil)), d.want) {
+			return errors.Errorf("file %s not match", d.name)
+		}
+	}
+	return nil
+}
+
+func hashFile(filePath string, w io.Writer) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(w, file)
+	return err
+}
+
+func fileSHA256(filePath string) (string, error) {
+	h := sha256.New()
+	if err := hashFile(filePath, h); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func fetchHttpFile(ctx context.Context, rc *engine.NativeResource, file *FetchFile) error {
+	req, err := http.NewRequest("GET", rc.Url, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range rc.Headers {
+		req.Header.Set(k, v)
+	}
+	if auth := rc.Auth; auth != nil {
+		switch {
+		case len(auth.BearerToken) > 0:
+			req.Header.Set("Authorization", "Bearer "+auth.BearerToken)
+		case len(auth.Username) > 0:
+			req.SetBasicAuth(auth.Username, auth.Password)
+		}
+	}
+	if err := setRangeHeader(req, rc, file); err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return saveResponse(ctx, resp, file)
+}
+
+// setRangeHeader requests the rest of the partial file. The range is
+// conditional on the validator of the partial content, and without a
+// validator the partial file is resumed only if the digests can check the
+// result, otherwise it is fetched from the start.
+func setRangeHeader(req *http.Request, rc *engine.NativeResource, file *FetchFile) error {
+	offset := file.Offset()
+	if offset == 0 {
+		return nil
+	}
+	validator := file.Validator()
+	if len(validator) == 0 && !hasDigest(rc) {
+		return file.Reset()
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	if len(validator) > 0 {
+		req.Header.Set("If-Range", validator)
+	}
+	return nil
+}
+
+// responseValidator returns the strong ETag or the Last-Modified of the
+// response, a weak ETag is not allowed in If-Range.
+func responseValidator(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); len(etag) > 0 && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+// saveResponse writes the response body to the file, which is appended if
+// the server supports the range request or rewritten otherwise.
+func saveResponse(ctx context.Context, resp *http.Response, file *FetchFile) error {
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err := file.Reset(); err != nil {
+			return err
+		}
+		if resp.ContentLength >= 0 {
+			file.SetTotal(resp.ContentLength)
+		}
+		file.SetValidator(responseValidator(resp))
+	case http.StatusPartialContent:
+		file.SetTotal(contentRangeTotal(resp.Header.Get("Content-Range")))
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the partial file is completed if it is of the total size, and it
+		// is verified by the caller, otherwise it is fetched from the start
+		if total := contentRangeTotal(resp.Header.Get("Content-Range")); total > 0 && total == file.Offset() {
+			file.SetTotal(total)
+			return nil
+		}
+		if err := file.Reset(); err != nil {
+			return err
+		}
+		return errors.New(resp.Status)
+	default:
+		return errors.New(resp.Status)
+	}
+
+	return copyFile(ctx, file, resp.Body)
+}
+
+// contentRangeTotal parses the total size of header "bytes start-end/total".
+func contentRangeTotal(contentRange string) int64 {
+	i := strings.LastIndex(contentRange, "/")
+	if i < 0 {
+		return 0
+	}
+	total, err := strconv.ParseInt(contentRange[i+1:], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return total
+}
+
+// fetchLocalFile copies the resource from a file url or a local path,
+// which may be a mirror folder containing the resource file.
+func fetchLocalFile(ctx context.Context, rc *engine.NativeResource, file *FetchFile) error {
+	srcPath := rc.Url
+	if u, err := url.Parse(rc.Url); err == nil && u.Scheme == "file" {
+		srcPath = filepath.FromSlash(u.Path)
+	}
+	if utils.IsDir(srcPath) {
+		srcPath = filepath.Join(srcPath, rc.FileName)
+	}
+
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if st, err := src.Stat(); err == nil {
+		file.SetTotal(st.Size())
+	}
+	if err := file.Reset(); err != nil {
+		return err
+	}
+
+	return copyFile(ctx, file, src)
+}
+
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+func copyFile(ctx context.Context, w io.Writer, r io.Reader) error {
+	_, err := io.Copy(w, &ctxReader{ctx: ctx, r: r})
+	return err
+}
@@ -0,0 +1,152 @@
+package native
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	engine "github.com/jimi36/app-engine"
+)
+
+const (
+	defaultS3Region    = "us-east-1"
+	s3UnsignedPayload  = "UNSIGNED-PAYLOAD"
+	s3SigningAlgorithm = "AWS4-HMAC-SHA256"
+)
+
+// fetchS3File gets the object of url s3://bucket/key from an S3 compatible
+// object store with path style requests signed by signature version 4.
+// The credentials are read from the AWS_* environment variables if not set.
+func fetchS3File(ctx context.Context, rc *engine.NativeResource, file *FetchFile) error {
+	u, err := url.Parse(rc.Url)
+	if err != nil {
+		return err
+	}
+	bucket, key := u.Host, strings.TrimPrefix(u.Path, "/")
+	if len(bucket) == 0 || len(key) == 0 {
+		return errors.Errorf("s3 url %s invalid", rc.Url)
+	}
+
+	src := engine.S3Source{}
+	if rc.S3 != nil {
+		src = *rc.S3
+	}
+	if len(src.Region) == 0 {
+		src.Region = os.Getenv("AWS_REGION")
+	}
+	if len(src.Region) == 0 {
+		src.Region = defaultS3Region
+	}
+	if len(src.Endpoint) == 0 {
+		src.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", src.Region)
+	}
+	if len(src.AccessKeyId) == 0 {
+		src.AccessKeyId = os.Getenv("AWS_ACCESS_KEY_ID")
+		src.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		src.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+
+	objectUrl := strings.TrimSuffix(src.Endpoint, "/") + "/" + s3EscapePath(bucket+"/"+key)
+	req, err := http.NewRequest("GET", objectUrl, nil)
+	if err != nil {
+		return err
+	}
+	if err := setRangeHeader(req, rc, file); err != nil {
+		return err
+	}
+	if len(src.AccessKeyId) > 0 {
+		signS3Request(req, &src, time.Now().UTC())
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return saveResponse(ctx, resp, file)
+}
+
+func signS3Request(req *http.Request, src *engine.S3Source, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", s3UnsignedPayload)
+	if len(src.SessionToken) > 0 {
+		req.Header.Set("x-amz-security-token", src.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(req.Header.Get(k))
+	}
+	var names []string
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		s3UnsignedPayload,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := strings.Join([]string{date, src.Region, "s3", "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		s3SigningAlgorithm,
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+src.SecretAccessKey), date)
+	signingKey = hmacSHA256(signingKey, src.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3SigningAlgorithm, src.AccessKeyId, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3EscapePath escapes every byte of the path except the unreserved characters and '/'.
+func s3EscapePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,172 @@
+package native
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	engine "github.com/jimi36/app-engine"
+	"github.com/jimi36/app-engine/utils"
+)
+
+func newTestFetchClient() *Client {
+	return &Client{
+		fetchers: defaultFetchers(),
+		postTaskEvent: func(context.Context, interface{}, engine.TaskHandler, bool) (chan *engine.TaskResult, error) {
+			return nil, nil
+		},
+	}
+}
+
+func TestFetchRetries(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "fetch-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cli := newTestFetchClient()
+	tag := &engine.ApplicationTag{Name: "app", Version: "1.0"}
+	for _, c := range []struct {
+		retries  int
+		requests int32
+	}{
+		{-1, 1},
+		{1, 2},
+	} {
+		atomic.StoreInt32(&requests, 0)
+		rc := &engine.NativeResource{Url: ts.URL + "/app.bin", Retries: c.retries}
+		if err := cli.fetchResource(context.Background(), tag, rc, filepath.Join(dir, "app.bin")); err == nil {
+			t.Errorf("retries %d: fetch should fail", c.retries)
+		}
+		if n := atomic.LoadInt32(&requests); n != c.requests {
+			t.Errorf("retries %d: %d requests sent, want %d", c.retries, n, c.requests)
+		}
+	}
+}
+
+func TestFetchRangeNotSatisfiable(t *testing.T) {
+	content := []byte("application content")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "app.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "fetch-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cli := newTestFetchClient()
+	tag := &engine.ApplicationTag{Name: "app", Version: "1.0"}
+	rc := &engine.NativeResource{Url: ts.URL + "/app.bin", RetryBackoffSeconds: 1}
+
+	// the completed partial file, and the one longer than the resource
+	for _, part := range [][]byte{content, append(append([]byte{}, content...), "garbage"...)} {
+		filePath := filepath.Join(dir, "app.bin")
+		os.Remove(filePath)
+		if err := ioutil.WriteFile(filePath+partialFileSuffix, part, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filePath+validatorFileSuffix, []byte(`"v1"`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := cli.fetchResource(context.Background(), tag, rc, filePath); err != nil {
+			t.Fatalf("fetch error: %v", err)
+		}
+		data, err := ioutil.ReadFile(filePath)
+		if err != nil || !bytes.Equal(data, content) {
+			t.Errorf("fetched %q, want %q: %v", data, content, err)
+		}
+	}
+}
+
+func TestFetchResumeValidator(t *testing.T) {
+	content := []byte("application content")
+	etag := `"v2"`
+	var ranges int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.Header.Get("Range")) > 0 {
+			atomic.AddInt32(&ranges, 1)
+		}
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "app.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "fetch-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cli := newTestFetchClient()
+	tag := &engine.ApplicationTag{Name: "app", Version: "1.0"}
+	filePath := filepath.Join(dir, "app.bin")
+
+	cases := []struct {
+		name      string
+		part      string
+		validator string
+		rc        *engine.NativeResource
+		ranges    int32
+	}{
+		// the partial file of the old content is fetched again by If-Range
+		{"changed", "old ", `"v1"`, &engine.NativeResource{Url: ts.URL + "/app.bin"}, 1},
+		{"unchanged", "application ", `"v2"`, &engine.NativeResource{Url: ts.URL + "/app.bin"}, 1},
+		// the partial file without validator is resumed only if digests check it
+		{"no validator", "old ", "", &engine.NativeResource{Url: ts.URL + "/app.bin"}, 0},
+	}
+
+	for _, c := range cases {
+		atomic.StoreInt32(&ranges, 0)
+		os.Remove(filePath)
+		os.Remove(filePath + validatorFileSuffix)
+		if err := ioutil.WriteFile(filePath+partialFileSuffix, []byte(c.part), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if len(c.validator) > 0 {
+			if err := ioutil.WriteFile(filePath+validatorFileSuffix, []byte(c.validator), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := cli.fetchResource(context.Background(), tag, c.rc, filePath); err != nil {
+			t.Fatalf("%s: fetch error: %v", c.name, err)
+		}
+		data, err := ioutil.ReadFile(filePath)
+		if err != nil || !bytes.Equal(data, content) {
+			t.Errorf("%s: fetched %q, want %q: %v", c.name, data, content, err)
+		}
+		if n := atomic.LoadInt32(&ranges); n != c.ranges {
+			t.Errorf("%s: %d range requests sent, want %d", c.name, n, c.ranges)
+		}
+		if utils.IsExistedPath(filePath + validatorFileSuffix) {
+			t.Errorf("%s: validator file is left", c.name)
+		}
+	}
+
+	// the validator of the partial file is saved for the resume
+	rc := &engine.NativeResource{Url: ts.URL + "/app.bin"}
+	if err := fetchPartialFile(context.Background(), FetcherFunc(fetchHttpFile), rc, filePath+partialFileSuffix, func(int64, int64) {}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(filePath + validatorFileSuffix); err != nil || string(data) != etag {
+		t.Errorf("saved validator %q, want %q: %v", data, etag, err)
+	}
+}
@@ -0,0 +1,248 @@
+package native
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+
+	engine "github.com/jimi36/app-engine"
+	"github.com/jimi36/app-engine/log"
+)
+
+const (
+	defaultGCInterval = time.Hour
+)
+
+// log files of the replicas and their rotated files
+var logFilePattern = regexp.MustCompile(`^app(-\d+)?(\.err)?\.log(\.\d+)?$`)
+
+func isLogFile(name string) bool {
+	return logFilePattern.MatchString(name)
+}
+
+// onlyLogs returns whether the folder has nothing but the log files, which
+// is left by the removal keeping the logs.
+func onlyLogs(path string) bool {
+	infos, err := ioutil.ReadDir(path)
+	if err != nil {
+		return false
+	}
+	for _, info := range infos {
+		if info.IsDir() || !isLogFile(info.Name()) {
+			return false
+		}
+	}
+	return true
+}
+
+// folderSize returns the size of the regular files in the folder.
+func folderSize(path string) int64 {
+	var size int64
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// removeVersionFolder removes the version folder of the application except
+// the log files if keepLogs is set, and the application folder if it is empty.
+// It returns the reclaimed bytes.
+func removeVersionFolder(basePath string, tag *engine.ApplicationTag, keepLogs bool) (int64, error) {
+	// the folders out of the base path and the reserved ones are never removed
+	if err := engine.CheckFolderName(tag.Name); err != nil {
+		return 0, err
+	}
+	if err := engine.CheckFolderName(tag.Version); err != nil {
+		return 0, err
+	}
+	if engine.NativeReservedNames[tag.Name] {
+		return 0, errors.Errorf("%s is a reserved folder", tag.Name)
+	}
+
+	appFolder := filepath.Join(basePath, tag.Name)
+	versionFolder := filepath.Join(appFolder, tag.Version)
+
+	var reclaimed int64
+	if keepLogs {
+		infos, err := ioutil.ReadDir(versionFolder)
+		if err != nil && !os.IsNotExist(err) {
+			return 0, err
+		}
+		for _, info := range infos {
+			if !info.IsDir() && isLogFile(info.Name()) {
+				continue
+			}
+			path := filepath.Join(versionFolder, info.Name())
+			size := folderSize(path)
+			if err := os.RemoveAll(path); err != nil {
+				return reclaimed, err
+			}
+			reclaimed += size
+		}
+	} else {
+		reclaimed = folderSize(versionFolder)
+		if err := os.RemoveAll(versionFolder); err != nil {
+			return 0, err
+		}
+	}
+
+	// only an empty folder is removed
+	os.Remove(appFolder)
+
+	return reclaimed, nil
+}
+
+// garbage lists the version folders and config folders not in the store.
+type garbage struct {
+	versions []engine.ApplicationTag
+	configs  []string
+}
+
+// CollectGarbage deletes the version folders of the removed applications
+// and the folders of the removed configs. The orphans are listed in the
+// event loop and deleted in background, the result is sent to the returned
+// channel.
+func (cli *Client) CollectGarbage(ev *engine.TaskEvent) *engine.TaskResult {
+	log.Debugf("collect native garbage......")
+
+	g := &garbage{}
+
+	appInfos, _ := ioutil.ReadDir(cli.basePath)
+	for _, appInfo := range appInfos {
+		if !appInfo.IsDir() || engine.NativeReservedNames[appInfo.Name()] {
+			continue
+		}
+		versionInfos, _ := ioutil.ReadDir(filepath.Join(cli.basePath, appInfo.Name()))
+		for _, versionInfo := range versionInfos {
+			if !versionInfo.IsDir() {
+				continue
+			}
+			tag := engine.ApplicationTag{Name: appInfo.Name(), Version: versionInfo.Name()}
+			if has, err := cli.store.HasApplication(&tag); err != nil || has {
+				continue
+			}
+			if ins, found := cli.appInstances[tag.Name]; found && ins.Version == tag.Version {
+				continue
+			}
+			// the logs kept by the removal are not garbage
+			if cli.keepLogs && onlyLogs(filepath.Join(cli.basePath, tag.Name, tag.Version)) {
+				continue
+			}
+			g.versions = append(g.versions, tag)
+		}
+	}
+
+	configInfos, _ := ioutil.ReadDir(filepath.Join(cli.basePath, "config"))
+	for _, configInfo := range configInfos {
+		if !configInfo.IsDir() {
+			continue
+		}
+		if has, err := cli.store.HasConfig(configInfo.Name()); err != nil || has {
+			continue
+		}
+		g.configs = append(g.configs, configInfo.Name())
+	}
+
+	done := make(chan *engine.GCResult, 1)
+	go func() {
+		done <- cli.removeGarbage(g)
+	}()
+
+	log.Debugf("collect native garbage finished")
+
+	return &engine.TaskResult{
+		Out: (<-chan *engine.GCResult)(done),
+	}
+}
+
+func (cli *Client) removeGarbage(g *garbage) *engine.GCResult {
+	ret := &engine.GCResult{}
+
+	for i := range g.versions {
+		tag := &g.versions[i]
+		reclaimed, removed, err := cli.removeOrphanVersion(tag)
+		if err != nil {
+			log.Warnf("remove native application[%s] folder error: %s", tag.Tag(), err.Error())
+			continue
+		}
+		if !removed {
+			continue
+		}
+		ret.Paths = append(ret.Paths, filepath.Join(cli.basePath, tag.Name, tag.Version))
+		ret.ReclaimedBytes += reclaimed
+	}
+
+	for _, name := range g.configs {
+		if has, err := cli.store.HasConfig(name); err != nil || has || engine.CheckFolderName(name) != nil {
+			continue
+		}
+		configPath := genConfigPath(cli.basePath, name)
+		reclaimed := folderSize(configPath)
+		if err := os.RemoveAll(configPath); err != nil {
+			log.Warnf("remove native config[%s] folder error: %s", name, err.Error())
+			continue
+		}
+		ret.Paths = append(ret.Paths, configPath)
+		ret.ReclaimedBytes += reclaimed
+	}
+
+	return ret
+}
+
+// removeOrphanVersion removes the version folder unless the application is
+// created again after it was listed. The version lock is held through the
+// check and the removal, so the folder prepared by a start is never removed.
+func (cli *Client) removeOrphanVersion(tag *engine.ApplicationTag) (int64, bool, error) {
+	cli.versionLocks.lock(tag.Tag())
+	defer cli.versionLocks.unlock(tag.Tag())
+
+	if has, err := cli.store.HasApplication(tag); err != nil || has {
+		return 0, false, nil
+	}
+	reclaimed, err := removeVersionFolder(cli.basePath, tag, cli.keepLogs)
+	return reclaimed, err == nil, err
+}
+
+// gcLoop collects garbage periodically until the client is closed.
+func (cli *Client) gcLoop() {
+	for {
+		select {
+		case <-cli.ctx.Done():
+			return
+		case <-time.After(cli.gcInterval):
+		}
+
+		rc, err := cli.postTaskEvent(cli.ctx, nil, cli.CollectGarbage, true)
+		if err != nil {
+			log.Warnf("collect native garbage error: %s", err.Error())
+			continue
+		}
+
+		var ret *engine.TaskResult
+		select {
+		case <-cli.ctx.Done():
+			return
+		case ret = <-rc:
+		}
+		done, ok := ret.Out.(<-chan *engine.GCResult)
+		if !ok {
+			continue
+		}
+
+		select {
+		case <-cli.ctx.Done():
+			return
+		case gcRet := <-done:
+			if len(gcRet.Paths) > 0 {
+				log.Infof("collect native garbage: %d folders removed, %d bytes reclaimed", len(gcRet.Paths), gcRet.ReclaimedBytes)
+			}
+		}
+	}
+}
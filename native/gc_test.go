@@ -0,0 +1,144 @@
+package native
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	engine "github.com/jimi36/app-engine"
+)
+
+func TestRemoveVersionFolder(t *testing.T) {
+	root, err := ioutil.TempDir("", "gc-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	basePath := filepath.Join(root, "base")
+	for _, path := range []string{
+		filepath.Join(root, "outside"),
+		filepath.Join(basePath, "db"),
+		filepath.Join(basePath, "app", "1.0"),
+	} {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(basePath, "app", "1.0", "app.log"), []byte("log"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tag := range []engine.ApplicationTag{
+		{Name: "..", Version: "outside"},
+		{Name: "app", Version: "../.."},
+		{Name: "app/../..", Version: "outside"},
+		{Name: "", Version: ""},
+		{Name: "db", Version: "."},
+		{Name: ".", Version: "db"},
+	} {
+		if _, err := removeVersionFolder(basePath, &tag, false); err == nil {
+			t.Errorf("remove folder of %q:%q should fail", tag.Name, tag.Version)
+		}
+	}
+	for _, path := range []string{basePath, filepath.Join(root, "outside"), filepath.Join(basePath, "db")} {
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("%s should not be removed: %v", path, err)
+		}
+	}
+
+	reclaimed, err := removeVersionFolder(basePath, &engine.ApplicationTag{Name: "app", Version: "1.0"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reclaimed != 3 {
+		t.Errorf("reclaimed %d bytes, want 3", reclaimed)
+	}
+	if _, err := os.Stat(filepath.Join(basePath, "app")); !os.IsNotExist(err) {
+		t.Errorf("empty application folder should be removed: %v", err)
+	}
+}
+
+func TestValidateApplicationFolderName(t *testing.T) {
+	for _, tag := range []engine.ApplicationTag{
+		{Name: "", Version: "1.0"},
+		{Name: "app", Version: ""},
+		{Name: "..", Version: "1.0"},
+		{Name: "app", Version: "."},
+		{Name: "a/b", Version: "1.0"},
+		{Name: "app", Version: `..\1.0`},
+		{Name: "db", Version: "1.0"},
+		{Name: "config", Version: "1.0"},
+	} {
+		app := &engine.Application{
+			ApplicationTag: tag,
+			Type:           engine.Native,
+			NativeSpec:     &engine.NativeAppSpec{Command: []string{"/bin/true"}},
+		}
+		if err := validateApplication(app); errors.Cause(err) != engine.ErrParamInvalid {
+			t.Errorf("validate %q:%q returns %v, want %v", tag.Name, tag.Version, err, engine.ErrParamInvalid)
+		}
+		if err := engine.ValidateApplication(app); err == nil {
+			t.Errorf("engine validate %q:%q should fail", tag.Name, tag.Version)
+		}
+	}
+
+	app := &engine.Application{
+		ApplicationTag: engine.ApplicationTag{Name: "app", Version: "1.0"},
+		Type:           engine.Native,
+		NativeSpec:     &engine.NativeAppSpec{Command: []string{"/bin/true"}},
+	}
+	if err := validateApplication(app); err != nil {
+		t.Errorf("validate application error: %v", err)
+	}
+}
+
+func TestCollectGarbageKeepLogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gc-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	versionFolder := filepath.Join(dir, "app", "1.0")
+	if err := os.MkdirAll(versionFolder, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"app.log", "app.bin"} {
+		if err := ioutil.WriteFile(filepath.Join(versionFolder, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	impl, err := NewClient(BasePath(dir), GCInterval(0), KeepLogs(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli := engine.NewClient(impl)
+	if err := cli.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Stop(&engine.StopOption{})
+
+	ret, err := cli.CollectGarbage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ret.Paths) != 1 || ret.Paths[0] != versionFolder || ret.ReclaimedBytes != int64(len("app.bin")) {
+		t.Errorf("collected %v, %d bytes", ret.Paths, ret.ReclaimedBytes)
+	}
+	if _, err := os.Stat(filepath.Join(versionFolder, "app.log")); err != nil {
+		t.Errorf("log file should be kept: %v", err)
+	}
+
+	// the folder of the kept logs is not collected again
+	if ret, err = cli.CollectGarbage(); err != nil {
+		t.Fatal(err)
+	}
+	if len(ret.Paths) != 0 {
+		t.Errorf("collected %v again", ret.Paths)
+	}
+}
@@ -0,0 +1,32 @@
+package native
+
+import (
+	engine "github.com/jimi36/app-engine"
+	"github.com/jimi36/app-engine/log"
+)
+
+func (cli *Client) GetApplicationHistory(ev *engine.TaskEvent) *engine.TaskResult {
+	name, ok := ev.In.(string)
+	if !ok {
+		log.Fatalf("get native application history error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	log.Debugf("get native application[%s] history......", name)
+
+	h, err := cli.store.GetApplicationHistory(name)
+	if err != nil {
+		log.Warnf("get native application[%s] history error: %s", name, err.Error())
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
+
+	log.Debugf("get native application[%s] history finished", name)
+
+	return &engine.TaskResult{
+		Out: h,
+	}
+}
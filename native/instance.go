@@ -6,6 +6,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	engine "github.com/jimi36/app-engine"
@@ -15,21 +17,72 @@ import (
 	"github.com/shirou/gopsutil/process"
 )
 
+const (
+	defaultStopSignal      = syscall.SIGTERM
+	defaultStopGracePeriod = time.Second * 10
+	// the stop waits on the event loop, so the grace period is bounded
+	maxStopGracePeriod = time.Minute
+	// max time to wait the killed process exiting
+	killWaitTimeout = time.Second * 5
+	// max difference between the recorded start time and the create time of a process
+	startTimeTolerance = time.Second * 2
+)
+
 type Instance struct {
 	// app name
 	Name string
 	// app version
 	Version string
+	// replica index, the first one is 0
+	Index int
 	// root path
 	basePath string
 	// process
 	proc *process.Process
+	// os process, only for the process started by the instance
+	osProc *os.Process
+	// start time of the process
+	startTime time.Time
+	// exit status of the process, set before the instance is done
+	exitCode   int
+	exitSignal string
+	exitTime   time.Time
+	// stop signal and grace period
+	stopSignal syscall.Signal
+	stopGrace  time.Duration
+	// stop the descendants out of the process group
+	killDescendants bool
+	// log rotation policy
+	logPolicy *logPolicy
+	// resource limits and cgroup
+	resources    *engine.ResourceSpec
+	cgroupParent string
+	cgroup       *cgroup
+	oomKills     int
+	// working directory and environment variables
+	workDir string
+	envs    []string
+	// user, group and umask of the spec, also for the exec probes
+	spec *engine.NativeAppSpec
+	// probes and their results
+	livenessProbe  *engine.Probe
+	readinessProbe *engine.Probe
+	probeMu        sync.Mutex
+	ready          bool
+	healthy        bool
+	livenessFailed bool
+	// closed when the liveness probe fails
+	unhealthy chan struct{}
+	// time to be ready for before the upgrade is finished
+	minReady time.Duration
+	// released instead of exited
+	released bool
 	//stopped chan struct{}
 	ctx    context.Context
 	cancel context.CancelFunc
 }
 
-func CreateInstance(name, version, basePath string) (*Instance, error) {
+func CreateInstance(name, version, basePath, cgroupParent string) (*Instance, error) {
 	// create instance folder
 	appFolder := filepath.Join(basePath, name, version)
 	if !utils.IsExistedPath(appFolder) {
@@ -40,9 +93,17 @@ func CreateInstance(name, version, basePath string) (*Instance, error) {
 	}
 
 	ins := &Instance{
-		Name:     name,
-		Version:  version,
-		basePath: basePath,
+		Name:       name,
+		Version:    version,
+		basePath:   basePath,
+		exitCode:   -1,
+		minReady:   defaultMinReady,
+		stopSignal: defaultStopSignal,
+		stopGrace:  defaultStopGracePeriod,
+		logPolicy:  newLogPolicy(nil),
+		unhealthy:  make(chan struct{}),
+		// cgroup is named by application, only one version runs at a time
+		cgroupParent: cgroupParent,
 	}
 	ins.ctx, ins.cancel = context.WithCancel(context.Background())
 
@@ -67,18 +128,50 @@ func (ins *Instance) Pid() int {
 	return int(ins.proc.Pid)
 }
 
+// ApplySpec sets the stop, log and probe policies of the instance.
+func (ins *Instance) ApplySpec(app *engine.Application) {
+	spec := app.NativeSpec
+	if spec == nil {
+		return
+	}
+	ins.spec = spec
+	ins.workDir = workingDir(filepath.Join(ins.basePath, ins.Name, ins.Version), spec.WorkingDir)
+	ins.envs = append(envList(app.Env), fmt.Sprintf("%s=%d", engine.ReplicaIndexEnv, ins.Index))
+	ins.livenessProbe = spec.LivenessProbe
+	ins.readinessProbe = spec.ReadinessProbe
+	ins.logPolicy = newLogPolicy(spec.Log)
+	ins.resources = spec.Resources
+	if sig, found := stopSignals[spec.StopSignal]; found {
+		ins.stopSignal = sig
+	}
+	if spec.StopGracePeriodSeconds > 0 {
+		ins.stopGrace = maxStopGracePeriod
+		if spec.StopGracePeriodSeconds < int(maxStopGracePeriod/time.Second) {
+			ins.stopGrace = time.Duration(spec.StopGracePeriodSeconds) * time.Second
+		}
+	}
+	ins.killDescendants = spec.KillDescendants
+	if spec.MinReadySeconds > 0 {
+		ins.minReady = time.Duration(spec.MinReadySeconds) * time.Second
+	}
+}
+
 func (ins *Instance) Start(app *engine.Application) error {
 	if ins.proc != nil {
 		log.Debugf("start instance[%s] error: already started or stopped", ins.String())
 		return errors.New("instance is already started or stopped")
 	}
 
-	if err := ins.startProcess(app.NativeSpec.Command, app.Env); err != nil {
+	ins.ApplySpec(app)
+
+	if err := ins.startProcess(app.NativeSpec); err != nil {
 		log.Debugf("start instance[%s] initCmd error: %s", ins.String(), err.Error())
 		return err
 	}
 
 	go ins.monitor()
+	go ins.rotateLogs()
+	ins.startProbes()
 
 	return nil
 }
@@ -94,18 +187,63 @@ func (ins *Instance) Bind(pid int) error {
 		return err
 	}
 
+	if createTime, err := ins.proc.CreateTime(); err == nil {
+		ins.startTime = time.Unix(0, createTime*int64(time.Millisecond))
+	}
+
+	if ins.resources != nil {
+		ins.cgroup = openCgroup(ins.cgroupParent, ins.cgroupName())
+	}
+
 	go ins.monitor()
+	go ins.rotateLogs()
+	ins.startProbes()
 
 	return nil
 }
 
-func (ins *Instance) startProcess(cmds []string, envmap map[string]string) error {
+func workingDir(appFolder, dir string) string {
+	if len(dir) == 0 {
+		return appFolder
+	}
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(appFolder, dir)
+}
+
+func envList(envmap map[string]string) []string {
+	var envs []string
+	for k, v := range envmap {
+		envs = append(envs, fmt.Sprintf("%s=%s", k, v))
+	}
+	return envs
+}
+
+func (ins *Instance) startProcess(spec *engine.NativeAppSpec) error {
+	cmds := spec.Command
+	appFolder := filepath.Join(ins.basePath, ins.Name, ins.Version)
+
+	attr, err := newProcAttr(spec, ins.workDir)
+	if err != nil {
+		return err
+	}
+
+	if !utils.IsDir(attr.Dir) {
+		if err := utils.CreateFolder(attr.Dir); err != nil {
+			return err
+		}
+		if cred := attr.Credential; cred != nil {
+			os.Chown(attr.Dir, int(cred.Uid), int(cred.Gid))
+		}
+	}
+
 	stdOut := os.Stdout
 	stdErr := os.Stderr
 
-	// open log file
-	logfile := filepath.Join(ins.basePath, ins.Name, ins.Version, "app.log")
-	logWriter, err := os.Create(logfile)
+	// open log files, the ones of the previous run are rotated
+	logFiles := ins.logFiles()
+	logWriter, err := openLogFile(logFiles[0], ins.logPolicy.maxFiles)
 	if err == nil {
 		stdOut = logWriter
 		stdErr = logWriter
@@ -113,42 +251,183 @@ func (ins *Instance) startProcess(cmds []string, envmap map[string]string) error
 	} else {
 		log.Debugf("create instance[%s] log file error: %s", ins.String(), err.Error())
 	}
-
-	var envs []string
-	for k, v := range envmap {
-		envs = append(envs, fmt.Sprintf("%s=%s", k, v))
+	if len(logFiles) > 1 {
+		errWriter, err := openLogFile(logFiles[1], ins.logPolicy.maxFiles)
+		if err == nil {
+			stdErr = errWriter
+			defer errWriter.Close()
+		} else {
+			log.Debugf("create instance[%s] stderr log file error: %s", ins.String(), err.Error())
+		}
 	}
 
-	cmdBin := filepath.Join(ins.basePath, ins.Name, ins.Version, cmds[0])
+	cmdBin := filepath.Join(appFolder, cmds[0])
 	if !utils.IsExistedPath(cmdBin) || utils.IsDir(cmdBin) {
 		cmdBin = cmds[0]
 	}
 
-	osProc, err := StartProcess(cmdBin, cmds[1:], envs, stdOut, stdErr)
+	if ins.resources != nil {
+		if attr.cgroup, err = newCgroup(ins.cgroupParent, ins.cgroupName(), ins.resources); err != nil {
+			return err
+		}
+	}
+
+	osProc, err := StartProcess(cmdBin, cmds[1:], ins.envs, attr, stdOut, stdErr)
 	if err != nil {
+		if attr.cgroup != nil {
+			attr.cgroup.remove()
+		}
 		return err
 	}
+	ins.cgroup = attr.cgroup
 
 	proc, err := process.NewProcess(int32(osProc.Pid))
 	if err != nil {
 		return err
 	}
 	ins.proc = proc
+	ins.osProc = osProc
+	ins.startTime = time.Now()
 
 	return nil
 }
 
-func (ins *Instance) Stop() error {
-	if ins.proc != nil {
-		ins.proc.Kill()
+// Stop sends the stop signal to the process group and waits the grace period,
+// then kills the process group. The grace period is cut short when ctx is done.
+// The descendants out of the group are stopped too if killDescendants is set.
+// It returns whether the process was killed.
+func (ins *Instance) Stop(ctx context.Context) (bool, error) {
+	if ins.proc == nil {
+		// no process to monitor, the instance is done
+		ins.cancel()
+		return false, nil
 	}
 
-	return nil
+	// collect descendants before the leader exits, the orphans are reparented
+	var tree []*treeProcess
+	if ins.killDescendants {
+		tree = descendants(ins.proc)
+	}
+
+	killed := false
+	pid := int(ins.proc.Pid)
+	if err := signalProcessGroup(pid, ins.stopSignal); err == nil {
+		signalProcesses(tree, ins.stopSignal)
+		select {
+		case <-ins.Done():
+		case <-ctx.Done():
+			killed = true
+		case <-time.After(ins.stopGrace):
+			killed = true
+		}
+	} else {
+		log.Debugf("stop instance[%s] signal error: %s", ins.String(), err.Error())
+		killed = true
+	}
+
+	if killed {
+		log.Debugf("stop instance[%s]: kill process group", ins.String())
+		if err := signalProcessGroup(pid, syscall.SIGKILL); err != nil {
+			return true, err
+		}
+	} else {
+		// the leader is exited, kill the members left in the group
+		killProcessGroup(pid)
+	}
+	signalProcesses(tree, syscall.SIGKILL)
+
+	if killed {
+		select {
+		case <-ins.Done():
+		case <-time.After(killWaitTimeout):
+		}
+	}
+
+	return killed, nil
+}
+
+// StartTime returns the start time of the process.
+func (ins *Instance) StartTime() time.Time {
+	return ins.startTime
+}
+
+// ExitCode returns the exit code of the process after the instance is done,
+// -1 if it is unknown, e.g. the process is not a child of the engine or
+// it is killed by a signal.
+func (ins *Instance) ExitCode() int {
+	return ins.exitCode
+}
+
+// ExitSignal returns the signal which killed the process after the instance is done.
+func (ins *Instance) ExitSignal() string {
+	return ins.exitSignal
+}
+
+// OomKills returns the oom kill count of the instance cgroup.
+func (ins *Instance) OomKills() int {
+	if ins.cgroup != nil && ins.ctx.Err() == nil {
+		return ins.cgroup.oomKills()
+	}
+	return ins.oomKills
+}
+
+// ExitTime returns the exit time of the process after the instance is done.
+func (ins *Instance) ExitTime() time.Time {
+	return ins.exitTime
+}
+
+// ExitReason describes why the process exited after the instance is done.
+func (ins *Instance) ExitReason() string {
+	switch {
+	case ins.LivenessFailed():
+		return "liveness probe failed"
+	case len(ins.exitSignal) > 0 && ins.oomKills > 0:
+		return "killed by oom: " + ins.exitSignal
+	case len(ins.exitSignal) > 0:
+		return "killed by signal: " + ins.exitSignal
+	case ins.exitCode >= 0:
+		return fmt.Sprintf("exited with code %d", ins.exitCode)
+	}
+	return "exited with unknown status"
+}
+
+// Release stops monitoring the instance and cancels its pending works,
+// but leaves the process running.
+func (ins *Instance) Release() {
+	ins.released = true
+	ins.cancel()
+}
+
+// Released reports whether the instance is released rather than exited.
+func (ins *Instance) Released() bool {
+	return ins.released
+}
+
+// IsProcess reports whether the process of the instance pid is the one
+// started at startTime, the pid may be reused by another process after the
+// started one exited. It is true if startTime is unknown.
+func (ins *Instance) IsProcess(startTime time.Time) bool {
+	if ins.proc == nil || startTime.IsZero() {
+		return true
+	}
+	// read the create time again, it is cached by the bound process
+	proc, err := process.NewProcess(ins.proc.Pid)
+	if err != nil {
+		// exited, which is found by the monitor
+		return true
+	}
+	createTime, err := proc.CreateTime()
+	if err != nil {
+		return true
+	}
+	diff := time.Unix(0, createTime*int64(time.Millisecond)).Sub(startTime)
+	return diff < startTimeTolerance && diff > -startTimeTolerance
 }
 
 func (ins *Instance) GetState() (*engine.InstanceState, error) {
 	state := &engine.InstanceState{
 		Name:    ins.Name,
+		Index:   ins.Index,
 		Running: false,
 	}
 
@@ -158,33 +437,78 @@ func (ins *Instance) GetState() (*engine.InstanceState, error) {
 
 	isRunning, _ := ins.proc.IsRunning()
 	state.Running = isRunning
-
-	mem, _ := ins.proc.MemoryInfo()
-	if mem != nil {
-		state.Mem = int64(mem.RSS)
+	state.Pid = int(ins.proc.Pid)
+	state.StartTime = ins.startTime
+	state.Ready, state.Healthy = ins.probeResults()
+	state.Ready = state.Ready && isRunning
+	state.Healthy = state.Healthy && isRunning
+
+	// aggregate the whole process tree
+	procs := []*process.Process{ins.proc}
+	for _, p := range descendants(ins.proc) {
+		procs = append(procs, p.proc)
 	}
 
-	cpu, _ := ins.proc.CPUPercent()
-	state.Cpu = int64(cpu)
+	var cpuTotal float64
+	for _, p := range procs {
+		mem, _ := p.MemoryInfo()
+		if mem != nil {
+			state.Mem += int64(mem.RSS)
+		}
+		cpu, _ := p.CPUPercent()
+		cpuTotal += cpu
+	}
+	state.Cpu = int64(cpuTotal)
+	state.Processes = len(procs)
 
 	return state, nil
 }
 
 func (ins *Instance) monitor() {
-	isRunning := true
-	for isRunning {
-		select {
-		case <-time.After(time.Second * 3):
-			if proc, _ := os.FindProcess(int(ins.proc.Pid)); proc != nil {
-				proc.Wait()
+	if ins.osProc != nil {
+		// child process, reap it and get the exit status
+		st, err := ins.osProc.Wait()
+		if err == nil {
+			ins.exitCode, ins.exitSignal = exitStatus(st)
+		} else {
+			log.Debugf("wait instance[%s] error: %s", ins.String(), err.Error())
+		}
+	} else {
+		// bound process, which is not a child, the exit status is unknown
+		isRunning := true
+		for isRunning {
+			select {
+			case <-ins.ctx.Done():
+				// instance is released
+				return
+			case <-time.After(time.Second * 3):
 			}
+			isRunning, _ = process.PidExists(ins.proc.Pid)
+		}
+	}
+	ins.exitTime = time.Now()
+
+	if ins.cgroup != nil {
+		ins.oomKills = ins.cgroup.oomKills()
+		if err := ins.cgroup.remove(); err != nil {
+			log.Debugf("remove instance[%s] cgroup error: %s", ins.String(), err.Error())
 		}
-		isRunning, _ = process.PidExists(ins.proc.Pid)
 	}
 
+	log.Debugf("instance[%s] exited: %s", ins.String(), ins.ExitReason())
+
 	ins.cancel()
 }
 
+// cgroupName returns the cgroup name of the instance, the instances of two
+// versions run together while upgrading.
+func (ins *Instance) cgroupName() string {
+	if ins.Index > 0 {
+		return fmt.Sprintf("%s_%s_%d", ins.Name, ins.Version, ins.Index)
+	}
+	return ins.Name + "_" + ins.Version
+}
+
 func (ins *Instance) String() string {
 	return strings.Join([]string{ins.Name, ins.Version}, ":")
 }
@@ -0,0 +1,436 @@
+package native
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	engine "github.com/jimi36/app-engine"
+	"github.com/jimi36/app-engine/log"
+	"github.com/jimi36/app-engine/utils"
+)
+
+const (
+	stdoutLogFile = "app.log"
+	stderrLogFile = "app.err.log"
+
+	defaultLogMaxSizeMB = 10
+	defaultLogMaxFiles  = 5
+
+	logRotateInterval = time.Second * 30
+	logFollowInterval = time.Millisecond * 500
+	logTailBlockSize  = 4096
+)
+
+type logPolicy struct {
+	maxSize     int64
+	maxAge      time.Duration
+	maxFiles    int
+	splitStderr bool
+}
+
+func newLogPolicy(p *engine.LogPolicy) *logPolicy {
+	policy := &logPolicy{
+		maxSize:  defaultLogMaxSizeMB * 1024 * 1024,
+		maxFiles: defaultLogMaxFiles,
+	}
+	if p == nil {
+		return policy
+	}
+	if p.MaxSizeMB > 0 {
+		policy.maxSize = int64(p.MaxSizeMB) * 1024 * 1024
+	}
+	if p.MaxAgeHours > 0 {
+		policy.maxAge = time.Duration(p.MaxAgeHours) * time.Hour
+	}
+	if p.MaxFiles > 0 {
+		policy.maxFiles = p.MaxFiles
+	}
+	policy.splitStderr = p.SplitStderr
+	return policy
+}
+
+func rotatedLogFile(logFile string, i int) string {
+	return logFile + "." + strconv.Itoa(i)
+}
+
+// shiftLogFiles shifts the rotated files to make room for the newest one,
+// the oldest ones beyond maxFiles are removed.
+func shiftLogFiles(logFile string, maxFiles int) {
+	for i := maxFiles; utils.IsExistedPath(rotatedLogFile(logFile, i)); i++ {
+		os.Remove(rotatedLogFile(logFile, i))
+	}
+	for i := maxFiles - 1; i > 0; i-- {
+		if utils.IsExistedPath(rotatedLogFile(logFile, i)) {
+			os.Rename(rotatedLogFile(logFile, i), rotatedLogFile(logFile, i+1))
+		}
+	}
+}
+
+// rotateLogFile moves the log file of the previous run aside.
+func rotateLogFile(logFile string, maxFiles int) error {
+	if st, err := os.Stat(logFile); err != nil || st.Size() == 0 {
+		return nil
+	}
+	shiftLogFiles(logFile, maxFiles)
+	return os.Rename(logFile, rotatedLogFile(logFile, 1))
+}
+
+// copyTruncateLogFile rotates the log file which is still written by the process,
+// the process writes the file with O_APPEND, so it goes on at the new end.
+func copyTruncateLogFile(logFile string, maxFiles int) error {
+	shiftLogFiles(logFile, maxFiles)
+
+	src, err := os.Open(logFile)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(rotatedLogFile(logFile, 1))
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, src); err != nil {
+		return err
+	}
+
+	return os.Truncate(logFile, 0)
+}
+
+func openLogFile(logFile string, maxFiles int) (*os.File, error) {
+	if err := rotateLogFile(logFile, maxFiles); err != nil {
+		log.Debugf("rotate log file[%s] error: %s", logFile, err.Error())
+	}
+	return os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+}
+
+// replicaLogFile returns the log file name of the replica, e.g. app-1.log
+// and app-1.err.log, the first replica uses the original names.
+func replicaLogFile(logFile string, index int) string {
+	if index == 0 {
+		return logFile
+	}
+	return "app-" + strconv.Itoa(index) + strings.TrimPrefix(logFile, "app")
+}
+
+func (ins *Instance) logFiles() []string {
+	appFolder := filepath.Join(ins.basePath, ins.Name, ins.Version)
+	logFiles := []string{filepath.Join(appFolder, replicaLogFile(stdoutLogFile, ins.Index))}
+	if ins.logPolicy.splitStderr {
+		logFiles = append(logFiles, filepath.Join(appFolder, replicaLogFile(stderrLogFile, ins.Index)))
+	}
+	return logFiles
+}
+
+// rotateLogs rotates the log files by size and age until the instance is done.
+func (ins *Instance) rotateLogs() {
+	rotated := time.Now()
+	for {
+		select {
+		case <-ins.Done():
+			return
+		case <-time.After(logRotateInterval):
+		}
+
+		expired := ins.logPolicy.maxAge > 0 && time.Since(rotated) > ins.logPolicy.maxAge
+		for _, logFile := range ins.logFiles() {
+			st, err := os.Stat(logFile)
+			if err != nil || st.Size() == 0 {
+				continue
+			}
+			if st.Size() < ins.logPolicy.maxSize && !expired {
+				continue
+			}
+			if err := copyTruncateLogFile(logFile, ins.logPolicy.maxFiles); err != nil {
+				log.Debugf("rotate instance[%s] log file error: %s", ins.String(), err.Error())
+			}
+		}
+		if expired {
+			rotated = time.Now()
+		}
+	}
+}
+
+func (cli *Client) GetApplicationLogs(ev *engine.TaskEvent) *engine.TaskResult {
+	req, ok := ev.In.(*engine.LogRequest)
+	if !ok {
+		log.Fatalf("get native application logs error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	tag := req.Tag
+	opt := req.Option
+	if opt == nil {
+		opt = &engine.LogOption{}
+	}
+
+	log.Debugf("get native application[%s] logs......", tag.Tag())
+
+	if has, _ := cli.store.HasApplication(tag); !has {
+		log.Warnf("get native application[%s] logs error: %s", tag.Tag(), engine.ErrApplicationNoExisted.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrApplicationNoExisted,
+		}
+	}
+
+	// the instance is the replica index
+	index := 0
+	if len(opt.Instance) > 0 {
+		i, err := strconv.Atoi(opt.Instance)
+		if err != nil || i < 0 {
+			log.Warnf("get native application[%s] logs error: %s", tag.Tag(), engine.ErrParamInvalid.Error())
+			return &engine.TaskResult{
+				Err: engine.ErrParamInvalid,
+			}
+		}
+		index = i
+	}
+
+	logFile := filepath.Join(cli.basePath, tag.Name, tag.Version, replicaLogFile(stdoutLogFile, index))
+	if opt.Stderr {
+		logFile = filepath.Join(cli.basePath, tag.Name, tag.Version, replicaLogFile(stderrLogFile, index))
+	}
+
+	data, size, err := tailLogFiles(logFile, opt.TailLines, opt.Since)
+	if err != nil {
+		log.Warnf("get native application[%s] logs error: %s", tag.Tag(), err.Error())
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
+
+	var rc io.ReadCloser = ioutil.NopCloser(bytes.NewReader(data))
+	if opt.Follow {
+		rc = newFollowReader(data, logFile, size)
+	}
+
+	log.Debugf("get native application[%s] logs finished", tag.Tag())
+
+	return &engine.TaskResult{
+		Out: rc,
+	}
+}
+
+// tailLogFiles reads the last lines of the log file and its rotated files,
+// the rotated files modified before since are skipped. It returns the data
+// and the size of the current log file.
+func tailLogFiles(logFile string, lines int, since time.Time) ([]byte, int64, error) {
+	files := []string{logFile}
+	for i := 1; utils.IsExistedPath(rotatedLogFile(logFile, i)); i++ {
+		files = append(files, rotatedLogFile(logFile, i))
+	}
+
+	var size int64
+	var chunks [][]byte
+	for i, file := range files {
+		st, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		if i == 0 {
+			size = st.Size()
+		}
+		if !since.IsZero() && st.ModTime().Before(since) {
+			break
+		}
+
+		data, n, err := tailFile(file, lines)
+		if err != nil {
+			return nil, 0, err
+		}
+		chunks = append(chunks, data)
+
+		if lines > 0 {
+			if lines -= n; lines <= 0 {
+				break
+			}
+		}
+	}
+
+	// newest chunk is the first one
+	var buf bytes.Buffer
+	for i := len(chunks) - 1; i >= 0; i-- {
+		buf.Write(chunks[i])
+	}
+
+	return buf.Bytes(), size, nil
+}
+
+// tailFile reads the last lines of the file, all lines if lines <= 0.
+// It returns the data and the line count of the data.
+func tailFile(file string, lines int) ([]byte, int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	if lines <= 0 {
+		data, err := ioutil.ReadAll(f)
+		return data, bytes.Count(data, []byte{'\n'}), err
+	}
+
+	st, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// read blocks backward until enough lines
+	var data []byte
+	pos := st.Size()
+	for pos > 0 && bytes.Count(bytes.TrimSuffix(data, []byte{'\n'}), []byte{'\n'}) < lines {
+		n := int64(logTailBlockSize)
+		if pos < n {
+			n = pos
+		}
+		pos -= n
+		block := make([]byte, n)
+		if _, err := f.ReadAt(block, pos); err != nil && err != io.EOF {
+			return nil, 0, err
+		}
+		data = append(block, data...)
+	}
+
+	// cut the extra lines
+	count := 0
+	for i := len(bytes.TrimSuffix(data, []byte{'\n'})) - 1; i >= 0; i-- {
+		if data[i] == '\n' {
+			if count++; count == lines {
+				data = data[i+1:]
+				break
+			}
+		}
+	}
+
+	return data, bytes.Count(data, []byte{'\n'}), nil
+}
+
+// followReader returns the tail data first, then follows the log file
+// from offset until it is closed.
+type followReader struct {
+	head    *bytes.Reader
+	logFile string
+	offset  int64
+	mu      sync.Mutex
+	file    *os.File
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+func newFollowReader(head []byte, logFile string, offset int64) *followReader {
+	r := &followReader{
+		head:    bytes.NewReader(head),
+		logFile: logFile,
+		offset:  offset,
+	}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	return r
+}
+
+func (r *followReader) Read(p []byte) (int, error) {
+	if r.head.Len() > 0 {
+		return r.head.Read(p)
+	}
+
+	for {
+		n, err := r.readFile(p)
+		if n > 0 || err != nil {
+			return n, err
+		}
+
+		select {
+		case <-r.ctx.Done():
+		case <-time.After(logFollowInterval):
+		}
+	}
+}
+
+func (r *followReader) readFile(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.ctx.Err() != nil {
+		return 0, io.EOF
+	}
+
+	if r.file == nil {
+		f, err := os.Open(r.logFile)
+		if err != nil {
+			// not created yet
+			return 0, nil
+		}
+		r.file = f
+	}
+
+	for {
+		n, err := r.file.ReadAt(p, r.offset)
+		r.offset += int64(n)
+		if err == io.EOF {
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+
+		// the opened file is drained, follow the new one if it's rotated
+		if reopened, err := r.checkRotated(); !reopened {
+			return 0, err
+		}
+	}
+}
+
+// checkRotated reopens the log file if the opened one was renamed by the
+// rotation, or rewinds it if it was truncated in place. It returns whether
+// the new file is opened.
+func (r *followReader) checkRotated() (bool, error) {
+	st, err := os.Stat(r.logFile)
+	if err != nil {
+		// renamed and the new one is not created yet
+		return false, nil
+	}
+	opened, err := r.file.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	if os.SameFile(st, opened) {
+		if opened.Size() < r.offset {
+			// copied and truncated
+			r.offset = 0
+		}
+		return false, nil
+	}
+
+	f, err := os.Open(r.logFile)
+	if err != nil {
+		return false, nil
+	}
+	r.file.Close()
+	r.file = f
+	r.offset = 0
+	return true, nil
+}
+
+func (r *followReader) Close() error {
+	r.cancel()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file != nil {
+		return r.file.Close()
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package native
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// pollFollowReader reads the followed data until there is nothing new in a
+// few polls.
+func pollFollowReader(t *testing.T, r *followReader) string {
+	var out []byte
+	buf := make([]byte, 4)
+	for idle := 0; idle < 3; {
+		n, err := r.readFile(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			idle++
+			continue
+		}
+		idle = 0
+		out = append(out, buf[:n]...)
+	}
+	return string(out)
+}
+
+func appendLog(t *testing.T, logFile, data string) {
+	f, err := os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFollowReaderRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logFile := filepath.Join(dir, stdoutLogFile)
+	appendLog(t, logFile, "first run\n")
+
+	r := newFollowReader(nil, logFile, 0)
+	defer r.Close()
+	if data := pollFollowReader(t, r); data != "first run\n" {
+		t.Fatalf("followed %q", data)
+	}
+
+	// renamed on restart, the rest of the old file is read before the new one
+	appendLog(t, logFile, "first exit\n")
+	if err := rotateLogFile(logFile, 3); err != nil {
+		t.Fatal(err)
+	}
+	appendLog(t, logFile, "second\n")
+	if data := pollFollowReader(t, r); data != "first exit\nsecond\n" {
+		t.Fatalf("followed %q after the rename", data)
+	}
+
+	// copied and truncated in place by the size rotation
+	appendLog(t, logFile, "second run\n")
+	if data := pollFollowReader(t, r); data != "second run\n" {
+		t.Fatalf("followed %q", data)
+	}
+	if err := copyTruncateLogFile(logFile, 3); err != nil {
+		t.Fatal(err)
+	}
+	appendLog(t, logFile, "trunc\n")
+	if data := pollFollowReader(t, r); data != "trunc\n" {
+		t.Fatalf("followed %q after the truncation", data)
+	}
+
+	data, err := ioutil.ReadFile(rotatedLogFile(logFile, 2))
+	if err != nil || string(data) != "first run\nfirst exit\n" {
+		t.Fatalf("rotated file %q: %v", data, err)
+	}
+}
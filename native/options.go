@@ -3,6 +3,7 @@ package native
 import (
 	"os"
 	"strings"
+	"time"
 
 	engine "github.com/jimi36/app-engine"
 )
@@ -29,6 +30,97 @@ func BasePath(basePath string) engine.Option {
 	}
 }
 
+// CgroupParent sets the cgroup v2 folder under which the applications with
+// resource limits are placed, /sys/fs/cgroup/app-engine by default.
+func CgroupParent(path string) engine.Option {
+	return func(cli engine.ClientImpl) error {
+		c, ok := cli.(*Client)
+		if !ok {
+			return engine.ErrOptionInvalid
+		}
+		c.cgroupParent = path
+		return nil
+	}
+}
+
+// ArtifactCacheSize sets the size cap of the artifact cache in MB, 4096 by
+// default, and the cache is not evicted if the size is not positive.
+func ArtifactCacheSize(mb int64) engine.Option {
+	return func(cli engine.ClientImpl) error {
+		c, ok := cli.(*Client)
+		if !ok {
+			return engine.ErrOptionInvalid
+		}
+		c.cacheSize = mb
+		return nil
+	}
+}
+
+// GCInterval sets the interval of deleting the folders of the removed
+// applications and configs, 1 hour by default, and 0 disables it.
+func GCInterval(interval time.Duration) engine.Option {
+	return func(cli engine.ClientImpl) error {
+		c, ok := cli.(*Client)
+		if !ok {
+			return engine.ErrOptionInvalid
+		}
+		c.gcInterval = interval
+		return nil
+	}
+}
+
+// KeepLogs keeps the log files in the version folder when the application is removed.
+func KeepLogs(keep bool) engine.Option {
+	return func(cli engine.ClientImpl) error {
+		c, ok := cli.(*Client)
+		if !ok {
+			return engine.ErrOptionInvalid
+		}
+		c.keepLogs = keep
+		return nil
+	}
+}
+
+// Trust sets the trust store verifying the resource signatures.
+func Trust(ts *TrustStore) engine.Option {
+	return func(cli engine.ClientImpl) error {
+		c, ok := cli.(*Client)
+		if !ok {
+			return engine.ErrOptionInvalid
+		}
+		c.trustStore = ts
+		return nil
+	}
+}
+
+// RequireSignature refuses the unsigned resources.
+func RequireSignature(require bool) engine.Option {
+	return func(cli engine.ClientImpl) error {
+		c, ok := cli.(*Client)
+		if !ok {
+			return engine.ErrOptionInvalid
+		}
+		c.requireSignature = require
+		return nil
+	}
+}
+
+// ResourceFetcher registers the fetcher of the resource type, which is
+// matched with NativeResource.Type or the scheme of NativeResource.Url.
+func ResourceFetcher(typ string, fetcher Fetcher) engine.Option {
+	return func(cli engine.ClientImpl) error {
+		c, ok := cli.(*Client)
+		if !ok {
+			return engine.ErrOptionInvalid
+		}
+		if len(typ) == 0 || fetcher == nil {
+			return engine.ErrOptionInvalid
+		}
+		c.fetchers[strings.ToLower(typ)] = fetcher
+		return nil
+	}
+}
+
 func EnvVariable(key, value string) engine.Option {
 	return func(cli engine.ClientImpl) error {
 		if _, ok := cli.(*Client); !ok {
@@ -0,0 +1,310 @@
+package native
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	engine "github.com/jimi36/app-engine"
+	"github.com/jimi36/app-engine/log"
+)
+
+const (
+	defaultProbePeriod           = time.Second * 10
+	defaultProbeTimeout          = time.Second
+	defaultProbeFailureThreshold = 3
+	defaultProbeSuccessThreshold = 1
+	defaultProbeHost             = "127.0.0.1"
+)
+
+func validateProbe(probe *engine.Probe) error {
+	if probe == nil {
+		return nil
+	}
+	handlers := 0
+	if probe.Exec != nil {
+		if len(probe.Exec.Command) == 0 {
+			return errors.New("probe exec command is empty")
+		}
+		handlers++
+	}
+	if probe.HttpGet != nil {
+		if probe.HttpGet.Port <= 0 {
+			return errors.New("probe http port invalid")
+		}
+		handlers++
+	}
+	if probe.TcpSocket != nil {
+		if probe.TcpSocket.Port <= 0 {
+			return errors.New("probe tcp port invalid")
+		}
+		handlers++
+	}
+	if handlers != 1 {
+		return errors.New("probe must have exactly one handler")
+	}
+	return nil
+}
+
+func (ins *Instance) startProbes() {
+	ins.probeMu.Lock()
+	ins.ready = ins.readinessProbe == nil
+	ins.healthy = true
+	ins.probeMu.Unlock()
+
+	if ins.livenessProbe != nil {
+		go ins.runProbe("liveness", ins.livenessProbe, ins.setHealthy)
+	}
+	if ins.readinessProbe != nil {
+		go ins.runProbe("readiness", ins.readinessProbe, ins.setReady)
+	}
+}
+
+func (ins *Instance) probeResults() (bool, bool) {
+	ins.probeMu.Lock()
+	defer ins.probeMu.Unlock()
+	return ins.ready, ins.healthy
+}
+
+// readyFor returns whether the instance has been running for the duration and
+// is ready and healthy now, and an error if the instance is exited.
+func (ins *Instance) readyFor(d time.Duration) (bool, error) {
+	select {
+	case <-ins.Done():
+		return false, errors.New(ins.ExitReason())
+	default:
+	}
+	if ins.proc == nil {
+		return false, nil
+	}
+	if ins.LivenessFailed() {
+		return false, errors.New("liveness probe failed")
+	}
+	if ready, healthy := ins.probeResults(); !ready || !healthy {
+		return false, nil
+	}
+	return time.Since(ins.startTime) >= d, nil
+}
+
+// LivenessFailed returns whether the instance is stopped by the liveness probe.
+func (ins *Instance) LivenessFailed() bool {
+	ins.probeMu.Lock()
+	defer ins.probeMu.Unlock()
+	return ins.livenessFailed
+}
+
+func (ins *Instance) setReady(ready bool) {
+	ins.probeMu.Lock()
+	ins.ready = ready
+	ins.probeMu.Unlock()
+}
+
+// Unhealthy returns a channel closed when the liveness probe fails.
+func (ins *Instance) Unhealthy() <-chan struct{} {
+	return ins.unhealthy
+}
+
+// setHealthy notifies the failure of the liveness probe, the instance is
+// stopped on the event loop, then the restart policy takes effect.
+func (ins *Instance) setHealthy(healthy bool) {
+	ins.probeMu.Lock()
+	defer ins.probeMu.Unlock()
+	ins.healthy = healthy
+	if !healthy && !ins.livenessFailed {
+		log.Warnf("instance[%s] liveness probe failed", ins.String())
+		ins.livenessFailed = true
+		close(ins.unhealthy)
+	}
+}
+
+// stopUnhealthyInstance stops the instance failing the liveness probe, its
+// exit is handled by the restart policy of the application.
+func (cli *Client) stopUnhealthyInstance(ev *engine.TaskEvent) *engine.TaskResult {
+	ins, ok := ev.In.(*Instance)
+	if !ok {
+		log.Fatalf("stop native unhealthy instance error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	// the instance is stopped or replaced already
+	if ins.Index == 0 && cli.appInstances[ins.Name] != ins {
+		return &engine.TaskResult{}
+	}
+	if replicas := cli.replicas[ins.Name]; ins.Index > 0 && (ins.Index > len(replicas) || replicas[ins.Index-1] != ins) {
+		return &engine.TaskResult{}
+	}
+
+	log.Debugf("stop native unhealthy instance[%s]......", ins.String())
+
+	if _, err := ins.Stop(context.Background()); err != nil {
+		log.Warnf("stop native unhealthy instance[%s] error: %s", ins.String(), err.Error())
+	}
+
+	log.Debugf("stop native unhealthy instance[%s] finished", ins.String())
+
+	return &engine.TaskResult{}
+}
+
+// runProbe runs the probe periodically until the instance is done, set is
+// called when the result changes after reaching the threshold.
+func (ins *Instance) runProbe(name string, probe *engine.Probe, set func(bool)) {
+	period := defaultProbePeriod
+	if probe.PeriodSeconds > 0 {
+		period = time.Duration(probe.PeriodSeconds) * time.Second
+	}
+	timeout := defaultProbeTimeout
+	if probe.TimeoutSeconds > 0 {
+		timeout = time.Duration(probe.TimeoutSeconds) * time.Second
+	}
+	failureThreshold := defaultProbeFailureThreshold
+	if probe.FailureThreshold > 0 {
+		failureThreshold = probe.FailureThreshold
+	}
+	successThreshold := defaultProbeSuccessThreshold
+	if probe.SuccessThreshold > 0 {
+		successThreshold = probe.SuccessThreshold
+	}
+
+	select {
+	case <-ins.Done():
+		return
+	case <-time.After(time.Duration(probe.InitialDelaySeconds) * time.Second):
+	}
+
+	successes, failures := 0, 0
+	for {
+		err := ins.probe(probe, timeout)
+		if err == nil {
+			successes, failures = successes+1, 0
+			if successes == successThreshold {
+				set(true)
+			}
+		} else {
+			log.Debugf("instance[%s] %s probe error: %s", ins.String(), name, err.Error())
+			successes, failures = 0, failures+1
+			if failures == failureThreshold {
+				set(false)
+			}
+		}
+
+		select {
+		case <-ins.Done():
+			return
+		case <-time.After(period):
+		}
+	}
+}
+
+func (ins *Instance) probe(probe *engine.Probe, timeout time.Duration) error {
+	switch {
+	case probe.Exec != nil:
+		return ins.execProbe(probe.Exec.Command, timeout)
+
+	case probe.HttpGet != nil:
+		get := probe.HttpGet
+		host := get.Host
+		if len(host) == 0 {
+			host = defaultProbeHost
+		}
+		scheme := get.Scheme
+		if len(scheme) == 0 {
+			scheme = "http"
+		}
+		url := fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(host, strconv.Itoa(int(get.Port))), get.Path)
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return err
+		}
+		for k, v := range get.Headers {
+			req.Header.Set(k, v)
+		}
+		cli := &http.Client{Timeout: timeout}
+		resp, err := cli.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+			return errors.New(resp.Status)
+		}
+		return nil
+
+	case probe.TcpSocket != nil:
+		host := probe.TcpSocket.Host
+		if len(host) == 0 {
+			host = defaultProbeHost
+		}
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(int(probe.TcpSocket.Port))), timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	return errors.New("probe has no handler")
+}
+
+// execProbe runs the probe command as the process of the instance, with its
+// user, group, umask and working directory. It is killed after the timeout.
+func (ins *Instance) execProbe(cmds []string, timeout time.Duration) error {
+	if ins.spec == nil {
+		return errors.New("instance spec not applied")
+	}
+	attr, err := newProcAttr(ins.spec, ins.workDir)
+	if err != nil {
+		return err
+	}
+	bin, err := exec.LookPath(cmds[0])
+	if err != nil {
+		return err
+	}
+
+	null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer null.Close()
+
+	proc, err := StartProcess(bin, cmds, ins.envs, attr, null, null)
+	if err != nil {
+		return err
+	}
+
+	var st *os.ProcessState
+	done := make(chan struct{})
+	go func() {
+		st, err = proc.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		killProcessGroup(proc.Pid)
+		<-done
+		return errors.New("probe timeout")
+	case <-ins.Done():
+		killProcessGroup(proc.Pid)
+		<-done
+		return errors.New("instance is done")
+	}
+
+	if err != nil {
+		return err
+	}
+	if !st.Success() {
+		return errors.New(st.String())
+	}
+	return nil
+}
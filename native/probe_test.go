@@ -0,0 +1,75 @@
+package native
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	engine "github.com/jimi36/app-engine"
+)
+
+// TestLivenessProbeRestart checks the instance failing the liveness probe is
+// stopped and restarted by the policy, and the exec probe runs with the
+// umask and working directory of the application.
+func TestLivenessProbeRestart(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("#!/bin/sh\nsleep 10\n"))
+	}))
+	defer ts.Close()
+
+	workDir, err := ioutil.TempDir("", "probe-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(workDir)
+
+	cli, cleanup := newTestEngine(t)
+	defer cleanup()
+
+	tag := &engine.ApplicationTag{Name: "app", Version: "1.0"}
+	app := &engine.Application{
+		ApplicationTag: *tag,
+		Type:           engine.Native,
+		NativeSpec: &engine.NativeAppSpec{
+			Command:    []string{"/bin/sh", "sh", "-c", "sleep 10"},
+			Umask:      "027",
+			WorkingDir: workDir,
+			Restart:    &engine.RestartPolicy{Type: engine.RestartOnFailure, BackoffSeconds: 1},
+			LivenessProbe: &engine.Probe{
+				Exec: &engine.ExecProbe{
+					Command: []string{"/bin/sh", "-c", "umask > umask.out; exit 1"},
+				},
+				PeriodSeconds:    1,
+				FailureThreshold: 1,
+			},
+			Rc: &engine.NativeResource{
+				FileName: "app.sh",
+				Url:      ts.URL + "/app.sh",
+			},
+		},
+	}
+	if err := cli.CreateApplication(app); err != nil {
+		t.Fatal(err)
+	}
+
+	w := cli.Watch(&engine.WatchOption{Names: []string{"app"}})
+	defer w.Stop()
+	if err := cli.StartApplication(tag); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, w, engine.ApplicationStarted)
+	waitEvent(t, w, engine.ApplicationExited)
+	waitEvent(t, w, engine.ApplicationStarted)
+	if err := cli.StopApplication(tag); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(workDir, "umask.out"))
+	if err != nil || strings.TrimSpace(string(data)) != "0027" {
+		t.Errorf("probe umask %q: %v", data, err)
+	}
+}
@@ -2,21 +2,121 @@ package native
 
 import (
 	"os"
+	"runtime"
+	"sync"
 	"syscall"
+
+	"github.com/pkg/errors"
 )
 
-func StartProcess(cmd string, args, env []string, stdOut, stdErr *os.File) (*os.Process, error) {
+// umask is process wide, so the process starting with umask is serialized
+var umaskLock sync.Mutex
+
+func StartProcess(cmd string, args, env []string, attr *ProcAttr, stdOut, stdErr *os.File) (*os.Process, error) {
+	sysAttr := &syscall.SysProcAttr{
+		Setsid: true,
+	}
+	if attr.Credential != nil {
+		sysAttr.Credential = &syscall.Credential{
+			Uid:    attr.Credential.Uid,
+			Gid:    attr.Credential.Gid,
+			Groups: attr.Credential.Groups,
+		}
+	}
+
+	if attr.Umask >= 0 {
+		// the child inherits the umask at fork
+		umaskLock.Lock()
+		old := syscall.Umask(attr.Umask)
+		defer func() {
+			syscall.Umask(old)
+			umaskLock.Unlock()
+		}()
+	}
+
+	if attr.cgroup != nil {
+		// the child stops at the exec under ptrace, it is moved into the
+		// cgroup before the command runs any instruction, the ptrace
+		// requests must come from the thread forking the child
+		sysAttr.Ptrace = true
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+	}
+
 	proc, err := os.StartProcess(cmd, args, &os.ProcAttr{
+		Dir: attr.Dir,
 		Files: []*os.File{
 			nil, stdOut, stdErr,
 		},
 		Env: env,
-		Sys: &syscall.SysProcAttr{
-			Setsid: true,
-		},
+		Sys: sysAttr,
 	})
 	if err != nil {
 		return nil, err
 	}
+
+	if attr.cgroup != nil {
+		if err := joinCgroup(proc.Pid, attr.cgroup); err != nil {
+			proc.Kill()
+			proc.Wait()
+			return nil, err
+		}
+	}
 	return proc, nil
 }
+
+// joinCgroup moves the child stopped at the exec into cg and resumes it.
+func joinCgroup(pid int, cg *cgroup) error {
+	var ws syscall.WaitStatus
+	for {
+		_, err := syscall.Wait4(pid, &ws, syscall.WALL, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return errors.Wrap(err, "wait process stopped error")
+		}
+		break
+	}
+	if !ws.Stopped() || ws.StopSignal() != syscall.SIGTRAP {
+		return errors.New("process is not stopped at the exec")
+	}
+	if err := cg.addProcess(pid); err != nil {
+		return errors.Wrap(err, "add process to cgroup error")
+	}
+	if err := syscall.PtraceDetach(pid); err != nil {
+		return errors.Wrap(err, "resume process error")
+	}
+	return nil
+}
+
+func exitStatus(st *os.ProcessState) (int, string) {
+	if ws, ok := st.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return -1, ws.Signal().String()
+	}
+	return st.ExitCode(), ""
+}
+
+var stopSignals = map[string]syscall.Signal{
+	"SIGTERM": syscall.SIGTERM,
+	"SIGINT":  syscall.SIGINT,
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+	"SIGKILL": syscall.SIGKILL,
+}
+
+// signalProcessGroup signals the process group created by Setsid,
+// or the single process if it is not a group leader.
+func signalProcessGroup(pid int, sig syscall.Signal) error {
+	if err := syscall.Kill(-pid, sig); err != nil {
+		return syscall.Kill(pid, sig)
+	}
+	return nil
+}
+
+// killProcessGroup kills the members of the process group only.
+func killProcessGroup(pid int) error {
+	return syscall.Kill(-pid, syscall.SIGKILL)
+}
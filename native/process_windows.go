@@ -1,11 +1,21 @@
 package native
 
 import (
+	"errors"
 	"os"
+	"syscall"
 )
 
-func StartProcess(cmd string, args, env []string, stdOut, stdErr *os.File) (*os.Process, error) {
+// StartProcess doesn't support credential, umask and cgroup on windows.
+func StartProcess(cmd string, args, env []string, attr *ProcAttr, stdOut, stdErr *os.File) (*os.Process, error) {
+	if attr.Credential != nil || attr.Umask >= 0 {
+		return nil, errors.New("credential and umask not supported")
+	}
+	if attr.cgroup != nil {
+		return nil, errors.New("cgroup not supported")
+	}
 	proc, err := os.StartProcess(cmd, args, &os.ProcAttr{
+		Dir: attr.Dir,
 		Files: []*os.File{
 			nil, stdOut, stdErr,
 		},
@@ -16,3 +26,30 @@ func StartProcess(cmd string, args, env []string, stdOut, stdErr *os.File) (*os.
 	}
 	return proc, nil
 }
+
+func exitStatus(st *os.ProcessState) (int, string) {
+	return st.ExitCode(), ""
+}
+
+var stopSignals = map[string]syscall.Signal{
+	"SIGTERM": syscall.SIGTERM,
+	"SIGINT":  syscall.SIGINT,
+	"SIGKILL": syscall.SIGKILL,
+}
+
+// signalProcessGroup only supports SIGKILL on windows.
+func signalProcessGroup(pid int, sig syscall.Signal) error {
+	if sig != syscall.SIGKILL {
+		return errors.New("signal not supported")
+	}
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return proc.Kill()
+}
+
+// killProcessGroup is a no-op, there are no process groups on windows.
+func killProcessGroup(pid int) error {
+	return nil
+}
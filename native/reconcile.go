@@ -0,0 +1,196 @@
+package native
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	engine "github.com/jimi36/app-engine"
+	"github.com/jimi36/app-engine/log"
+)
+
+func (cli *Client) ReconcileApplications(ev *engine.TaskEvent) *engine.TaskResult {
+	opt, ok := ev.In.(*engine.ReconcileOption)
+	if !ok {
+		log.Fatalf("reconcile native applications error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	log.Debugf("reconcile native applications......")
+
+	rts := make(map[string]*engine.ApplicationRuntime)
+	var names []string
+	cli.store.ForeachApplicationRunTime(func(rt *engine.ApplicationRuntime) {
+		rts[rt.Name] = rt
+		names = append(names, rt.Name)
+	})
+	sort.Strings(names)
+
+	var actions []*engine.ReconcileAction
+
+	// the instances which shouldn't be running
+	for name, ins := range cli.appInstances {
+		if cli.upgrading[name] || isDone(ins) {
+			// the exited instance is being cleaned
+			continue
+		}
+		if rt := rts[name]; rt != nil && rt.ToStart && rt.Version == ins.Version {
+			continue
+		}
+		action := &engine.ReconcileAction{
+			ApplicationTag: engine.ApplicationTag{Name: ins.Name, Version: ins.Version},
+			Type:           engine.ReconcileStop,
+			Reason:         "application is not to be started",
+		}
+		if !opt.DryRun {
+			cli.reconcileStop(ev.Context(), ins, action)
+		}
+		actions = append(actions, action)
+	}
+
+	// the applications which should be running
+	for _, name := range names {
+		rt := rts[name]
+		if !rt.ToStart || cli.upgrading[name] {
+			continue
+		}
+		tag := &engine.ApplicationTag{Name: rt.Name, Version: rt.Version}
+
+		ins, found := cli.appInstances[name]
+		if !found {
+			// restarted later, or not restarted by the policy
+			if cli.pendingRestarts[name] != nil || cli.exited[name] {
+				continue
+			}
+			action := &engine.ReconcileAction{
+				ApplicationTag: *tag,
+				Type:           engine.ReconcileStart,
+				Reason:         "application instance is missing",
+			}
+			if !opt.DryRun {
+				ret := cli.RestartApplication(&engine.TaskEvent{Ctx: ev.Ctx, In: tag})
+				if ret.Err != nil {
+					action.Err = ret.Err.Error()
+				}
+			}
+			actions = append(actions, action)
+			continue
+		}
+		if ins.Version != rt.Version {
+			continue
+		}
+
+		if !isDone(ins) && !ins.IsProcess(ins.StartTime()) {
+			action := &engine.ReconcileAction{
+				ApplicationTag: *tag,
+				Type:           engine.ReconcileRepair,
+				Reason:         fmt.Sprintf("pid %d is reused by another process", ins.proc.Pid),
+			}
+			if !opt.DryRun {
+				cli.reconcileRepair(ins, action)
+			}
+			actions = append(actions, action)
+			continue
+		}
+
+		for _, replica := range cli.replicas[name] {
+			if replica == nil || isDone(replica) || replica.IsProcess(replica.StartTime()) {
+				continue
+			}
+			action := &engine.ReconcileAction{
+				ApplicationTag: *tag,
+				Type:           engine.ReconcileRepair,
+				Reason:         fmt.Sprintf("pid %d of replica %d is reused by another process", replica.proc.Pid, replica.Index),
+			}
+			if !opt.DryRun {
+				cli.reconcileRepairReplica(replica, action)
+			}
+			actions = append(actions, action)
+		}
+	}
+
+	log.Debugf("reconcile native applications finished, %d drifts", len(actions))
+
+	return &engine.TaskResult{
+		Out: actions,
+	}
+}
+
+func isDone(ins *Instance) bool {
+	select {
+	case <-ins.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// reconcileStop stops the instance and its replicas, the runtime is cleaned
+// when the instance exits.
+func (cli *Client) reconcileStop(ctx context.Context, ins *Instance, action *engine.ReconcileAction) {
+	inss := append([]*Instance{ins}, cli.takeReplicas(ins.Name)...)
+	killed, err := stopInstances(ctx, inss)
+	if err != nil {
+		action.Err = err.Error()
+	}
+
+	reason := "stopped by reconciliation"
+	if killed {
+		reason = "killed by reconciliation"
+	}
+	cli.notifyEvent(&engine.ApplicationEvent{
+		ApplicationTag: action.ApplicationTag,
+		Type:           engine.ApplicationStopped,
+		Reason:         reason,
+	})
+}
+
+// reconcileRepair releases the bound instance whose pid is reused, and
+// starts the application again. The process of the pid is left running
+// as it's not the application.
+func (cli *Client) reconcileRepair(ins *Instance, action *engine.ReconcileAction) {
+	tag := &action.ApplicationTag
+
+	ins.Release()
+	delete(cli.appInstances, tag.Name)
+
+	cli.store.UpdateApplicationRuntime(tag.Name, func(rt *engine.ApplicationRuntime) error {
+		rt.IsStarted = false
+		rt.Pid = -1
+		rt.LastExitCode = -1
+		rt.LastExitSignal = ""
+		rt.LastExitReason = "exited with unknown status"
+		rt.LastExitTime = time.Now()
+		return nil
+	})
+	cli.notifyEvent(&engine.ApplicationEvent{
+		ApplicationTag: *tag,
+		Type:           engine.ApplicationExited,
+		ExitCode:       -1,
+		Reason:         action.Reason,
+	})
+
+	// the replicas are kept running
+	if ret := cli.startApplication(tag, false); ret.Err != nil {
+		action.Err = ret.Err.Error()
+	}
+}
+
+// reconcileRepairReplica releases the bound replica whose pid is reused,
+// and starts it again.
+func (cli *Client) reconcileRepairReplica(replica *Instance, action *engine.ReconcileAction) {
+	replica.Release()
+	cli.replicas[replica.Name][replica.Index-1] = nil
+
+	app, err := cli.store.GetApplication(&action.ApplicationTag)
+	if err == nil {
+		err = cli.startReplica(app, replica.Index)
+	}
+	if err != nil {
+		action.Err = err.Error()
+	}
+	cli.saveReplicaPids(replica.Name)
+}
@@ -0,0 +1,364 @@
+package native
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	engine "github.com/jimi36/app-engine"
+	"github.com/jimi36/app-engine/log"
+	"github.com/pkg/errors"
+)
+
+// replicaCount returns the instance count of the application.
+func replicaCount(app *engine.Application) int {
+	if app.Replicas > 0 {
+		return app.Replicas
+	}
+	return 1
+}
+
+// stopInstances stops the instances in parallel, each one may wait its grace period.
+// It returns whether any instance was killed.
+func stopInstances(ctx context.Context, inss []*Instance) (bool, error) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var firstErr error
+	killed := false
+	for _, ins := range inss {
+		wg.Add(1)
+		go func(ins *Instance) {
+			defer wg.Done()
+			k, err := ins.Stop(ctx)
+			mu.Lock()
+			defer mu.Unlock()
+			killed = killed || k
+			if err != nil && firstErr == nil {
+				firstErr = errors.Wrapf(err, "stop instance[%s] error", ins.String())
+			}
+		}(ins)
+	}
+	wg.Wait()
+	return killed, firstErr
+}
+
+// takeReplicas removes the replicas of the application, and returns the running ones.
+func (cli *Client) takeReplicas(name string) []*Instance {
+	var inss []*Instance
+	for _, ins := range cli.replicas[name] {
+		if ins != nil {
+			inss = append(inss, ins)
+		}
+	}
+	delete(cli.replicas, name)
+	return inss
+}
+
+// saveReplicaPids records the replica pids in the application runtime,
+// so the replicas are bound again by the next client.
+func (cli *Client) saveReplicaPids(name string) {
+	var pids []int
+	for _, ins := range cli.replicas[name] {
+		if ins != nil {
+			pids = append(pids, ins.Pid())
+		} else {
+			pids = append(pids, -1)
+		}
+	}
+	cli.store.UpdateApplicationRuntime(name, func(rt *engine.ApplicationRuntime) error {
+		rt.ReplicaPids = pids
+		return nil
+	})
+}
+
+// scaleReplicas starts the missing replicas of the started application and
+// stops the ones beyond its replica count. The first replica is the
+// application instance, which is not touched.
+func (cli *Client) scaleReplicas(ctx context.Context, app *engine.Application) error {
+	count := replicaCount(app) - 1
+
+	replicas := cli.replicas[app.Name]
+	if len(replicas) > count {
+		var inss []*Instance
+		for _, ins := range replicas[count:] {
+			if ins != nil {
+				inss = append(inss, ins)
+			}
+		}
+		if _, err := stopInstances(ctx, inss); err != nil {
+			log.Warnf("scale native application[%s] error: %s", app.Tag(), err.Error())
+		}
+		replicas = replicas[:count]
+	}
+	for len(replicas) < count {
+		replicas = append(replicas, nil)
+	}
+	if count > 0 {
+		cli.replicas[app.Name] = replicas
+	} else {
+		delete(cli.replicas, app.Name)
+	}
+
+	var firstErr error
+	for i, ins := range replicas {
+		if ins != nil {
+			continue
+		}
+		if err := cli.startReplica(app, i+1); err != nil {
+			log.Warnf("start native application[%s] replica %d error: %s", app.Tag(), i+1, err.Error())
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	cli.saveReplicaPids(app.Name)
+
+	return firstErr
+}
+
+func (cli *Client) startReplica(app *engine.Application, index int) error {
+	ins, err := CreateInstance(app.Name, app.Version, cli.basePath, cli.cgroupParent)
+	if err != nil {
+		return err
+	}
+	ins.Index = index
+
+	if err := ins.Start(app); err != nil {
+		ins.Stop(context.Background())
+		return err
+	}
+
+	cli.replicas[app.Name][index-1] = ins
+	cli.monitorReplica(ins)
+
+	return nil
+}
+
+// bindReplicas binds the replicas left running by the previous client.
+func (cli *Client) bindReplicas(app *engine.Application, pids []int) {
+	replicas := make([]*Instance, len(pids))
+	for i, pid := range pids {
+		if pid <= 0 {
+			continue
+		}
+		ins, err := CreateInstance(app.Name, app.Version, cli.basePath, cli.cgroupParent)
+		if err != nil {
+			continue
+		}
+		ins.Index = i + 1
+		ins.ApplySpec(app)
+		if err := ins.Bind(pid); err != nil {
+			log.Debugf("bind native application[%s] replica %d error: %s", app.Tag(), i+1, err.Error())
+			ins.Release()
+			continue
+		}
+		replicas[i] = ins
+		cli.monitorReplica(ins)
+	}
+	cli.replicas[app.Name] = replicas
+}
+
+func (cli *Client) monitorReplica(ins *Instance) {
+	go func() {
+		unhealthy := ins.Unhealthy()
+		for {
+			select {
+			case <-cli.ctx.Done():
+				return
+			case <-unhealthy:
+				unhealthy = nil
+				if _, err := cli.postTaskEvent(context.Background(), ins, cli.stopUnhealthyInstance, false); err != nil {
+					log.Warnf("notify native application[%s] replica %d unhealthy error: %s", ins.String(), ins.Index, err.Error())
+				}
+			case <-ins.Done():
+				if cli.ctx.Err() != nil || ins.Released() {
+					// client is closed or the instance is replaced
+					return
+				}
+				if _, err := cli.postTaskEvent(context.Background(), ins, cli.replicaExited, false); err != nil {
+					log.Warnf("notify native application[%s] replica %d error: %s", ins.String(), ins.Index, err.Error())
+				}
+				return
+			}
+		}
+	}()
+}
+
+// replicaExited restarts the exited replica according to the restart policy
+// of the application, the exit of the replica isn't an application event.
+func (cli *Client) replicaExited(ev *engine.TaskEvent) *engine.TaskResult {
+	ins, ok := ev.In.(*Instance)
+	if !ok {
+		log.Fatalf("native application replica exited error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	log.Debugf("native application[%s] replica %d exited: %s", ins.String(), ins.Index, ins.ExitReason())
+
+	// the replica is stopped or scaled down
+	replicas := cli.replicas[ins.Name]
+	if ins.Index > len(replicas) || replicas[ins.Index-1] != ins {
+		return &engine.TaskResult{}
+	}
+	replicas[ins.Index-1] = nil
+	cli.saveReplicaPids(ins.Name)
+
+	cli.store.UpdateApplicationRuntime(ins.Name, func(rt *engine.ApplicationRuntime) error {
+		rt.OomKills += ins.OomKills()
+		return nil
+	})
+
+	leader, found := cli.appInstances[ins.Name]
+	if !found || leader.Version != ins.Version {
+		return &engine.TaskResult{}
+	}
+	rt, _ := cli.store.GetApplicationRuntime(ins.Name)
+	if rt == nil || !rt.ToStart || rt.Version != ins.Version {
+		return &engine.TaskResult{}
+	}
+
+	tag := &engine.ApplicationTag{Name: ins.Name, Version: ins.Version}
+	app, err := cli.store.GetApplication(tag)
+	if err != nil || app.NativeSpec == nil {
+		return &engine.TaskResult{}
+	}
+
+	// unknown exit code is treated as failure
+	policy := app.NativeSpec.Restart
+	if !needRestart(policy, ins.ExitCode() != 0 || ins.LivenessFailed()) {
+		return &engine.TaskResult{}
+	}
+	if policy.MaxRetries > 0 && rt.RestartCount >= policy.MaxRetries {
+		log.Warnf("restart native application[%s] replica %d error: exceed max retries %d", tag.Tag(), ins.Index, policy.MaxRetries)
+		return &engine.TaskResult{}
+	}
+
+	backoff := restartBackoff(policy, rt.RestartCount)
+	cli.store.UpdateApplicationRuntime(tag.Name, func(runtime *engine.ApplicationRuntime) error {
+		runtime.RestartCount++
+		return nil
+	})
+
+	log.Debugf("restart native application[%s] replica %d in %s", tag.Tag(), ins.Index, backoff.String())
+
+	restart := &replicaRestart{
+		tag:   *tag,
+		index: ins.Index,
+	}
+	time.AfterFunc(backoff, func() {
+		if cli.ctx.Err() != nil {
+			return
+		}
+		if _, err := cli.postTaskEvent(cli.ctx, restart, cli.restartReplica, false); err != nil {
+			log.Warnf("restart native application[%s] replica %d error: %s", tag.Tag(), restart.index, err.Error())
+		}
+	})
+
+	return &engine.TaskResult{}
+}
+
+type replicaRestart struct {
+	tag   engine.ApplicationTag
+	index int
+}
+
+func (cli *Client) restartReplica(ev *engine.TaskEvent) *engine.TaskResult {
+	restart, ok := ev.In.(*replicaRestart)
+	if !ok {
+		log.Fatalf("restart native application replica error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	tag := &restart.tag
+
+	log.Debugf("restart native application[%s] replica %d......", tag.Tag(), restart.index)
+
+	// the application may be stopped, upgraded or scaled during the backoff
+	leader, found := cli.appInstances[tag.Name]
+	replicas := cli.replicas[tag.Name]
+	if !found || leader.Version != tag.Version || restart.index > len(replicas) || replicas[restart.index-1] != nil {
+		log.Debugf("restart native application[%s] replica %d canceled", tag.Tag(), restart.index)
+		return &engine.TaskResult{
+			Err: errors.New("restart canceled"),
+		}
+	}
+	if rt, _ := cli.store.GetApplicationRuntime(tag.Name); rt == nil || !rt.ToStart || rt.Version != tag.Version {
+		log.Debugf("restart native application[%s] replica %d canceled", tag.Tag(), restart.index)
+		return &engine.TaskResult{
+			Err: errors.New("restart canceled"),
+		}
+	}
+
+	app, err := cli.store.GetApplication(tag)
+	if err != nil {
+		log.Warnf("restart native application[%s] replica %d error: %s", tag.Tag(), restart.index, err.Error())
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
+
+	if err := cli.startReplica(app, restart.index); err != nil {
+		log.Warnf("restart native application[%s] replica %d error: %s", tag.Tag(), restart.index, err.Error())
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
+	cli.saveReplicaPids(tag.Name)
+
+	log.Debugf("restart native application[%s] replica %d finished", tag.Tag(), restart.index)
+
+	return &engine.TaskResult{}
+}
+
+func (cli *Client) ScaleApplication(ev *engine.TaskEvent) *engine.TaskResult {
+	req, ok := ev.In.(*engine.ScaleRequest)
+	if !ok {
+		log.Fatalf("scale native application error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	tag := req.Tag
+
+	log.Debugf("scale native application[%s] to %d......", tag.Tag(), req.Replicas)
+
+	app, err := cli.store.GetApplication(tag)
+	if err != nil {
+		log.Warnf("scale native application[%s] error: %s", tag.Tag(), err.Error())
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
+
+	if err := cli.store.UpdateApplication(tag, func(app *engine.Application) {
+		app.Replicas = req.Replicas
+	}); err != nil {
+		log.Warnf("scale native application[%s] error: %s", tag.Tag(), err.Error())
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
+	app.Replicas = req.Replicas
+
+	// the application which is not running yet is scaled when its instance is run
+	ins, found := cli.appInstances[tag.Name]
+	rt, _ := cli.store.GetApplicationRuntime(tag.Name)
+	if found && ins.Version == tag.Version && rt != nil && rt.IsStarted {
+		if err := cli.scaleReplicas(ev.Context(), app); err != nil {
+			log.Warnf("scale native application[%s] error: %s", tag.Tag(), err.Error())
+			return &engine.TaskResult{
+				Err: err,
+			}
+		}
+	}
+
+	log.Debugf("scale native application[%s] to %d finished", tag.Tag(), req.Replicas)
+
+	return &engine.TaskResult{}
+}
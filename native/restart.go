@@ -0,0 +1,150 @@
+package native
+
+import (
+	"time"
+
+	engine "github.com/jimi36/app-engine"
+	"github.com/jimi36/app-engine/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultRestartBackoff    = time.Second
+	defaultRestartMaxBackoff = time.Minute * 5
+)
+
+func needRestart(policy *engine.RestartPolicy, failed bool) bool {
+	if policy == nil {
+		return false
+	}
+	switch policy.Type {
+	case engine.RestartAlways:
+		return true
+	case engine.RestartOnFailure:
+		return failed
+	}
+	return false
+}
+
+func restartBackoff(policy *engine.RestartPolicy, restartCount int) time.Duration {
+	backoff := defaultRestartBackoff
+	if policy.BackoffSeconds > 0 {
+		backoff = time.Duration(policy.BackoffSeconds) * time.Second
+	}
+	maxBackoff := defaultRestartMaxBackoff
+	if policy.MaxBackoffSeconds > 0 {
+		maxBackoff = time.Duration(policy.MaxBackoffSeconds) * time.Second
+	}
+
+	for i := 0; i < restartCount && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+
+	return backoff
+}
+
+// scheduleRestart restarts the exited application later according to its restart policy,
+// it returns whether the restart is scheduled.
+func (cli *Client) scheduleRestart(rt *engine.ApplicationRuntime, failed bool) bool {
+	tag := &engine.ApplicationTag{Name: rt.Name, Version: rt.Version}
+
+	app, err := cli.store.GetApplication(tag)
+	if err != nil || app.NativeSpec == nil {
+		return false
+	}
+
+	policy := app.NativeSpec.Restart
+	if !needRestart(policy, failed) {
+		return false
+	}
+
+	if policy.MaxRetries > 0 && rt.RestartCount >= policy.MaxRetries {
+		log.Warnf("restart native application[%s] error: exceed max retries %d", tag.Tag(), policy.MaxRetries)
+		cli.store.UpdateApplicationRuntime(tag.Name, func(runtime *engine.ApplicationRuntime) error {
+			runtime.ToStart = false
+			runtime.Err = "exceed max restart retries"
+			return nil
+		})
+		cli.notifyEvent(&engine.ApplicationEvent{
+			ApplicationTag: *tag,
+			Type:           engine.ApplicationFailed,
+			Reason:         "exceed max restart retries",
+		})
+		return false
+	}
+
+	backoff := restartBackoff(policy, rt.RestartCount)
+	cli.store.UpdateApplicationRuntime(tag.Name, func(runtime *engine.ApplicationRuntime) error {
+		runtime.RestartCount++
+		return nil
+	})
+
+	log.Debugf("restart native application[%s] in %s", tag.Tag(), backoff.String())
+
+	cli.pendingRestarts[tag.Name] = time.AfterFunc(backoff, func() {
+		if cli.ctx.Err() != nil {
+			return
+		}
+		if _, err := cli.postTaskEvent(cli.ctx, tag, cli.restartExitedApplication, false); err != nil {
+			log.Warnf("restart native application[%s] error: %s", tag.Tag(), err.Error())
+		}
+	})
+
+	return true
+}
+
+// restartPending reports whether the exited application of the version waits
+// for the restart, its replicas are kept running during the backoff.
+func (cli *Client) restartPending(tag *engine.ApplicationTag) bool {
+	if cli.pendingRestarts[tag.Name] == nil {
+		return false
+	}
+	rt, err := cli.store.GetApplicationRuntime(tag.Name)
+	return err == nil && rt.Version == tag.Version
+}
+
+// cancelRestart cancels the pending restart of the application.
+func (cli *Client) cancelRestart(name string) {
+	if timer, found := cli.pendingRestarts[name]; found {
+		timer.Stop()
+		delete(cli.pendingRestarts, name)
+	}
+}
+
+func (cli *Client) restartExitedApplication(ev *engine.TaskEvent) *engine.TaskResult {
+	tag, ok := ev.In.(*engine.ApplicationTag)
+	if !ok {
+		log.Fatalf("restart exited native application error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	log.Debugf("restart exited native application[%s]......", tag.Tag())
+
+	delete(cli.pendingRestarts, tag.Name)
+
+	// the application may be stopped or started again during the backoff
+	rt, _ := cli.store.GetApplicationRuntime(tag.Name)
+	if rt == nil || !rt.ToStart || rt.IsStarted || rt.Version != tag.Version {
+		log.Debugf("restart exited native application[%s] canceled", tag.Tag())
+		return &engine.TaskResult{
+			Err: errors.New("restart canceled"),
+		}
+	}
+	if _, found := cli.appInstances[tag.Name]; found {
+		log.Debugf("restart exited native application[%s] canceled", tag.Tag())
+		return &engine.TaskResult{
+			Err: engine.ErrApplicationStarted,
+		}
+	}
+
+	ret := cli.startApplication(tag, false)
+
+	log.Debugf("restart exited native application[%s] finished", tag.Tag())
+
+	return ret
+}
@@ -0,0 +1,195 @@
+package native
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	engine "github.com/jimi36/app-engine"
+)
+
+const (
+	signatureEd25519 = "ed25519"
+	signatureX509    = "x509"
+)
+
+// TrustStore holds the ed25519 public keys and the X.509 root certificates
+// which the resource signatures are verified against.
+type TrustStore struct {
+	keys  []ed25519.PublicKey
+	roots *x509.CertPool
+}
+
+func NewTrustStore() *TrustStore {
+	return &TrustStore{
+		roots: x509.NewCertPool(),
+	}
+}
+
+// LoadTrustStore loads the PEM files, a folder is loaded with all files in it.
+func LoadTrustStore(paths ...string) (*TrustStore, error) {
+	ts := NewTrustStore()
+	for _, path := range paths {
+		files := []string{path}
+		if infos, err := ioutil.ReadDir(path); err == nil {
+			files = files[:0]
+			for _, info := range infos {
+				if !info.IsDir() {
+					files = append(files, filepath.Join(path, info.Name()))
+				}
+			}
+		}
+		for _, file := range files {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			if err := ts.AddPEM(data); err != nil {
+				return nil, errors.Wrapf(err, "load %s", file)
+			}
+		}
+	}
+	return ts, nil
+}
+
+// AddPEM adds the PUBLIC KEY blocks of ed25519 keys and the CERTIFICATE blocks.
+func (ts *TrustStore) AddPEM(data []byte) error {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil
+		}
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return err
+			}
+			edKey, ok := key.(ed25519.PublicKey)
+			if !ok {
+				return errors.New("public key is not ed25519")
+			}
+			ts.AddKey(edKey)
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return err
+			}
+			ts.roots.AddCert(cert)
+		}
+	}
+}
+
+func (ts *TrustStore) AddKey(key ed25519.PublicKey) {
+	ts.keys = append(ts.keys, key)
+}
+
+// verifyResource verifies the detached signature of the resource file, which
+// signs the sha256 digest of the file. An unsigned resource is refused if the
+// signature is required.
+func (cli *Client) verifyResource(rc *engine.NativeResource, filePath string) error {
+	if len(rc.Signature) == 0 {
+		if cli.requireSignature {
+			return errors.New("resource is not signed")
+		}
+		return nil
+	}
+	if cli.trustStore == nil {
+		return errors.New("trust store is not configured")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(rc.Signature)
+	if err != nil {
+		return errors.Wrap(err, "decode signature")
+	}
+
+	h := sha256.New()
+	if err := hashFile(filePath, h); err != nil {
+		return err
+	}
+	digest := h.Sum(nil)
+
+	switch strings.ToLower(rc.SignatureType) {
+	case signatureEd25519, "":
+		for _, key := range cli.trustStore.keys {
+			if ed25519.Verify(key, digest, sig) {
+				return nil
+			}
+		}
+		return errors.New("signature is not verified by trusted keys")
+
+	case signatureX509:
+		return verifyX509Signature(cli.trustStore.roots, rc.Certificate, digest, sig)
+	}
+
+	return errors.Errorf("signature type %s not supported", rc.SignatureType)
+}
+
+// verifyX509Signature verifies the certificate chains to the roots and
+// the signature is signed by its key.
+func verifyX509Signature(roots *x509.CertPool, certPEM string, digest, sig []byte) error {
+	var leaf *x509.Certificate
+	intermediates := x509.NewCertPool()
+	data := []byte(certPEM)
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return err
+		}
+		if leaf == nil {
+			leaf = cert
+		} else {
+			intermediates.AddCert(cert)
+		}
+	}
+	if leaf == nil {
+		return errors.New("signing certificate not found")
+	}
+
+	_, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning, x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return errors.Wrap(err, "verify signing certificate")
+	}
+
+	switch key := leaf.PublicKey.(type) {
+	case ed25519.PublicKey:
+		if ed25519.Verify(key, digest, sig) {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if ecdsa.VerifyASN1(key, digest, sig) {
+			return nil
+		}
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, sig) == nil {
+			return nil
+		}
+	default:
+		return errors.New("signing key type not supported")
+	}
+
+	return errors.New("signature is not verified by the signing certificate")
+}
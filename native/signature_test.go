@@ -0,0 +1,175 @@
+package native
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	engine "github.com/jimi36/app-engine"
+)
+
+func writeTestResource(t *testing.T, data string) (string, []byte) {
+	dir, err := ioutil.TempDir("", "signature-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filePath := filepath.Join(dir, "app.bin")
+	if err := ioutil.WriteFile(filePath, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte(data))
+	return filePath, digest[:]
+}
+
+func TestVerifyEd25519Signature(t *testing.T) {
+	filePath, digest := writeTestResource(t, "application")
+	defer os.RemoveAll(filepath.Dir(filePath))
+
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	_, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := NewTrustStore()
+	if err := ts.AddPEM(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})); err != nil {
+		t.Fatal(err)
+	}
+
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, digest))
+	cases := []struct {
+		name    string
+		cli     *Client
+		rc      *engine.NativeResource
+		trusted bool
+	}{
+		{"signed", &Client{trustStore: ts}, &engine.NativeResource{Signature: signature}, true},
+		{"signed required", &Client{trustStore: ts, requireSignature: true}, &engine.NativeResource{Signature: signature, SignatureType: "ED25519"}, true},
+		{"unsigned", &Client{trustStore: ts}, &engine.NativeResource{}, true},
+		{"unsigned required", &Client{trustStore: ts, requireSignature: true}, &engine.NativeResource{}, false},
+		{"untrusted key", &Client{trustStore: ts}, &engine.NativeResource{
+			Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(otherPriv, digest)),
+		}, false},
+		{"other digest", &Client{trustStore: ts}, &engine.NativeResource{
+			Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte("other"))),
+		}, false},
+		{"no trust store", &Client{}, &engine.NativeResource{Signature: signature}, false},
+		{"unknown type", &Client{trustStore: ts}, &engine.NativeResource{Signature: signature, SignatureType: "pgp"}, false},
+		{"invalid base64", &Client{trustStore: ts}, &engine.NativeResource{Signature: "!"}, false},
+	}
+
+	for _, c := range cases {
+		err := c.cli.verifyResource(c.rc, filePath)
+		if c.trusted && err != nil {
+			t.Errorf("%s: verify error: %v", c.name, err)
+		} else if !c.trusted && err == nil {
+			t.Errorf("%s: verify should fail", c.name)
+		}
+	}
+
+	// the tampered file is refused
+	if err := ioutil.WriteFile(filePath, []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&Client{trustStore: ts}).verifyResource(&engine.NativeResource{Signature: signature}, filePath); err == nil {
+		t.Errorf("tampered: verify should fail")
+	}
+}
+
+func newTestCert(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = tmpl, key
+	} else {
+		tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestVerifyX509Signature(t *testing.T) {
+	filePath, digest := writeTestResource(t, "application")
+	defer os.RemoveAll(filepath.Dir(filePath))
+
+	root, rootKey, rootPEM := newTestCert(t, "root", nil, nil)
+	_, leafKey, leafPEM := newTestCert(t, "signer", root, rootKey)
+	otherRoot, otherRootKey, _ := newTestCert(t, "other root", nil, nil)
+	_, otherLeafKey, otherLeafPEM := newTestCert(t, "other signer", otherRoot, otherRootKey)
+
+	ts := NewTrustStore()
+	if err := ts.AddPEM([]byte(rootPEM)); err != nil {
+		t.Fatal(err)
+	}
+	cli := &Client{trustStore: ts, requireSignature: true}
+
+	sign := func(key *ecdsa.PrivateKey, digest []byte) string {
+		sig, err := ecdsa.SignASN1(rand.Reader, key, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.StdEncoding.EncodeToString(sig)
+	}
+
+	cases := []struct {
+		name    string
+		rc      *engine.NativeResource
+		trusted bool
+	}{
+		{"signed", &engine.NativeResource{
+			SignatureType: signatureX509, Certificate: leafPEM, Signature: sign(leafKey, digest),
+		}, true},
+		{"untrusted chain", &engine.NativeResource{
+			SignatureType: signatureX509, Certificate: otherLeafPEM, Signature: sign(otherLeafKey, digest),
+		}, false},
+		{"other signer", &engine.NativeResource{
+			SignatureType: signatureX509, Certificate: leafPEM, Signature: sign(otherLeafKey, digest),
+		}, false},
+		{"other digest", &engine.NativeResource{
+			SignatureType: signatureX509, Certificate: leafPEM, Signature: sign(leafKey, make([]byte, sha256.Size)),
+		}, false},
+		{"no certificate", &engine.NativeResource{
+			SignatureType: signatureX509, Signature: sign(leafKey, digest),
+		}, false},
+	}
+
+	for _, c := range cases {
+		err := cli.verifyResource(c.rc, filePath)
+		if c.trusted && err != nil {
+			t.Errorf("%s: verify error: %v", c.name, err)
+		} else if !c.trusted && err == nil {
+			t.Errorf("%s: verify should fail", c.name)
+		}
+	}
+}
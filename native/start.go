@@ -2,11 +2,6 @@ package native
 
 import (
 	"context"
-	"crypto/md5"
-	"encoding/hex"
-	"io"
-	"io/ioutil"
-	"net/http"
 	"os"
 	"path/filepath"
 
@@ -14,7 +9,6 @@ import (
 
 	engine "github.com/jimi36/app-engine"
 	"github.com/jimi36/app-engine/log"
-	"github.com/jimi36/app-engine/utils"
 )
 
 func (cli *Client) RestartApplication(ev *engine.TaskEvent) *engine.TaskResult {
@@ -38,21 +32,39 @@ func (cli *Client) RestartApplication(ev *engine.TaskEvent) *engine.TaskResult {
 
 	ret := &engine.TaskResult{}
 	if rt, _ := cli.store.GetApplicationRuntime(tag.Name); rt != nil {
-		ins, _ := CreateInstance(tag.Name, tag.Version, cli.basePath)
-		if err := ins.Bind(rt.Pid); err == nil {
+		ins, _ := CreateInstance(tag.Name, tag.Version, cli.basePath, cli.cgroupParent)
+		app, err := cli.store.GetApplication(tag)
+		if err == nil {
+			ins.ApplySpec(app)
+			// the missing replicas are started when the instance is run
+			cli.bindReplicas(app, rt.ReplicaPids)
+		}
+		err = ins.Bind(rt.Pid)
+		if err == nil && !ins.IsProcess(rt.StartTime) {
+			// the process exited and its pid is reused
+			ins.Release()
+			err = errors.Errorf("pid %d is reused", rt.Pid)
+		}
+		if err == nil {
 			cli.store.UpdateApplicationRuntime(tag.Name, func(runtime *engine.ApplicationRuntime) error {
 				runtime.ToStart = true
 				runtime.IsStarted = true
+				runtime.StartTime = ins.StartTime()
 				runtime.Err = ""
 				return nil
 			})
 			cli.appInstances[rt.Name] = ins
 			cli.monitorInstance(ins)
+			if app != nil {
+				if err := cli.scaleReplicas(context.Background(), app); err != nil {
+					log.Warnf("restart native application[%s] error: %s", tag.Tag(), err.Error())
+				}
+			}
 		} else {
-			ret = cli.StartApplication(ev)
+			ret = cli.startApplication(tag, false)
 		}
 	} else {
-		ret = cli.StartApplication(ev)
+		ret = cli.startApplication(tag, false)
 	}
 
 	log.Debugf("restart native application[%s] finished", tag.Tag())
@@ -69,6 +81,12 @@ func (cli *Client) StartApplication(ev *engine.TaskEvent) *engine.TaskResult {
 		}
 	}
 
+	return cli.startApplication(tag, true)
+}
+
+// startApplication starts the application instance, the restart count of
+// the application runtime is kept unless resetRestarts is set.
+func (cli *Client) startApplication(tag *engine.ApplicationTag, resetRestarts bool) *engine.TaskResult {
 	log.Debugf("start native application[%s]......", tag.Tag())
 
 	// check and get application
@@ -100,10 +118,16 @@ func (cli *Client) StartApplication(ev *engine.TaskEvent) *engine.TaskResult {
 	if rt != nil {
 		// if existed, update application runtime
 		cli.store.UpdateApplicationRuntime(tag.Name, func(runtime *engine.ApplicationRuntime) error {
+			if resetRestarts || runtime.Version != tag.Version {
+				runtime.RestartCount = 0
+				runtime.OomKills = 0
+			}
 			runtime.Version = tag.Version
 			runtime.ToStart = true
 			runtime.IsStarted = false
 			runtime.Pid = -1
+			runtime.DownloadedBytes = 0
+			runtime.TotalBytes = 0
 			runtime.Err = ""
 			return nil
 		})
@@ -117,8 +141,13 @@ func (cli *Client) StartApplication(ev *engine.TaskEvent) *engine.TaskResult {
 		})
 	}
 
+	cli.notifyEvent(&engine.ApplicationEvent{
+		ApplicationTag: *tag,
+		Type:           engine.ApplicationStarting,
+	})
+
 	// create application instance
-	ins, err := CreateInstance(app.Name, app.Version, cli.basePath)
+	ins, err := CreateInstance(app.Name, app.Version, cli.basePath, cli.cgroupParent)
 	if err != nil {
 		log.Warnf("start native application[%s] error: %s", tag.Tag(), err.Error())
 		// update application runtime with error
@@ -127,14 +156,21 @@ func (cli *Client) StartApplication(ev *engine.TaskEvent) *engine.TaskResult {
 			rt.Err = "create instance error"
 			return nil
 		})
+		cli.notifyEvent(&engine.ApplicationEvent{
+			ApplicationTag: *tag,
+			Type:           engine.ApplicationFailed,
+			Reason:         "create instance error",
+		})
 		return &engine.TaskResult{
 			Err: err,
 		}
 	}
 	cli.appInstances[app.Name] = ins
 	cli.monitorInstance(ins)
+	delete(cli.exited, app.Name)
 
-	// download application
+	// download application, which outlives the start call and is aborted
+	// when the instance is stopped
 	go cli.downloadApplication(ins.Context(), app)
 
 	log.Debugf("start native application[%s] finished", tag.Tag())
@@ -148,28 +184,70 @@ func (cli *Client) downloadApplication(ctx context.Context, app *engine.Applicat
 	// download application resource
 	rc := app.NativeSpec.Rc
 	if rc != nil {
-		fileUrl := app.NativeSpec.Rc.Url
-		fileMd5 := app.NativeSpec.Rc.Md5
-		filePath := filepath.Join(cli.basePath, app.Name, app.Version, app.NativeSpec.Rc.FileName)
-		if err := httpDownloadFile(ctx, fileUrl, filePath, fileMd5); err != nil {
+		filePath := filepath.Join(cli.basePath, app.Name, app.Version, rc.FileName)
+		if err := cli.prepareResource(ctx, &app.ApplicationTag, rc, filePath); err != nil {
 			log.Warnf("download native application[%s] error: %s", app.Tag(), err.Error())
-			if _, err := cli.postTaskEvent(app, cli.downloadApplicationFailed, false); err != nil {
-				log.Fatalf("download native application[%s] error: %s", app.Tag(), err.Error())
+			if ctx.Err() != nil {
+				// instance is stopped, nothing to clean
+				return
+			}
+			failure := &downloadFailure{
+				app:    app,
+				reason: err.Error(),
+			}
+			if _, err := cli.postTaskEvent(ctx, failure, cli.downloadApplicationFailed, false); err != nil {
+				log.Warnf("download native application[%s] error: %s", app.Tag(), err.Error())
 			}
 			return
 		}
+
+		cli.notifyEvent(&engine.ApplicationEvent{
+			ApplicationTag: app.ApplicationTag,
+			Type:           engine.ApplicationDownloaded,
+		})
 	}
 
-	if _, err := cli.postTaskEvent(app, cli.runApplication, false); err != nil {
-		log.Fatalf("download native application[%s] error: %s", app.Tag(), err.Error())
+	// the instance context is canceled when the instance is stopped,
+	// so a stopped instance will never be run
+	if _, err := cli.postTaskEvent(ctx, app, cli.runApplication, false); err != nil {
+		log.Warnf("download native application[%s] error: %s", app.Tag(), err.Error())
 		return
 	}
 
 	log.Debugf("download native application[%s] finished", app.Tag())
 }
 
+// prepareResource fetches the resource, verifies its signature and extracts it.
+// It is serialized with the prefetch and the removal of the version folder.
+func (cli *Client) prepareResource(ctx context.Context, tag *engine.ApplicationTag, rc *engine.NativeResource, filePath string) error {
+	cli.versionLocks.lock(tag.Tag())
+	defer cli.versionLocks.unlock(tag.Tag())
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	if err := cli.fetchArtifact(ctx, tag, rc, filePath); err != nil {
+		return errors.Wrap(err, "download application failed")
+	}
+	if err := cli.verifyResource(rc, filePath); err != nil {
+		return errors.Wrap(err, "verify application signature failed")
+	}
+	if err := extractResource(ctx, rc, filePath); err != nil {
+		return errors.Wrap(err, "extract application failed")
+	}
+	return nil
+}
+
+type downloadFailure struct {
+	app    *engine.Application
+	reason string
+}
+
 func (cli *Client) downloadApplicationFailed(ev *engine.TaskEvent) *engine.TaskResult {
-	app, ok := ev.In.(*engine.Application)
+	failure, ok := ev.In.(*downloadFailure)
 	if !ok {
 		log.Fatalf("download native application failed error: %s", engine.ErrTaskEventInvalid.Error())
 		return &engine.TaskResult{
@@ -177,11 +255,13 @@ func (cli *Client) downloadApplicationFailed(ev *engine.TaskEvent) *engine.TaskR
 		}
 	}
 
+	app := failure.app
+
 	log.Debugf("download native application[%s] failed......", app.Tag())
 
 	// check and get application instance
 	ins, found := cli.appInstances[app.Name]
-	if found {
+	if !found || ins.Version != app.Version {
 		log.Warnf("download native application[%s] failed error: %s", app.Tag(), engine.ErrApplicationNotStarted.Error())
 		return &engine.TaskResult{
 			Err: engine.ErrApplicationNotStarted,
@@ -191,14 +271,20 @@ func (cli *Client) downloadApplicationFailed(ev *engine.TaskEvent) *engine.TaskR
 	// update application runtime with error
 	cli.store.UpdateApplicationRuntime(app.Name, func(rt *engine.ApplicationRuntime) error {
 		rt.ToStart = false
-		rt.Err = "download application failed"
+		rt.Err = failure.reason
 		return nil
 	})
 
-	if err := ins.Stop(); err != nil {
+	if _, err := ins.Stop(context.Background()); err != nil {
 		log.Warnf("download native application[%s] failed error: %s", app.Tag(), err.Error())
 	}
 
+	cli.notifyEvent(&engine.ApplicationEvent{
+		ApplicationTag: app.ApplicationTag,
+		Type:           engine.ApplicationFailed,
+		Reason:         failure.reason,
+	})
+
 	log.Debugf("download native application[%s] failed finished", app.Tag())
 
 	return &engine.TaskResult{}
@@ -233,9 +319,14 @@ func (cli *Client) runApplication(ev *engine.TaskEvent) *engine.TaskResult {
 			rt.Err = "start instance err: " + err.Error()
 			return nil
 		})
-		if err1 := ins.Stop(); err1 != nil {
+		if _, err1 := ins.Stop(context.Background()); err1 != nil {
 			log.Warnf("run native application[%s] error: %s", app.Tag(), err1.Error())
 		}
+		cli.notifyEvent(&engine.ApplicationEvent{
+			ApplicationTag: app.ApplicationTag,
+			Type:           engine.ApplicationFailed,
+			Reason:         "start instance err: " + err.Error(),
+		})
 		return &engine.TaskResult{
 			Err: err,
 		}
@@ -245,60 +336,24 @@ func (cli *Client) runApplication(ev *engine.TaskEvent) *engine.TaskResult {
 	cli.store.UpdateApplicationRuntime(app.Name, func(rt *engine.ApplicationRuntime) error {
 		rt.IsStarted = true
 		rt.Pid = ins.Pid()
+		rt.StartTime = ins.StartTime()
 		return nil
 	})
 
-	log.Debugf("run native application[%s] finished", app.Tag())
-
-	return &engine.TaskResult{}
-}
-
-func fileMD5(filePath string) (string, error) {
-	data, err := ioutil.ReadFile(filePath)
-	if err != nil {
-		return "", err
-	}
-
-	sum := md5.Sum(data)
-
-	return hex.EncodeToString(sum[:]), nil
-}
-
-func httpDownloadFile(ctx context.Context, url, filePath, md5 string) error {
-	if utils.IsExistedPath(filePath) {
-		if fileMd5, err := fileMD5(filePath); err == nil && fileMd5 == md5 {
-			return nil
-		}
-	}
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return err
-	}
-
-	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return errors.New(resp.Status)
-	}
+	cli.notifyEvent(&engine.ApplicationEvent{
+		ApplicationTag: app.ApplicationTag,
+		Type:           engine.ApplicationStarted,
+	})
 
-	file, err := os.Create(filePath)
-	if err != nil {
-		return err
+	// the application may be scaled while it is downloaded
+	if cur, err := cli.store.GetApplication(&app.ApplicationTag); err == nil {
+		app.Replicas = cur.Replicas
 	}
-	defer file.Close()
-
-	if _, err := io.Copy(file, resp.Body); err != nil {
-		return err
+	if err := cli.scaleReplicas(context.Background(), app); err != nil {
+		log.Warnf("run native application[%s] error: %s", app.Tag(), err.Error())
 	}
 
-	if fileMd5, _ := fileMD5(filePath); fileMd5 != md5 {
-		return errors.New("file md5 not match")
-	}
+	log.Debugf("run native application[%s] finished", app.Tag())
 
-	return nil
+	return &engine.TaskResult{}
 }
@@ -0,0 +1,135 @@
+package native
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	engine "github.com/jimi36/app-engine"
+)
+
+// newTestEngine returns the started engine client of the native client.
+func newTestEngine(t *testing.T) (*engine.Client, func()) {
+	dir, err := ioutil.TempDir("", "native-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	impl, err := NewClient(BasePath(dir), GCInterval(0))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	cli := engine.NewClient(impl)
+	if err := cli.Start(); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return cli, func() {
+		cli.Stop(&engine.StopOption{})
+		os.RemoveAll(dir)
+	}
+}
+
+func waitEvent(t *testing.T, w *engine.Watcher, typ engine.ApplicationEventType) {
+	timer := time.NewTimer(time.Second * 10)
+	defer timer.Stop()
+	for {
+		select {
+		case ev := <-w.Events():
+			if ev.Type == typ {
+				return
+			}
+			if ev.Type == engine.ApplicationFailed {
+				t.Fatalf("application failed: %s", ev.Reason)
+			}
+		case <-timer.C:
+			t.Fatalf("wait application event %s timeout", typ)
+		}
+	}
+}
+
+// TestStartDownloadDecoupled checks the download outlives the start call and
+// is aborted by the stop.
+func TestStartDownloadDecoupled(t *testing.T) {
+	release := make(chan struct{})
+	aborted := make(chan struct{}, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the resource of the version 2.0 is never served
+		if r.URL.Path == "/1.0/app.sh" {
+			select {
+			case <-release:
+				w.Write([]byte("#!/bin/sh\nsleep 10\n"))
+				return
+			case <-r.Context().Done():
+			}
+		} else {
+			<-r.Context().Done()
+		}
+		select {
+		case aborted <- struct{}{}:
+		default:
+		}
+	}))
+	defer ts.Close()
+
+	cli, cleanup := newTestEngine(t)
+	defer cleanup()
+
+	for _, version := range []string{"1.0", "2.0"} {
+		tag := &engine.ApplicationTag{Name: "app", Version: version}
+		app := &engine.Application{
+			ApplicationTag: *tag,
+			Type:           engine.Native,
+			NativeSpec: &engine.NativeAppSpec{
+				Command: []string{"/bin/sh", "sh", "-c", "sleep 10"},
+				Rc: &engine.NativeResource{
+					FileName: "app.sh",
+					Url:      ts.URL + "/" + version + "/app.sh",
+				},
+			},
+		}
+		if err := cli.CreateApplication(app); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := cli.Watch(&engine.WatchOption{Names: []string{"app"}})
+	defer w.Stop()
+
+	// the download is not canceled with the start call
+	tag := &engine.ApplicationTag{Name: "app", Version: "1.0"}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := cli.StartApplicationWithContext(ctx, tag); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	select {
+	case <-aborted:
+		t.Fatal("download is aborted with the start call")
+	case <-time.After(time.Millisecond * 200):
+	}
+	close(release)
+	waitEvent(t, w, engine.ApplicationStarted)
+	if err := cli.StopApplication(tag); err != nil {
+		t.Fatal(err)
+	}
+
+	// the download is aborted by the stop
+	tag = &engine.ApplicationTag{Name: "app", Version: "2.0"}
+	if err := cli.StartApplication(tag); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 200)
+	if err := cli.StopApplication(tag); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-aborted:
+	case <-time.After(time.Second * 5):
+		t.Fatal("download is not aborted by the stop")
+	}
+}
@@ -1,6 +1,9 @@
 package native
 
 import (
+	"context"
+	"time"
+
 	engine "github.com/jimi36/app-engine"
 	"github.com/jimi36/app-engine/log"
 	"github.com/pkg/errors"
@@ -17,9 +20,10 @@ func (cli *Client) StopApplication(ev *engine.TaskEvent) *engine.TaskResult {
 
 	log.Debugf("stop native application[%s]......", tag.Tag())
 
-	// check and get appliation instance
+	// check and get appliation instance, which has gone if the
+	// application is waiting for the restart
 	ins, found := cli.appInstances[tag.Name]
-	if !found {
+	if !found && !cli.restartPending(tag) {
 		log.Warnf("stop native application[%s] error: %s", tag.Tag(), engine.ErrApplicationNotStarted.Error())
 		return &engine.TaskResult{
 			Err: engine.ErrApplicationNotStarted,
@@ -27,33 +31,70 @@ func (cli *Client) StopApplication(ev *engine.TaskEvent) *engine.TaskResult {
 	}
 
 	// check application instance version
-	if ins.Version != tag.Version {
+	if found && ins.Version != tag.Version {
 		log.Warnf("stop native application[%s] error: version not match", tag.Tag())
 		return &engine.TaskResult{
 			Err: engine.ErrApplicationNotStarted,
 		}
 	}
 
-	// stop appliaction instance
-	if err := ins.Stop(); err != nil {
+	// stop appliaction instance and its replicas
+	var inss []*Instance
+	if found {
+		inss = append(inss, ins)
+	}
+	inss = append(inss, cli.takeReplicas(tag.Name)...)
+	killed, err := stopInstances(ev.Context(), inss)
+	if err != nil {
 		log.Warnf("stop native application[%s] error: %s", tag.Tag(), err.Error())
 	}
 
-	// remove application runtime
+	// remove application runtime, the pending restart is canceled with it
 	cli.store.RemoveApplicationRunTime(tag.Name)
+	delete(cli.exited, tag.Name)
+	cli.cancelRestart(tag.Name)
 
-	log.Debugf("stop native application[%s] finished", tag.Tag())
+	reason := "stopped gracefully"
+	if killed {
+		reason = "killed after grace period"
+	}
+	cli.notifyEvent(&engine.ApplicationEvent{
+		ApplicationTag: *tag,
+		Type:           engine.ApplicationStopped,
+		Reason:         reason,
+	})
 
-	return &engine.TaskResult{}
+	log.Debugf("stop native application[%s] finished: %s", tag.Tag(), reason)
+
+	return &engine.TaskResult{
+		Out: &engine.StopResult{
+			Killed: killed,
+		},
+	}
 }
 
 func (cli *Client) monitorInstance(ins *Instance) {
 	tag := &engine.ApplicationTag{ins.Name, ins.Version}
 	go func() {
-		select {
-		case <-ins.Done():
-			if _, err := cli.postTaskEvent(tag, cli.cleanStartedApplicationInfo, false); err != nil {
-				log.Fatalf("notify native application[%s] error: %s", tag.Tag(), err.Error())
+		unhealthy := ins.Unhealthy()
+		for {
+			select {
+			case <-cli.ctx.Done():
+				return
+			case <-unhealthy:
+				unhealthy = nil
+				if _, err := cli.postTaskEvent(context.Background(), ins, cli.stopUnhealthyInstance, false); err != nil {
+					log.Warnf("notify native application[%s] unhealthy error: %s", tag.Tag(), err.Error())
+				}
+			case <-ins.Done():
+				if cli.ctx.Err() != nil || ins.Released() {
+					// client is closed or the instance is replaced
+					return
+				}
+				if _, err := cli.postTaskEvent(context.Background(), tag, cli.cleanStartedApplicationInfo, false); err != nil {
+					log.Warnf("notify native application[%s] error: %s", tag.Tag(), err.Error())
+				}
+				return
 			}
 		}
 	}()
@@ -70,18 +111,76 @@ func (cli *Client) cleanStartedApplicationInfo(ev *engine.TaskEvent) *engine.Tas
 
 	log.Debugf("clean native started application[%s] info......", tag.Tag())
 
+	exitCode, exitSignal, exitReason, exitTime := -1, "", "", time.Now()
+	oomKills, livenessFailed := 0, false
+	if ins, found := cli.appInstances[tag.Name]; found && ins.Version != tag.Version {
+		// the instance is replaced by the upgraded one
+		log.Debugf("clean native started application[%s] info: version not match", tag.Tag())
+		return &engine.TaskResult{}
+	} else if found {
+		oomKills = ins.OomKills()
+		livenessFailed = ins.LivenessFailed()
+		exitCode = ins.ExitCode()
+		exitSignal = ins.ExitSignal()
+		exitReason = ins.ExitReason()
+		if t := ins.ExitTime(); !t.IsZero() {
+			exitTime = t
+		}
+	}
+
 	// update application runtime
+	wasStarted := false
+	var exitedRt *engine.ApplicationRuntime
 	cli.store.UpdateApplicationRuntime(tag.Name, func(rt *engine.ApplicationRuntime) error {
 		if rt.Version != tag.Version {
 			return errors.New("version not match")
 		}
+		wasStarted = rt.IsStarted
 		rt.IsStarted = false
 		rt.Pid = -1
+		if wasStarted {
+			rt.LastExitCode = exitCode
+			rt.LastExitSignal = exitSignal
+			rt.LastExitReason = exitReason
+			rt.LastExitTime = exitTime
+			rt.OomKills += oomKills
+		}
+		exitedRt = rt
 		return nil
 	})
 
 	delete(cli.appInstances, tag.Name)
 
+	restarting := false
+	if wasStarted {
+		cli.notifyEvent(&engine.ApplicationEvent{
+			ApplicationTag: *tag,
+			Type:           engine.ApplicationExited,
+			ExitCode:       exitCode,
+			Signal:         exitSignal,
+			Reason:         exitReason,
+		})
+		if exitedRt.ToStart {
+			// unknown exit code is treated as failure
+			restarting = cli.scheduleRestart(exitedRt, exitCode != 0 || livenessFailed)
+		}
+	}
+
+	if wasStarted && !restarting {
+		// not to be started by the reconciliation, but by the next client
+		cli.exited[tag.Name] = true
+	}
+
+	// the replicas are kept running while the application is restarted
+	if !restarting {
+		if replicas := cli.takeReplicas(tag.Name); len(replicas) > 0 {
+			if _, err := stopInstances(context.Background(), replicas); err != nil {
+				log.Warnf("clean native started application[%s] info error: %s", tag.Tag(), err.Error())
+			}
+			cli.saveReplicaPids(tag.Name)
+		}
+	}
+
 	log.Debugf("clean native started application[%s] info finished", tag.Tag())
 
 	return &engine.TaskResult{}
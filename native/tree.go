@@ -0,0 +1,40 @@
+package native
+
+import (
+	"syscall"
+
+	"github.com/shirou/gopsutil/process"
+)
+
+type treeProcess struct {
+	proc       *process.Process
+	createTime int64
+}
+
+// descendants returns all the descendant processes of proc, depth first.
+func descendants(proc *process.Process) []*treeProcess {
+	var out []*treeProcess
+	children, err := proc.Children()
+	if err != nil {
+		return out
+	}
+	for _, child := range children {
+		createTime, _ := child.CreateTime()
+		out = append(out, &treeProcess{proc: child, createTime: createTime})
+		out = append(out, descendants(child)...)
+	}
+	return out
+}
+
+// signalProcesses signals the processes which are still the same ones,
+// the create time is checked to avoid signaling reused pids.
+func signalProcesses(procs []*treeProcess, sig syscall.Signal) {
+	for _, p := range procs {
+		if createTime, err := p.proc.CreateTime(); err != nil || createTime != p.createTime {
+			continue
+		}
+		if isRunning, _ := p.proc.IsRunning(); isRunning {
+			signalProcessGroup(int(p.proc.Pid), sig)
+		}
+	}
+}
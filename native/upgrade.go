@@ -0,0 +1,420 @@
+package native
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+
+	engine "github.com/jimi36/app-engine"
+	"github.com/jimi36/app-engine/log"
+)
+
+const (
+	defaultMinReady      = time.Second * 5
+	upgradeCheckInterval = time.Millisecond * 500
+)
+
+// UpgradeApplication upgrades the started application to another version
+// in background, the result is sent to the returned channel. With the
+// StartFirst strategy, the new version runs as a candidate instance until it
+// is ready and then replaces the old one, which is kept running if the
+// candidate fails. With the StopFirst strategy, the old version is started
+// again if the new one fails.
+func (cli *Client) UpgradeApplication(ev *engine.TaskEvent) *engine.TaskResult {
+	req, ok := ev.In.(*engine.UpgradeRequest)
+	if !ok {
+		log.Fatalf("upgrade native application error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	from := &engine.ApplicationTag{Name: req.Name, Version: req.FromVersion}
+	to := &engine.ApplicationTag{Name: req.Name, Version: req.ToVersion}
+
+	log.Debugf("upgrade native application[%s] to %s......", from.Tag(), to.Version)
+
+	if cli.upgrading[req.Name] {
+		log.Warnf("upgrade native application[%s] error: %s", from.Tag(), engine.ErrApplicationUpgrading.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrApplicationUpgrading,
+		}
+	}
+
+	if ins, found := cli.appInstances[req.Name]; !found || ins.Version != from.Version {
+		log.Warnf("upgrade native application[%s] error: %s", from.Tag(), engine.ErrApplicationNotStarted.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrApplicationNotStarted,
+		}
+	}
+
+	app, err := cli.store.GetApplication(to)
+	if err != nil || app.NativeSpec == nil {
+		log.Warnf("upgrade native application[%s] error: %s", to.Tag(), engine.ErrApplicationNoExisted.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrApplicationNoExisted,
+		}
+	}
+
+	cli.upgrading[req.Name] = true
+
+	// the upgrade is aborted when the caller has gone away or the client is closed
+	ctx, cancel := context.WithCancel(ev.Context())
+	go func() {
+		select {
+		case <-cli.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		defer cancel()
+
+		var err error
+		if app.NativeSpec.UpgradeStrategy == engine.UpgradeStopFirst {
+			err = cli.upgradeStopFirst(ctx, app, from)
+		} else {
+			err = cli.upgradeStartFirst(ctx, app, from)
+		}
+		if err != nil {
+			log.Warnf("upgrade native application[%s] to %s error: %s", from.Tag(), to.Version, err.Error())
+			cli.notifyEvent(&engine.ApplicationEvent{
+				ApplicationTag: *to,
+				Type:           engine.ApplicationFailed,
+				Reason:         "upgrade failed: " + err.Error(),
+			})
+		}
+
+		if _, err := cli.postAndWait(cli.ctx, req.Name, cli.finishUpgrade); err != nil {
+			log.Warnf("upgrade native application[%s] error: %s", from.Tag(), err.Error())
+		}
+		done <- err
+	}()
+
+	log.Debugf("upgrade native application[%s] to %s finished", from.Tag(), to.Version)
+
+	return &engine.TaskResult{
+		Out: (<-chan error)(done),
+	}
+}
+
+// postAndWait posts the task event and waits for its result.
+func (cli *Client) postAndWait(ctx context.Context, in interface{}, h engine.TaskHandler) (interface{}, error) {
+	rc, err := cli.postTaskEvent(ctx, in, h, true)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case ret := <-rc:
+		return ret.Out, ret.Err
+	}
+}
+
+func (cli *Client) finishUpgrade(ev *engine.TaskEvent) *engine.TaskResult {
+	name, ok := ev.In.(string)
+	if !ok {
+		log.Fatalf("finish native application upgrade error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	delete(cli.upgrading, name)
+
+	return &engine.TaskResult{}
+}
+
+func (cli *Client) upgradeStartFirst(ctx context.Context, app *engine.Application, from *engine.ApplicationTag) error {
+	if rc := app.NativeSpec.Rc; rc != nil {
+		appFolder := filepath.Join(cli.basePath, app.Name, app.Version)
+		if err := os.MkdirAll(appFolder, 0755); err != nil {
+			return err
+		}
+		if err := cli.prepareResource(ctx, &app.ApplicationTag, rc, filepath.Join(appFolder, rc.FileName)); err != nil {
+			return err
+		}
+	}
+
+	_, err := cli.postAndWait(ctx, app, cli.startCandidate)
+	if err == nil {
+		err = cli.waitUpgradeReady(ctx, &app.ApplicationTag, true)
+	}
+	if err == nil {
+		_, err = cli.postAndWait(cli.ctx, from, cli.promoteCandidate)
+	}
+	if err != nil {
+		// keep the old version running
+		if _, err := cli.postAndWait(cli.ctx, app.Name, cli.abortCandidate); err != nil {
+			log.Warnf("abort native application[%s] candidate error: %s", app.Tag(), err.Error())
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (cli *Client) upgradeStopFirst(ctx context.Context, app *engine.Application, from *engine.ApplicationTag) error {
+	to := &app.ApplicationTag
+
+	if _, err := cli.postAndWait(ctx, from, cli.StopApplication); err != nil {
+		return err
+	}
+
+	_, err := cli.postAndWait(ctx, to, cli.StartApplication)
+	if err == nil {
+		err = cli.waitUpgradeReady(ctx, to, false)
+	}
+	if err != nil {
+		// roll back to the old version
+		log.Warnf("upgrade native application[%s] error: %s, roll back to %s", to.Tag(), err.Error(), from.Version)
+		if _, err := cli.postAndWait(cli.ctx, to, cli.StopApplication); err != nil {
+			log.Debugf("stop native application[%s] error: %s", to.Tag(), err.Error())
+		}
+		if _, err := cli.postAndWait(cli.ctx, from, cli.StartApplication); err != nil {
+			log.Warnf("roll back native application[%s] error: %s", from.Tag(), err.Error())
+		}
+		return err
+	}
+
+	return nil
+}
+
+// waitUpgradeReady waits until the instance of the new version is ready.
+func (cli *Client) waitUpgradeReady(ctx context.Context, tag *engine.ApplicationTag, candidate bool) error {
+	check := &upgradeCheck{
+		tag:       *tag,
+		candidate: candidate,
+	}
+	for {
+		out, err := cli.postAndWait(ctx, check, cli.checkUpgradeReady)
+		if err != nil {
+			return err
+		}
+		if ready, _ := out.(bool); ready {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "wait instance ready")
+		case <-time.After(upgradeCheckInterval):
+		}
+	}
+}
+
+type upgradeCheck struct {
+	tag       engine.ApplicationTag
+	candidate bool
+}
+
+func (cli *Client) checkUpgradeReady(ev *engine.TaskEvent) *engine.TaskResult {
+	check, ok := ev.In.(*upgradeCheck)
+	if !ok {
+		log.Fatalf("check native application upgrade error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	var ins *Instance
+	if check.candidate {
+		ins = cli.candidates[check.tag.Name]
+	} else {
+		rt, _ := cli.store.GetApplicationRuntime(check.tag.Name)
+		if rt == nil || rt.Version != check.tag.Version || !rt.ToStart {
+			reason := "instance is stopped"
+			if rt != nil && len(rt.Err) > 0 {
+				reason = rt.Err
+			}
+			return &engine.TaskResult{
+				Err: errors.New(reason),
+			}
+		}
+		ins = cli.appInstances[check.tag.Name]
+		if ins == nil && len(rt.LastExitReason) > 0 {
+			return &engine.TaskResult{
+				Err: errors.New(rt.LastExitReason),
+			}
+		}
+		if ins != nil && !rt.IsStarted {
+			// the resource is being downloaded
+			return &engine.TaskResult{Out: false}
+		}
+	}
+	if ins == nil || ins.Version != check.tag.Version {
+		return &engine.TaskResult{
+			Err: errors.New("instance is stopped"),
+		}
+	}
+
+	ready, err := ins.readyFor(ins.minReady)
+
+	return &engine.TaskResult{
+		Out: ready,
+		Err: err,
+	}
+}
+
+// startCandidate starts the instance of the new version beside the old one.
+func (cli *Client) startCandidate(ev *engine.TaskEvent) *engine.TaskResult {
+	app, ok := ev.In.(*engine.Application)
+	if !ok {
+		log.Fatalf("start native application candidate error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	log.Debugf("start native application[%s] candidate......", app.Tag())
+
+	ins, err := CreateInstance(app.Name, app.Version, cli.basePath, cli.cgroupParent)
+	if err != nil {
+		log.Warnf("start native application[%s] candidate error: %s", app.Tag(), err.Error())
+		return &engine.TaskResult{
+			Err: err,
+		}
+	}
+
+	cli.notifyEvent(&engine.ApplicationEvent{
+		ApplicationTag: app.ApplicationTag,
+		Type:           engine.ApplicationStarting,
+	})
+
+	if err := ins.Start(app); err != nil {
+		log.Warnf("start native application[%s] candidate error: %s", app.Tag(), err.Error())
+		if _, err := ins.Stop(context.Background()); err != nil {
+			log.Warnf("start native application[%s] candidate error: %s", app.Tag(), err.Error())
+		}
+		return &engine.TaskResult{
+			Err: errors.Wrap(err, "start instance err"),
+		}
+	}
+	cli.candidates[app.Name] = ins
+
+	log.Debugf("start native application[%s] candidate finished", app.Tag())
+
+	return &engine.TaskResult{}
+}
+
+// abortCandidate stops the candidate instance.
+func (cli *Client) abortCandidate(ev *engine.TaskEvent) *engine.TaskResult {
+	name, ok := ev.In.(string)
+	if !ok {
+		log.Fatalf("abort native application candidate error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	ins, found := cli.candidates[name]
+	if !found {
+		return &engine.TaskResult{}
+	}
+	delete(cli.candidates, name)
+
+	log.Debugf("abort native application[%s] candidate......", ins.String())
+
+	select {
+	case <-ins.Done():
+	default:
+		if _, err := ins.Stop(context.Background()); err != nil {
+			log.Warnf("abort native application[%s] candidate error: %s", ins.String(), err.Error())
+		}
+	}
+	ins.Release()
+
+	log.Debugf("abort native application[%s] candidate finished", ins.String())
+
+	return &engine.TaskResult{}
+}
+
+// promoteCandidate stops the old instance and replaces it with the candidate.
+func (cli *Client) promoteCandidate(ev *engine.TaskEvent) *engine.TaskResult {
+	from, ok := ev.In.(*engine.ApplicationTag)
+	if !ok {
+		log.Fatalf("promote native application candidate error: %s", engine.ErrTaskEventInvalid.Error())
+		return &engine.TaskResult{
+			Err: engine.ErrTaskEventInvalid,
+		}
+	}
+
+	log.Debugf("promote native application[%s] candidate......", from.Tag())
+
+	ins, found := cli.candidates[from.Name]
+	if !found {
+		return &engine.TaskResult{
+			Err: errors.New("candidate instance not found"),
+		}
+	}
+	old, found := cli.appInstances[from.Name]
+	if !found || old.Version != from.Version {
+		return &engine.TaskResult{
+			Err: errors.New("old instance is stopped"),
+		}
+	}
+	select {
+	case <-ins.Done():
+		return &engine.TaskResult{
+			Err: errors.New(ins.ExitReason()),
+		}
+	default:
+	}
+	delete(cli.candidates, from.Name)
+
+	// the exit of the old instance is ignored as it is replaced
+	inss := append([]*Instance{old}, cli.takeReplicas(from.Name)...)
+	killed, err := stopInstances(context.Background(), inss)
+	if err != nil {
+		log.Warnf("promote native application[%s] candidate error: %s", from.Tag(), err.Error())
+	}
+	reason := "stopped gracefully"
+	if killed {
+		reason = "killed after grace period"
+	}
+	cli.notifyEvent(&engine.ApplicationEvent{
+		ApplicationTag: *from,
+		Type:           engine.ApplicationStopped,
+		Reason:         reason,
+	})
+
+	cli.appInstances[from.Name] = ins
+	cli.monitorInstance(ins)
+
+	to := engine.ApplicationTag{Name: ins.Name, Version: ins.Version}
+	cli.store.UpdateApplicationRuntime(from.Name, func(rt *engine.ApplicationRuntime) error {
+		rt.Version = to.Version
+		rt.ToStart = true
+		rt.IsStarted = true
+		rt.Pid = ins.Pid()
+		rt.StartTime = ins.StartTime()
+		rt.RestartCount = 0
+		rt.OomKills = 0
+		rt.DownloadedBytes = 0
+		rt.TotalBytes = 0
+		rt.Err = ""
+		return nil
+	})
+
+	cli.notifyEvent(&engine.ApplicationEvent{
+		ApplicationTag: to,
+		Type:           engine.ApplicationStarted,
+	})
+
+	// only the candidate is checked, the other replicas are started after it is promoted
+	if app, err := cli.store.GetApplication(&to); err == nil {
+		if err := cli.scaleReplicas(context.Background(), app); err != nil {
+			log.Warnf("promote native application[%s] candidate error: %s", to.Tag(), err.Error())
+		}
+	}
+
+	log.Debugf("promote native application[%s] candidate finished", to.Tag())
+
+	return &engine.TaskResult{}
+}
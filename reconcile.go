@@ -0,0 +1,180 @@
+package engine
+
+import (
+	"context"
+	"time"
+
+	"github.com/jimi36/app-engine/log"
+)
+
+type ReconcileActionType string
+
+const (
+	// ReconcileStart starts the application which should be running
+	ReconcileStart ReconcileActionType = "start"
+	// ReconcileStop stops the instance which shouldn't be running
+	ReconcileStop ReconcileActionType = "stop"
+	// ReconcileRepair replaces the instance which is not the started one
+	ReconcileRepair ReconcileActionType = "repair"
+	// ReconcileScale restores the instance count of the application
+	ReconcileScale ReconcileActionType = "scale"
+)
+
+type ReconcileOption struct {
+	// only reports the drifts without correcting them
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+type ReconcileAction struct {
+	ApplicationTag `json:",inline"`
+
+	Type   ReconcileActionType `json:"type,omitempty"`
+	Reason string              `json:"reason,omitempty"`
+	// error of the correction, empty in dry-run mode
+	Err string `json:"err,omitempty"`
+}
+
+type ReconcileStats struct {
+	// reconcile passes
+	Runs int64 `json:"runs,omitempty"`
+	// drifts found, including the ones of the dry-run passes
+	Drifts int64 `json:"drifts,omitempty"`
+	// drifts corrected and failed to correct
+	Corrections int64                         `json:"corrections,omitempty"`
+	Failures    int64                         `json:"failures,omitempty"`
+	ByType      map[ReconcileActionType]int64 `json:"byType,omitempty"`
+	LastRun     time.Time                     `json:"lastRun,omitempty"`
+}
+
+// ReconcileInterval sets the interval of the periodic reconciliation,
+// which is disabled if it's 0.
+func ReconcileInterval(interval time.Duration) ClientOption {
+	return func(c *Client) {
+		c.reconcileInterval = interval
+	}
+}
+
+// ReconcileDryRun makes the periodic reconciliation only report the drifts.
+func ReconcileDryRun(dryRun bool) ClientOption {
+	return func(c *Client) {
+		c.reconcileDryRun = dryRun
+	}
+}
+
+// Reconcile compares the desired state of the applications in the store with
+// their actual state, and corrects the drifts with the default TaskHandleTimeout.
+func (c *Client) Reconcile(opt *ReconcileOption) ([]*ReconcileAction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TaskHandleTimeout)
+	defer cancel()
+	return c.ReconcileWithContext(ctx, opt)
+}
+
+// ReconcileWithContext compares the desired state of the applications with
+// their actual state, and corrects the drifts unless opt.DryRun is set. The
+// drifts found are returned, the call is aborted when ctx is done.
+func (c *Client) ReconcileWithContext(ctx context.Context, opt *ReconcileOption) ([]*ReconcileAction, error) {
+	log.Debugf("reconcile applications......")
+
+	if opt == nil {
+		opt = &ReconcileOption{}
+	}
+
+	rc, err := c.postTaskEvent(ctx, opt, c.impl.ReconcileApplications, true)
+	if err != nil {
+		log.Warnf("reconcile applications error: %s", err.Error())
+		return nil, err
+	}
+
+	var ret *TaskResult
+	select {
+	case <-ctx.Done():
+		err := contextError(ctx)
+		log.Warnf("reconcile applications error: %s", err.Error())
+		return nil, err
+	case ret = <-rc:
+	}
+
+	if ret.Err != nil {
+		log.Warnf("reconcile applications error: %s", ret.Err.Error())
+		return nil, ret.Err
+	}
+
+	actions, ok := ret.Out.([]*ReconcileAction)
+	if !ok {
+		log.Warnf("reconcile applications error: %s", ErrTaskResultInvalid.Error())
+		return nil, ErrTaskResultInvalid
+	}
+
+	c.recordReconcile(actions, opt.DryRun)
+
+	for _, action := range actions {
+		if opt.DryRun {
+			log.Infof("reconcile application[%s] %s (dry run): %s", action.Tag(), action.Type, action.Reason)
+		} else if len(action.Err) > 0 {
+			log.Warnf("reconcile application[%s] %s error: %s", action.Tag(), action.Type, action.Err)
+		} else {
+			log.Infof("reconcile application[%s] %s: %s", action.Tag(), action.Type, action.Reason)
+		}
+	}
+
+	log.Debugf("reconcile applications finished")
+
+	return actions, nil
+}
+
+// ReconcileStats returns the metrics of the reconciliation.
+func (c *Client) ReconcileStats() ReconcileStats {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+
+	stats := c.reconcileStats
+	stats.ByType = make(map[ReconcileActionType]int64, len(c.reconcileStats.ByType))
+	for k, v := range c.reconcileStats.ByType {
+		stats.ByType[k] = v
+	}
+	return stats
+}
+
+func (c *Client) recordReconcile(actions []*ReconcileAction, dryRun bool) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+
+	stats := &c.reconcileStats
+	stats.Runs++
+	stats.LastRun = time.Now()
+	stats.Drifts += int64(len(actions))
+	if dryRun {
+		return
+	}
+	for _, action := range actions {
+		if len(action.Err) > 0 {
+			stats.Failures++
+			continue
+		}
+		stats.Corrections++
+		if stats.ByType == nil {
+			stats.ByType = make(map[ReconcileActionType]int64)
+		}
+		stats.ByType[action.Type]++
+	}
+}
+
+func (c *Client) reconcileLoop() {
+	ticker := time.NewTicker(c.reconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.quit:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), TaskHandleTimeout)
+		_, err := c.ReconcileWithContext(ctx, &ReconcileOption{DryRun: c.reconcileDryRun})
+		cancel()
+		if err == ErrClientNotStarted {
+			return
+		}
+	}
+}
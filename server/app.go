@@ -0,0 +1,231 @@
+package server
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	engine "github.com/jimi36/app-engine"
+)
+
+// handleApplications lists the applications, or creates the application.
+func (s *Server) handleApplications(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodPost) {
+		return
+	}
+
+	ctx, cancel := s.context(r)
+	defer cancel()
+
+	if r.Method == http.MethodGet {
+		tags, err := s.cli.ListApplicationsWithContext(ctx, &engine.ListApplicationOption{Size: math.MaxInt32})
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if tags == nil {
+			tags = []*engine.ApplicationTag{}
+		}
+		writeJson(w, http.StatusOK, tags)
+		return
+	}
+
+	app := &engine.Application{}
+	if err := decodeBody(w, r, app); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := engine.ValidateApplication(app); err != nil {
+		writeError(w, requestError(CodeParamInvalid, err.Error()))
+		return
+	}
+	if err := s.cli.CreateApplicationWithContext(ctx, app); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJson(w, http.StatusCreated, &app.ApplicationTag)
+}
+
+// handleApplication serves the application at /v1/applications/{name}/{version}[/{action}].
+func (s *Server) handleApplication(w http.ResponseWriter, r *http.Request) {
+	segs, err := splitPath(r, PathApplications)
+	if err != nil || len(segs) < 2 || len(segs) > 3 {
+		writeError(w, requestError(CodeNotFound, "no route for "+r.URL.Path))
+		return
+	}
+	tag := &engine.ApplicationTag{Name: segs[0], Version: segs[1]}
+
+	if len(segs) == 2 {
+		if !allowMethods(w, r, http.MethodGet, http.MethodDelete) {
+			return
+		}
+		ctx, cancel := s.context(r)
+		defer cancel()
+		if r.Method == http.MethodGet {
+			app, err := s.cli.GetApplicationWithContext(ctx, tag)
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			writeJson(w, http.StatusOK, app)
+			return
+		}
+		if err := s.cli.RemoveApplicationWithContext(ctx, tag); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	switch segs[2] {
+	case "start", "stop", "restart":
+		if !allowMethods(w, r, http.MethodPost) {
+			return
+		}
+		s.actApplication(w, r, tag, segs[2])
+	case "state":
+		if !allowMethods(w, r, http.MethodGet) {
+			return
+		}
+		ctx, cancel := s.context(r)
+		defer cancel()
+		states, err := s.cli.GetApplicationStatesWithContext(ctx, []*engine.ApplicationTag{tag})
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if len(states) == 0 {
+			writeError(w, engine.ErrApplicationNoExisted)
+			return
+		}
+		writeJson(w, http.StatusOK, states[0])
+	case "logs":
+		if !allowMethods(w, r, http.MethodGet) {
+			return
+		}
+		s.writeLogs(w, r, tag)
+	default:
+		writeError(w, requestError(CodeNotFound, "no route for "+r.URL.Path))
+	}
+}
+
+func (s *Server) actApplication(w http.ResponseWriter, r *http.Request, tag *engine.ApplicationTag, action string) {
+	ctx, cancel := s.context(r)
+	defer cancel()
+
+	var err error
+	switch action {
+	case "start":
+		err = s.cli.StartApplicationWithContext(ctx, tag)
+	case "stop":
+		err = s.cli.StopApplicationWithContext(ctx, tag)
+	case "restart":
+		err = s.cli.StopApplicationWithContext(ctx, tag)
+		if err == nil || errors.Is(err, engine.ErrApplicationNotStarted) {
+			err = s.cli.StartApplicationWithContext(ctx, tag)
+		}
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeLogs streams the logs, the followed ones last until the request is canceled.
+func (s *Server) writeLogs(w http.ResponseWriter, r *http.Request, tag *engine.ApplicationTag) {
+	q := r.URL.Query()
+	opt := &engine.LogOption{
+		Instance: q.Get("instance"),
+	}
+	var err error
+	if v := q.Get("tailLines"); len(v) > 0 {
+		if opt.TailLines, err = strconv.Atoi(v); err != nil || opt.TailLines < 0 {
+			writeError(w, requestError(CodeRequestInvalid, "invalid tailLines "+v))
+			return
+		}
+	}
+	if v := q.Get("since"); len(v) > 0 {
+		if opt.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			writeError(w, requestError(CodeRequestInvalid, "invalid since "+v))
+			return
+		}
+	}
+	for _, f := range []struct {
+		name string
+		v    *bool
+	}{{"follow", &opt.Follow}, {"stderr", &opt.Stderr}} {
+		if v := q.Get(f.name); len(v) > 0 {
+			if *f.v, err = strconv.ParseBool(v); err != nil {
+				writeError(w, requestError(CodeRequestInvalid, "invalid "+f.name+" "+v))
+				return
+			}
+		}
+	}
+
+	ctx, cancel := s.context(r)
+	defer cancel()
+	rc, err := s.cli.GetApplicationLogsWithContext(ctx, tag, opt)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer rc.Close()
+
+	// the follow reader is not bound to the context
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-r.Context().Done():
+			rc.Close()
+		case <-done:
+		}
+	}()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	writeStream(w, r, rc)
+}
+
+// handleStates gets the states of all the applications, or the ones of the body.
+func (s *Server) handleStates(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodPost) {
+		return
+	}
+
+	ctx, cancel := s.context(r)
+	defer cancel()
+
+	var tags []*engine.ApplicationTag
+	var err error
+	if r.Method == http.MethodGet {
+		if tags, err = s.cli.ListApplicationsWithContext(ctx, &engine.ListApplicationOption{Size: math.MaxInt32}); err != nil {
+			writeError(w, err)
+			return
+		}
+	} else {
+		if err := decodeBody(w, r, &tags); err != nil {
+			writeError(w, err)
+			return
+		}
+		for _, tag := range tags {
+			if tag == nil || len(tag.Name) == 0 || len(tag.Version) == 0 {
+				writeError(w, requestError(CodeParamInvalid, "application name or version is empty"))
+				return
+			}
+		}
+	}
+
+	states := []*engine.ApplicationState{}
+	if len(tags) > 0 {
+		if states, err = s.cli.GetApplicationStatesWithContext(ctx, tags); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	writeJson(w, http.StatusOK, states)
+}
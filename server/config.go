@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net/http"
+
+	engine "github.com/jimi36/app-engine"
+)
+
+// handleConfigs lists the configs, or creates the config.
+func (s *Server) handleConfigs(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodPost) {
+		return
+	}
+
+	ctx, cancel := s.context(r)
+	defer cancel()
+
+	if r.Method == http.MethodGet {
+		configs, err := s.cli.ListConfigsWithContext(ctx)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if configs == nil {
+			configs = []*engine.Config{}
+		}
+		writeJson(w, http.StatusOK, configs)
+		return
+	}
+
+	config := &engine.Config{}
+	if err := decodeBody(w, r, config); err != nil {
+		writeError(w, err)
+		return
+	}
+	if len(config.Name) == 0 {
+		writeError(w, requestError(CodeParamInvalid, "config name is empty"))
+		return
+	}
+	if err := s.cli.CreateConfigWithContext(ctx, config); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJson(w, http.StatusCreated, config)
+}
+
+// handleConfig serves the config at /v1/configs/{name}.
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	segs, err := splitPath(r, PathConfigs)
+	if err != nil || len(segs) != 1 {
+		writeError(w, requestError(CodeNotFound, "no route for "+r.URL.Path))
+		return
+	}
+	if !allowMethods(w, r, http.MethodGet, http.MethodDelete) {
+		return
+	}
+
+	ctx, cancel := s.context(r)
+	defer cancel()
+
+	if r.Method == http.MethodGet {
+		configs, err := s.cli.ListConfigsWithContext(ctx)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		for _, config := range configs {
+			if config.Name == segs[0] {
+				writeJson(w, http.StatusOK, config)
+				return
+			}
+		}
+		writeError(w, engine.ErrConfigNoExisted)
+		return
+	}
+
+	if err := s.cli.RemoveConfigWithContext(ctx, segs[0]); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	engine "github.com/jimi36/app-engine"
+)
+
+// error codes of the responses
+const (
+	CodeRequestInvalid        = "request_invalid"
+	CodeNotFound              = "not_found"
+	CodeMethodNotAllowed      = "method_not_allowed"
+	CodeInternal              = "internal"
+	CodeTimeout               = "timeout"
+	CodeNotImplement          = "not_implement"
+	CodeOptionInvalid         = "option_invalid"
+	CodeParamInvalid          = "param_invalid"
+	CodeClientNotStarted      = "client_not_started"
+	CodeClientStarted         = "client_started"
+	CodeApplicationExisted    = "application_existed"
+	CodeApplicationNoExisted  = "application_not_existed"
+	CodeApplicationStarted    = "application_started"
+	CodeApplicationNotStarted = "application_not_started"
+	CodeApplicationUpgrading  = "application_upgrading"
+	CodeNoKnownGoodVersion    = "no_known_good_version"
+	CodeConfigExisted         = "config_existed"
+	CodeConfigNoExisted       = "config_not_existed"
+)
+
+// Error is the response body of the failed request.
+type Error struct {
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+type errorCode struct {
+	err    error
+	status int
+	code   string
+}
+
+// errorCodes maps the engine errors to the codes and the http statuses.
+var errorCodes = []errorCode{
+	{nil, http.StatusBadRequest, CodeRequestInvalid},
+	{nil, http.StatusNotFound, CodeNotFound},
+	{nil, http.StatusMethodNotAllowed, CodeMethodNotAllowed},
+	{engine.ErrTimeout, http.StatusGatewayTimeout, CodeTimeout},
+	{engine.ErrNotImplement, http.StatusNotImplemented, CodeNotImplement},
+	{engine.ErrOptionInvalid, http.StatusBadRequest, CodeOptionInvalid},
+	{engine.ErrParamInvalid, http.StatusBadRequest, CodeParamInvalid},
+	{engine.ErrClientNotStarted, http.StatusServiceUnavailable, CodeClientNotStarted},
+	{engine.ErrClientStarted, http.StatusConflict, CodeClientStarted},
+	{engine.ErrApplicationExisted, http.StatusConflict, CodeApplicationExisted},
+	{engine.ErrStoreAppExisted, http.StatusConflict, CodeApplicationExisted},
+	{engine.ErrApplicationNoExisted, http.StatusNotFound, CodeApplicationNoExisted},
+	{engine.ErrStoreAppNoFound, http.StatusNotFound, CodeApplicationNoExisted},
+	{engine.ErrApplicationStarted, http.StatusConflict, CodeApplicationStarted},
+	{engine.ErrApplicationNotStarted, http.StatusConflict, CodeApplicationNotStarted},
+	{engine.ErrApplicationUpgrading, http.StatusConflict, CodeApplicationUpgrading},
+	{engine.ErrNoKnownGoodVersion, http.StatusConflict, CodeNoKnownGoodVersion},
+	{engine.ErrConfigExisted, http.StatusConflict, CodeConfigExisted},
+	{engine.ErrConfigNoExisted, http.StatusNotFound, CodeConfigNoExisted},
+	{engine.ErrStoreConfigNoFound, http.StatusNotFound, CodeConfigNoExisted},
+}
+
+// ErrorStatus returns the http status and the code of the error, the
+// errors wrapped by github.com/pkg/errors are unwrapped.
+func ErrorStatus(err error) (int, string) {
+	if e, ok := err.(*Error); ok {
+		for _, ec := range errorCodes {
+			if ec.code == e.Code {
+				return ec.status, ec.code
+			}
+		}
+	}
+	for _, ec := range errorCodes {
+		if ec.err != nil && errors.Is(err, ec.err) {
+			return ec.status, ec.code
+		}
+	}
+	return http.StatusInternalServerError, CodeInternal
+}
+
+// Is reports whether the engine error is of the code, so the errors of the
+// daemon can be compared with errors.Is like the ones of the engine.
+func (e *Error) Is(target error) bool {
+	for _, ec := range errorCodes {
+		if ec.code == e.Code && ec.err == target && ec.err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func requestError(code string, msg string) *Error {
+	return &Error{Code: code, Message: msg}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status, code := ErrorStatus(err)
+	writeJson(w, status, &Error{Code: code, Message: err.Error()})
+}
+
+func writeJson(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	pkgerrors "github.com/pkg/errors"
+
+	engine "github.com/jimi36/app-engine"
+)
+
+func TestErrorStatus(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{engine.ErrParamInvalid, http.StatusBadRequest, CodeParamInvalid},
+		{pkgerrors.Wrap(engine.ErrParamInvalid, "replicas must not be negative"), http.StatusBadRequest, CodeParamInvalid},
+		{engine.ErrApplicationNoExisted, http.StatusNotFound, CodeApplicationNoExisted},
+		{engine.ErrStoreAppNoFound, http.StatusNotFound, CodeApplicationNoExisted},
+		{engine.ErrApplicationExisted, http.StatusConflict, CodeApplicationExisted},
+		{engine.ErrStoreAppExisted, http.StatusConflict, CodeApplicationExisted},
+		{engine.ErrApplicationNotStarted, http.StatusConflict, CodeApplicationNotStarted},
+		{engine.ErrConfigNoExisted, http.StatusNotFound, CodeConfigNoExisted},
+		{engine.ErrClientNotStarted, http.StatusServiceUnavailable, CodeClientNotStarted},
+		{engine.ErrTimeout, http.StatusGatewayTimeout, CodeTimeout},
+		{engine.ErrNotImplement, http.StatusNotImplemented, CodeNotImplement},
+		{requestError(CodeNotFound, "no route"), http.StatusNotFound, CodeNotFound},
+		{requestError(CodeMethodNotAllowed, "not allowed"), http.StatusMethodNotAllowed, CodeMethodNotAllowed},
+		{requestError(CodeRequestInvalid, "invalid body"), http.StatusBadRequest, CodeRequestInvalid},
+		{errors.New("unknown"), http.StatusInternalServerError, CodeInternal},
+	}
+
+	for _, c := range cases {
+		status, code := ErrorStatus(c.err)
+		if status != c.status || code != c.code {
+			t.Errorf("error %q maps to %d %s, want %d %s", c.err.Error(), status, code, c.status, c.code)
+		}
+	}
+}
+
+func TestErrorIs(t *testing.T) {
+	err := error(&Error{Code: CodeApplicationNotStarted, Message: "application not started"})
+	if !errors.Is(err, engine.ErrApplicationNotStarted) {
+		t.Errorf("error of code %s should be %v", CodeApplicationNotStarted, engine.ErrApplicationNotStarted)
+	}
+	if errors.Is(err, engine.ErrApplicationStarted) {
+		t.Errorf("error of code %s should not be %v", CodeApplicationNotStarted, engine.ErrApplicationStarted)
+	}
+
+	// the request errors have no engine error
+	err = &Error{Code: CodeNotFound, Message: "no route"}
+	if errors.Is(err, engine.ErrApplicationNoExisted) {
+		t.Errorf("error of code %s should not be %v", CodeNotFound, engine.ErrApplicationNoExisted)
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	engine "github.com/jimi36/app-engine"
+)
+
+const (
+	// heartbeatInterval is the interval of the comments keeping the event stream alive
+	heartbeatInterval = time.Second * 15
+	// maxEventBufferSize is the max buffer size of the event stream
+	maxEventBufferSize = 4096
+)
+
+// handleEvents streams the application events as server-sent events, the
+// event name is the event type and the data is the json event. The events
+// of the applications of the name parameters are sent, or all of them.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, requestError(CodeInternal, "streaming not supported"))
+		return
+	}
+
+	opt := &engine.WatchOption{
+		Names: r.URL.Query()["name"],
+	}
+	if v := r.URL.Query().Get("bufferSize"); len(v) > 0 {
+		size, err := strconv.Atoi(v)
+		if err != nil || size < 0 {
+			writeError(w, requestError(CodeRequestInvalid, "invalid bufferSize "+v))
+			return
+		}
+		if size > maxEventBufferSize {
+			size = maxEventBufferSize
+		}
+		opt.BufferSize = size
+	}
+	watcher := s.cli.Watch(opt)
+	defer watcher.Stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case ev, ok := <-watcher.Events():
+			if !ok {
+				// the client is stopped
+				return
+			}
+			data, err := json.Marshal(&ev)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	engine "github.com/jimi36/app-engine"
+	"github.com/jimi36/app-engine/log"
+)
+
+const (
+	// DefaultAddress is the default listen address of the daemon
+	DefaultAddress = "unix:///run/app-engine.sock"
+	// maxBodyBytes is the max size of the request body
+	maxBodyBytes = 4 << 20
+)
+
+// routes of the api
+const (
+	PathApplications = "/v1/applications"
+	PathStates       = "/v1/states"
+	PathConfigs      = "/v1/configs"
+	PathEvents       = "/v1/events"
+)
+
+// ApplicationPath returns the path of the application, or its action if not empty.
+func ApplicationPath(tag *engine.ApplicationTag, action string) string {
+	p := PathApplications + "/" + url.PathEscape(tag.Name) + "/" + url.PathEscape(tag.Version)
+	if len(action) > 0 {
+		p += "/" + action
+	}
+	return p
+}
+
+// ConfigPath returns the path of the config.
+func ConfigPath(name string) string {
+	return PathConfigs + "/" + url.PathEscape(name)
+}
+
+// Server serves the api of the engine client, which is started and stopped by the caller.
+type Server struct {
+	cli *engine.Client
+	mux *http.ServeMux
+}
+
+func New(cli *engine.Client) *Server {
+	s := &Server{
+		cli: cli,
+		mux: http.NewServeMux(),
+	}
+	s.mux.HandleFunc(PathApplications, s.handleApplications)
+	s.mux.HandleFunc(PathApplications+"/", s.handleApplication)
+	s.mux.HandleFunc(PathStates, s.handleStates)
+	s.mux.HandleFunc(PathConfigs, s.handleConfigs)
+	s.mux.HandleFunc(PathConfigs+"/", s.handleConfig)
+	s.mux.HandleFunc(PathEvents, s.handleEvents)
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, requestError(CodeNotFound, "no route for "+r.URL.Path))
+	})
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Debugf("serve %s %s", r.Method, r.URL.Path)
+	s.mux.ServeHTTP(w, r)
+}
+
+// Listen listens the address, which is a unix socket path like
+// unix:///run/app-engine.sock, or a tcp address like 127.0.0.1:7070.
+// The api has no authentication, so the tcp address out of the loopback
+// interface is refused unless insecure is set. The stale unix socket is
+// removed, and the new one is only accessible by the user and the group.
+func Listen(addr string, insecure bool) (net.Listener, error) {
+	if !strings.HasPrefix(addr, "unix://") {
+		addr = strings.TrimPrefix(addr, "tcp://")
+		if !insecure && !isLoopback(addr) {
+			return nil, fmt.Errorf("refuse to listen on %s out of the loopback interface without authentication", addr)
+		}
+		return net.Listen("tcp", addr)
+	}
+
+	sock := strings.TrimPrefix(addr, "unix://")
+	if fi, err := os.Stat(sock); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			conn.Close()
+			return nil, &net.OpError{Op: "listen", Net: "unix", Err: os.ErrExist}
+		}
+		os.Remove(sock)
+	}
+
+	// the socket is created in a private folder and moved to the path
+	// after its mode is set, so it's never accessible by the others
+	dir, err := ioutil.TempDir(filepath.Dir(sock), "."+filepath.Base(sock))
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, "sock")
+	l, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, 0660); err != nil {
+		l.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, sock); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return &unixListener{Listener: l, path: sock}, nil
+}
+
+// unixListener removes the socket moved to the path when it's closed.
+type unixListener struct {
+	net.Listener
+	path string
+}
+
+func (l *unixListener) Close() error {
+	err := l.Listener.Close()
+	os.Remove(l.path)
+	return err
+}
+
+// isLoopback reports whether the tcp address is on the loopback interface.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// context returns the context of the engine call, which is done when the
+// request is canceled.
+func (s *Server) context(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.Context(), engine.TaskHandleTimeout)
+}
+
+// splitPath splits the escaped path after the prefix into the segments.
+func splitPath(r *http.Request, prefix string) ([]string, error) {
+	p := strings.TrimPrefix(r.URL.EscapedPath(), prefix+"/")
+	var segs []string
+	for _, seg := range strings.Split(p, "/") {
+		s, err := url.PathUnescape(seg)
+		if err != nil || len(s) == 0 {
+			return nil, requestError(CodeNotFound, "no route for "+r.URL.Path)
+		}
+		segs = append(segs, s)
+	}
+	return segs, nil
+}
+
+// decodeBody decodes the json body, the unknown fields are rejected.
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return requestError(CodeRequestInvalid, "invalid body: "+err.Error())
+	}
+	if dec.More() {
+		return requestError(CodeRequestInvalid, "invalid body: more than one value")
+	}
+	return nil
+}
+
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, requestError(CodeMethodNotAllowed, "method "+r.Method+" not allowed"))
+	return false
+}
+
+// writeStream copies the reader to the response, and flushes each read
+// so the followed logs are sent in time.
+func writeStream(w http.ResponseWriter, r *http.Request, rd io.Reader) {
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := rd.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err != nil || r.Context().Err() != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	engine "github.com/jimi36/app-engine"
+	"github.com/jimi36/app-engine/native"
+)
+
+func newTestServer(t *testing.T) (*httptest.Server, func()) {
+	dir, err := ioutil.TempDir("", "server-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	impl, err := native.NewClient(native.BasePath(dir), native.GCInterval(0))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	cli := engine.NewClient(impl)
+	if err := cli.Start(); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(New(cli))
+	return ts, func() {
+		ts.Close()
+		cli.Stop(&engine.StopOption{})
+		os.RemoveAll(dir)
+	}
+}
+
+func TestServerErrorCodes(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	app := &engine.Application{
+		ApplicationTag: engine.ApplicationTag{Name: "app", Version: "1.0"},
+		Type:           engine.Native,
+		NativeSpec:     &engine.NativeAppSpec{Command: []string{"/bin/true"}},
+	}
+	body, _ := json.Marshal(app)
+	invalid, _ := json.Marshal(&engine.Application{
+		ApplicationTag: engine.ApplicationTag{Name: "..", Version: "1.0"},
+		Type:           engine.Native,
+		NativeSpec:     &engine.NativeAppSpec{Command: []string{"/bin/true"}},
+	})
+
+	cases := []struct {
+		method string
+		path   string
+		body   []byte
+		status int
+		code   string
+	}{
+		{http.MethodGet, "/v2/applications", nil, http.StatusNotFound, CodeNotFound},
+		{http.MethodPut, PathApplications, nil, http.StatusMethodNotAllowed, CodeMethodNotAllowed},
+		{http.MethodPost, PathApplications, []byte("{"), http.StatusBadRequest, CodeRequestInvalid},
+		{http.MethodPost, PathApplications, []byte(`{"unknown":1}`), http.StatusBadRequest, CodeRequestInvalid},
+		{http.MethodPost, PathApplications, invalid, http.StatusBadRequest, CodeParamInvalid},
+		{http.MethodPost, PathApplications, body, http.StatusCreated, ""},
+		{http.MethodPost, PathApplications, body, http.StatusConflict, CodeApplicationExisted},
+		{http.MethodGet, ApplicationPath(&app.ApplicationTag, ""), nil, http.StatusOK, ""},
+		{http.MethodGet, ApplicationPath(&engine.ApplicationTag{Name: "none", Version: "1.0"}, ""), nil, http.StatusNotFound, CodeApplicationNoExisted},
+		{http.MethodPost, ApplicationPath(&app.ApplicationTag, "stop"), nil, http.StatusConflict, CodeApplicationNotStarted},
+		{http.MethodPost, ApplicationPath(&app.ApplicationTag, "unknown"), nil, http.StatusNotFound, CodeNotFound},
+		{http.MethodGet, ConfigPath("none"), nil, http.StatusNotFound, CodeConfigNoExisted},
+		{http.MethodGet, PathEvents + "?bufferSize=-1", nil, http.StatusBadRequest, CodeRequestInvalid},
+		{http.MethodDelete, ApplicationPath(&app.ApplicationTag, ""), nil, http.StatusNoContent, ""},
+	}
+
+	for _, c := range cases {
+		req, err := http.NewRequest(c.method, ts.URL+c.path, bytes.NewReader(c.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := &Error{}
+		json.NewDecoder(resp.Body).Decode(e)
+		resp.Body.Close()
+		if resp.StatusCode != c.status || resp.StatusCode >= 300 && e.Code != c.code {
+			t.Errorf("%s %s responds %d %s, want %d %s", c.method, c.path, resp.StatusCode, e.Code, c.status, c.code)
+		}
+	}
+}
+
+func TestListen(t *testing.T) {
+	for _, addr := range []string{":0", "0.0.0.0:0", "tcp://[::]:0"} {
+		if l, err := Listen(addr, false); err == nil {
+			l.Close()
+			t.Errorf("listen %s should be refused", addr)
+		}
+	}
+	for _, addr := range []string{"127.0.0.1:0", "tcp://localhost:0"} {
+		l, err := Listen(addr, false)
+		if err != nil {
+			t.Errorf("listen %s error: %v", addr, err)
+			continue
+		}
+		l.Close()
+	}
+
+	dir, err := ioutil.TempDir("", "server-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sock := filepath.Join(dir, "app-engine.sock")
+	l, err := Listen("unix://"+sock, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode()&os.ModeSocket == 0 || fi.Mode().Perm() != 0660 {
+		t.Errorf("socket mode is %s, want socket 0660", fi.Mode())
+	}
+	if _, err := Listen("unix://"+sock, false); err == nil {
+		t.Errorf("listen the socket in use should fail")
+	}
+
+	l.Close()
+	if _, err := os.Stat(sock); !os.IsNotExist(err) {
+		t.Errorf("socket should be removed when closed: %v", err)
+	}
+	if infos, _ := ioutil.ReadDir(dir); len(infos) != 0 {
+		t.Errorf("temp folder of the socket is left")
+	}
+}
@@ -10,6 +10,11 @@ type KubeAppSpec struct {
 	Volumes []KubeVolume `json:"volumes,omitempty"`
 	Command []string     `json:"command,omitempty"`
 	Service *KubeService `json:"service, omitempty"`
+	// container requests and limits
+	Resources *ResourceSpec `json:"resources,omitempty"`
+	// health checks
+	LivenessProbe  *Probe `json:"livenessProbe,omitempty"`
+	ReadinessProbe *Probe `json:"readinessProbe,omitempty"`
 }
 
 type KubePort struct {
@@ -36,19 +41,179 @@ type KubeService struct {
 type KubeServicePort struct {
 	Name       string          `json:"name,omitempty"`
 	Port       int32           `json:"port,omitempty"`
-	TargetPort int32           `json:"targetPort, omitempty"`
-	NodePort   int32           `json:"targetPort, omitempty"`
+	TargetPort int32           `json:"targetPort,omitempty"`
+	NodePort   int32           `json:"nodePort,omitempty"`
 	Protocol   coreV1.Protocol `json:"protocol,omitempty"`
 }
 
 type NativeAppSpec struct {
 	Rc      *NativeResource `json:"rc,omitempty"`
 	Command []string        `json:"command,omitempty"`
+	Restart *RestartPolicy  `json:"restart,omitempty"`
+	// signal sent to stop the application, SIGTERM by default
+	StopSignal string `json:"stopSignal,omitempty"`
+	// seconds to wait before killing the application, 10 by default and 60 at most
+	StopGracePeriodSeconds int `json:"stopGracePeriodSeconds,omitempty"`
+	// stop the descendant processes which left the process group
+	KillDescendants bool `json:"killDescendants,omitempty"`
+	// log rotation policy
+	Log *LogPolicy `json:"log,omitempty"`
+	// resource limits enforced by cgroup v2
+	Resources *ResourceSpec `json:"resources,omitempty"`
+	// user and groups to run the application, name or id
+	User                string   `json:"user,omitempty"`
+	Group               string   `json:"group,omitempty"`
+	SupplementaryGroups []string `json:"supplementaryGroups,omitempty"`
+	// octal umask, e.g. "0022"
+	Umask string `json:"umask,omitempty"`
+	// working directory, relative to the application version folder,
+	// which is the default one
+	WorkingDir string `json:"workingDir,omitempty"`
+	// health checks
+	LivenessProbe  *Probe `json:"livenessProbe,omitempty"`
+	ReadinessProbe *Probe `json:"readinessProbe,omitempty"`
+	// upgrade to this version, StartFirst by default
+	UpgradeStrategy UpgradeStrategyType `json:"upgradeStrategy,omitempty"`
+	// seconds the upgraded instance should be ready for, 5 by default
+	MinReadySeconds int `json:"minReadySeconds,omitempty"`
+}
+
+type LogPolicy struct {
+	// rotate the log file when it is bigger, 10 by default
+	MaxSizeMB int `json:"maxSizeMB,omitempty"`
+	// rotate the log file when it is older, 0 is disabled
+	MaxAgeHours int `json:"maxAgeHours,omitempty"`
+	// rotated files to keep, 5 by default
+	MaxFiles int `json:"maxFiles,omitempty"`
+	// write stderr to a separate log file
+	SplitStderr bool `json:"splitStderr,omitempty"`
+}
+
+type RestartPolicyType string
+
+const (
+	// RestartNever never restarts the exited application
+	RestartNever RestartPolicyType = "Never"
+	// RestartOnFailure restarts the application exited with non-zero code
+	RestartOnFailure RestartPolicyType = "OnFailure"
+	// RestartAlways restarts the exited application
+	RestartAlways RestartPolicyType = "Always"
+)
+
+type UpgradeStrategyType string
+
+const (
+	// start the new version, and stop the old one after it is ready
+	UpgradeStartFirst UpgradeStrategyType = "StartFirst"
+	// stop the old version before starting the new one, for the
+	// applications which can't run together such as port conflicting ones
+	UpgradeStopFirst UpgradeStrategyType = "StopFirst"
+)
+
+type RestartPolicy struct {
+	Type RestartPolicyType `json:"type,omitempty"`
+	// max restart times, 0 is unlimited
+	MaxRetries int `json:"maxRetries,omitempty"`
+	// first restart delay in seconds, doubled on each restart
+	BackoffSeconds int `json:"backoffSeconds,omitempty"`
+	// max restart delay in seconds
+	MaxBackoffSeconds int `json:"maxBackoffSeconds,omitempty"`
 }
 
 type NativeResource struct {
+	// fetcher type, the url scheme by default, and a url without scheme is
+	// a local file or a folder containing the resource file.
+	// Archive type tar, tar.gz, tgz or zip extracts the resource into the
+	// version folder, which is also detected by the file name suffix.
 	Type     string `json:"type,omitempty"`
 	FileName string `json:"fileName,omitempty"`
 	Url      string `json:"url,omitempty"`
-	Md5      string `json:"md5,omitempty"`
+	// hex digests verified after the resource is fetched, the resource with
+	// a sha digest is cached by it
+	Md5    string `json:"md5,omitempty"`
+	Sha256 string `json:"sha256,omitempty"`
+	Sha512 string `json:"sha512,omitempty"`
+	// fetch retries, 3 by default and disabled if negative
+	Retries int `json:"retries,omitempty"`
+	// initial retry backoff, doubled on each retry, 1 by default
+	RetryBackoffSeconds int `json:"retryBackoffSeconds,omitempty"`
+	// base64 detached signature of the sha256 digest of the file, which is
+	// verified against the trust store before the resource is extracted or run
+	Signature string `json:"signature,omitempty"`
+	// ed25519 by default, or x509 signed by the key of Certificate,
+	// PKCS#7/CMS signed data is not supported
+	SignatureType string `json:"signatureType,omitempty"`
+	// PEM signing certificate followed by the intermediates
+	Certificate string `json:"certificate,omitempty"`
+	// http request headers and credentials
+	Headers map[string]string `json:"headers,omitempty"`
+	Auth    *ResourceAuth     `json:"auth,omitempty"`
+	// S3 compatible object store for url s3://bucket/key
+	S3 *S3Source `json:"s3,omitempty"`
+}
+
+type ResourceAuth struct {
+	Username    string `json:"username,omitempty"`
+	Password    string `json:"password,omitempty"`
+	BearerToken string `json:"bearerToken,omitempty"`
+}
+
+type S3Source struct {
+	// path style endpoint, AWS S3 of the region by default
+	Endpoint string `json:"endpoint,omitempty"`
+	// us-east-1 by default
+	Region          string `json:"region,omitempty"`
+	AccessKeyId     string `json:"accessKeyId,omitempty"`
+	SecretAccessKey string `json:"secretAccessKey,omitempty"`
+	SessionToken    string `json:"sessionToken,omitempty"`
+}
+
+type ResourceSpec struct {
+	// cpu limit in millicores
+	CpuMillis int64 `json:"cpuMillis,omitempty"`
+	// memory limit in MB
+	MemoryMB int64 `json:"memoryMB,omitempty"`
+	// max process count, for native
+	Pids int64 `json:"pids,omitempty"`
+	// io weight in [1, 10000], for native
+	IOWeight int64 `json:"ioWeight,omitempty"`
+	// cpu request in millicores, for kube
+	CpuRequestMillis int64 `json:"cpuRequestMillis,omitempty"`
+	// memory request in MB, for kube
+	MemoryRequestMB int64 `json:"memoryRequestMB,omitempty"`
+}
+
+type Probe struct {
+	// one of the handlers
+	Exec      *ExecProbe      `json:"exec,omitempty"`
+	HttpGet   *HttpGetProbe   `json:"httpGet,omitempty"`
+	TcpSocket *TcpSocketProbe `json:"tcpSocket,omitempty"`
+
+	InitialDelaySeconds int `json:"initialDelaySeconds,omitempty"`
+	// 10 by default
+	PeriodSeconds int `json:"periodSeconds,omitempty"`
+	// 1 by default
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+	// 3 by default
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+	// 1 by default
+	SuccessThreshold int `json:"successThreshold,omitempty"`
+}
+
+type ExecProbe struct {
+	Command []string `json:"command,omitempty"`
+}
+
+type HttpGetProbe struct {
+	// 127.0.0.1 by default, the pod ip for kube
+	Host    string            `json:"host,omitempty"`
+	Port    int32             `json:"port,omitempty"`
+	Path    string            `json:"path,omitempty"`
+	Scheme  string            `json:"scheme,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+type TcpSocketProbe struct {
+	Host string `json:"host,omitempty"`
+	Port int32  `json:"port,omitempty"`
 }
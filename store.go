@@ -27,8 +27,14 @@ type Store interface {
 	ListApplicationRunTimes(int, string) ([]*ApplicationRuntime, string, error)
 	ForeachApplicationRunTime(func(*ApplicationRuntime)) error
 
+	GetApplicationHistory(string) (*ApplicationHistory, error)
+	UpdateApplicationHistory(string, func(*ApplicationHistory) error) error
+
 	AddConfig(*Config) error
 	RemoveConfig(string) error
 	HasConfig(string) (bool, error)
 	GetConfig(string) (*Config, error)
+	ForeachConfig(func(*Config)) error
+
+	Close() error
 }
@@ -14,6 +14,7 @@ const (
 	appkeyPath    = "/store/app"
 	runtimePath   = "/store/runtime"
 	configkeyPath = "/store/config"
+	historyPath   = "/store/history"
 )
 
 func makeAppkey(tag string) []byte {
@@ -26,6 +27,11 @@ func makeRuntimekey(name string) []byte {
 	return []byte(key)
 }
 
+func makeHistorykey(name string) []byte {
+	key := historyPath + "/" + name
+	return []byte(key)
+}
+
 func makeConfigkey(name string) []byte {
 	key := configkeyPath + "/" + name
 	return []byte(key)
@@ -105,7 +111,9 @@ func (s *LevelDBStore) HasApplication(tag *engine.ApplicationTag) (bool, error)
 
 func (s *LevelDBStore) GetApplication(tag *engine.ApplicationTag) (*engine.Application, error) {
 	data, err := s.db.Get(makeAppkey(tag.Tag()), nil)
-	if err != nil {
+	if err == leveldb.ErrNotFound {
+		return nil, engine.ErrStoreAppNoFound
+	} else if err != nil {
 		return nil, err
 	}
 
@@ -121,7 +129,9 @@ func (s *LevelDBStore) ListApplications(size int, lastPos string) ([]*engine.App
 	newPos := lastPos
 	var out []*engine.ApplicationTag
 	iter := s.db.NewIterator(util.BytesPrefix([]byte(appkeyPath)), nil)
-	iter.Seek([]byte(lastPos))
+	if len(lastPos) > 0 {
+		iter.Seek([]byte(lastPos))
+	}
 	for iter.Next() && size > 0 {
 		app := &engine.Application{}
 		if err := json.Unmarshal(iter.Value(), &app); err != nil {
@@ -129,7 +139,7 @@ func (s *LevelDBStore) ListApplications(size int, lastPos string) ([]*engine.App
 		}
 
 		out = append(out, &engine.ApplicationTag{app.Name, app.Version})
-		newPos = string(makeAppkey(app.Name))
+		newPos = string(makeAppkey(app.Tag()))
 
 		size--
 	}
@@ -260,7 +270,9 @@ func (s *LevelDBStore) HasConfig(name string) (bool, error) {
 
 func (s *LevelDBStore) GetConfig(name string) (*engine.Config, error) {
 	data, err := s.db.Get(makeConfigkey(name), nil)
-	if err != nil {
+	if err == leveldb.ErrNotFound {
+		return nil, engine.ErrStoreConfigNoFound
+	} else if err != nil {
 		return nil, err
 	}
 
@@ -271,3 +283,61 @@ func (s *LevelDBStore) GetConfig(name string) (*engine.Config, error) {
 
 	return config, nil
 }
+
+func (s *LevelDBStore) ForeachConfig(f func(*engine.Config)) error {
+	iter := s.db.NewIterator(util.BytesPrefix([]byte(configkeyPath+"/")), nil)
+	for iter.Next() {
+		config := &engine.Config{}
+		if err := json.Unmarshal(iter.Value(), config); err != nil {
+			continue
+		}
+		f(config)
+	}
+	iter.Release()
+
+	return iter.Error()
+}
+
+func (s *LevelDBStore) Close() error {
+	return s.db.Close()
+}
+
+// GetApplicationHistory returns an empty history if the application has never been started.
+func (s *LevelDBStore) GetApplicationHistory(name string) (*engine.ApplicationHistory, error) {
+	h := &engine.ApplicationHistory{Name: name}
+
+	data, err := s.db.Get(makeHistorykey(name), nil)
+	if err == leveldb.ErrNotFound {
+		return h, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, h); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+func (s *LevelDBStore) UpdateApplicationHistory(name string, f func(*engine.ApplicationHistory) error) error {
+	h, err := s.GetApplicationHistory(name)
+	if err != nil {
+		return err
+	}
+
+	if err := f(h); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.Put(makeHistorykey(name), data, nil); err != nil {
+		return err
+	}
+
+	return nil
+}
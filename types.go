@@ -2,6 +2,7 @@ package engine
 
 import (
 	"strings"
+	"time"
 )
 
 type EngineType string
@@ -13,6 +14,9 @@ const (
 	Native EngineType = "native"
 )
 
+// ReplicaIndexEnv is the environment variable of the native instance index.
+const ReplicaIndexEnv = "APP_ENGINE_REPLICA_INDEX"
+
 type Application struct {
 	ApplicationTag `json:",inline"`
 
@@ -23,6 +27,9 @@ type Application struct {
 	// engine type
 	Type EngineType `json:"type, omitempty"`
 
+	// instance count, 1 by default
+	Replicas int `json:"replicas,omitempty"`
+
 	KubeSpec   *KubeAppSpec   `json:"kubeSpec,omitempty"`
 	NativeSpec *NativeAppSpec `json:"nativeSpec,omitempty"`
 }
@@ -56,23 +63,53 @@ type ApplicationRuntime struct {
 	Err       string `json:"err,omitempty"`
 
 	// For native
-	Pid int `json:"pid,omitempty"`
+	Pid            int       `json:"pid,omitempty"`
+	StartTime      time.Time `json:"startTime,omitempty"`
+	RestartCount   int       `json:"restartCount,omitempty"`
+	LastExitCode   int       `json:"lastExitCode,omitempty"`
+	LastExitSignal string    `json:"lastExitSignal,omitempty"`
+	LastExitReason string    `json:"lastExitReason,omitempty"`
+	LastExitTime   time.Time `json:"lastExitTime,omitempty"`
+	OomKills       int       `json:"oomKills,omitempty"`
+	// resource download progress, total is 0 if unknown
+	DownloadedBytes int64 `json:"downloadedBytes,omitempty"`
+	TotalBytes      int64 `json:"totalBytes,omitempty"`
+	// pids of the replicas except the first one, -1 if not running
+	ReplicaPids []int `json:"replicaPids,omitempty"`
 }
 
 type ApplicationState struct {
-	Name      string          `json:"name,omitempty"`
-	Version   string          `json:"version,omitempty"`
-	ToStart   bool            `json:"toStart,omitempty"`
-	IsStarted bool            `json:"isStarted,omitempty"`
-	Err       string          `json:"err,omitempty"`
-	Instances []InstanceState `json:"instances,omitempty"`
+	Name           string    `json:"name,omitempty"`
+	Version        string    `json:"version,omitempty"`
+	ToStart        bool      `json:"toStart,omitempty"`
+	IsStarted      bool      `json:"isStarted,omitempty"`
+	Err            string    `json:"err,omitempty"`
+	StartTime      time.Time `json:"startTime,omitempty"`
+	RestartCount   int       `json:"restartCount,omitempty"`
+	LastExitCode   int       `json:"lastExitCode,omitempty"`
+	LastExitSignal string    `json:"lastExitSignal,omitempty"`
+	LastExitReason string    `json:"lastExitReason,omitempty"`
+	LastExitTime   time.Time `json:"lastExitTime,omitempty"`
+	OomKills       int       `json:"oomKills,omitempty"`
+	// resource download progress of native application
+	DownloadedBytes int64           `json:"downloadedBytes,omitempty"`
+	TotalBytes      int64           `json:"totalBytes,omitempty"`
+	Instances       []InstanceState `json:"instances,omitempty"`
 }
 
 type InstanceState struct {
-	Name    string `json:"name,omitempty"`
-	Running bool   `json:"running,omitempty"`
-	Cpu     int64  `json:"cpu,omitempty"`
-	Mem     int64  `json:"mem,omitempty"`
+	Name      string    `json:"name,omitempty"`
+	Index     int       `json:"index,omitempty"`
+	Running   bool      `json:"running,omitempty"`
+	Cpu       int64     `json:"cpu,omitempty"`
+	Mem       int64     `json:"mem,omitempty"`
+	Pid       int       `json:"pid,omitempty"`
+	StartTime time.Time `json:"startTime,omitempty"`
+	// process count of the instance process tree
+	Processes int `json:"processes,omitempty"`
+	// probe results
+	Ready   bool `json:"ready,omitempty"`
+	Healthy bool `json:"healthy,omitempty"`
 }
 
 type Config struct {
@@ -85,3 +122,50 @@ type ListApplicationOption struct {
 	Size    int    `json:"size"`
 	LastPos string `json:"lastPos"`
 }
+
+type LogOption struct {
+	// last lines to read, all lines if 0
+	TailLines int `json:"tailLines,omitempty"`
+	// read the logs since the time, for native applications
+	// it's applied to the rotated log files
+	Since time.Time `json:"since,omitempty"`
+	// follow the logs until the reader is closed
+	Follow bool `json:"follow,omitempty"`
+	// read the stderr logs if they are split
+	Stderr bool `json:"stderr,omitempty"`
+	// instance to read for multiple instances, the first one if empty
+	Instance string `json:"instance,omitempty"`
+}
+
+type LogRequest struct {
+	Tag    *ApplicationTag
+	Option *LogOption
+}
+
+type StopResult struct {
+	// the application didn't exit in the grace period and was killed
+	Killed bool `json:"killed"`
+}
+
+type StopOption struct {
+	// keep the started applications running
+	KeepApplications bool `json:"keepApplications"`
+}
+
+type GCResult struct {
+	// removed folders
+	Paths []string `json:"paths,omitempty"`
+	// bytes of the removed files
+	ReclaimedBytes int64 `json:"reclaimedBytes,omitempty"`
+}
+
+type ScaleRequest struct {
+	Tag      *ApplicationTag
+	Replicas int
+}
+
+type UpgradeRequest struct {
+	Name        string `json:"name,omitempty"`
+	FromVersion string `json:"fromVersion,omitempty"`
+	ToVersion   string `json:"toVersion,omitempty"`
+}
@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/jimi36/app-engine/log"
+)
+
+const (
+	// DefaultWatchBufferSize is the default buffer size of the watcher channel
+	DefaultWatchBufferSize = 64
+)
+
+type ApplicationEventType string
+
+const (
+	ApplicationCreated    ApplicationEventType = "created"
+	ApplicationStarting   ApplicationEventType = "starting"
+	ApplicationDownloaded ApplicationEventType = "downloaded"
+	ApplicationStarted    ApplicationEventType = "started"
+	ApplicationExited     ApplicationEventType = "exited"
+	ApplicationFailed     ApplicationEventType = "failed"
+	ApplicationStopped    ApplicationEventType = "stopped"
+	ApplicationRemoved    ApplicationEventType = "removed"
+)
+
+type ApplicationEvent struct {
+	ApplicationTag `json:",inline"`
+
+	Type ApplicationEventType `json:"type,omitempty"`
+	Time time.Time            `json:"time,omitempty"`
+	// for exited event
+	ExitCode int    `json:"exitCode,omitempty"`
+	Signal   string `json:"signal,omitempty"`
+	// for failed and exited event
+	Reason string `json:"reason,omitempty"`
+}
+
+type WatchOption struct {
+	// application names to watch, all applications if empty
+	Names []string `json:"names,omitempty"`
+	// buffer size of the event channel
+	BufferSize int `json:"bufferSize,omitempty"`
+}
+
+type Watcher struct {
+	cli   *Client
+	names map[string]bool
+	ch    chan ApplicationEvent
+}
+
+// Events returns the event channel, it is closed when the watcher is stopped.
+// Events are dropped if the channel is full.
+func (w *Watcher) Events() <-chan ApplicationEvent {
+	return w.ch
+}
+
+// Stop unsubscribes the watcher.
+func (w *Watcher) Stop() {
+	w.cli.watchMu.Lock()
+	defer w.cli.watchMu.Unlock()
+
+	if _, found := w.cli.watchers[w]; found {
+		delete(w.cli.watchers, w)
+		close(w.ch)
+	}
+}
+
+func (w *Watcher) match(ev *ApplicationEvent) bool {
+	if len(w.names) == 0 {
+		return true
+	}
+	return w.names[ev.Name]
+}
+
+// Watch subscribes the application lifecycle events.
+func (c *Client) Watch(opt *WatchOption) *Watcher {
+	if opt == nil {
+		opt = &WatchOption{}
+	}
+
+	size := opt.BufferSize
+	if size <= 0 {
+		size = DefaultWatchBufferSize
+	}
+
+	w := &Watcher{
+		cli:   c,
+		names: make(map[string]bool),
+		ch:    make(chan ApplicationEvent, size),
+	}
+	for _, name := range opt.Names {
+		w.names[name] = true
+	}
+
+	c.watchMu.Lock()
+	c.watchers[w] = struct{}{}
+	c.watchMu.Unlock()
+
+	return w
+}
+
+func (c *Client) notifyEvent(ev *ApplicationEvent) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+
+	log.Debugf("application[%s] event: %s", ev.Tag(), ev.Type)
+
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+
+	for w := range c.watchers {
+		if !w.match(ev) {
+			continue
+		}
+		select {
+		case w.ch <- *ev:
+		default:
+			log.Warnf("application[%s] event %s dropped: watcher is full", ev.Tag(), ev.Type)
+		}
+	}
+}
+
+func (c *Client) stopWatchers() {
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+
+	for w := range c.watchers {
+		delete(c.watchers, w)
+		close(w.ch)
+	}
+}